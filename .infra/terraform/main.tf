@@ -14,12 +14,37 @@ resource "google_storage_bucket" "datastore_bucket" {
 
   uniform_bucket_level_access = true
 
+  # backups/ の世代はアプリの保持ポリシー（BACKUP_RETENTION, 最長 1 年）で整理する
+  # ライフサイクルルールは整理ジョブが止まった場合の保険
   lifecycle_rule {
     action {
       type = "Delete"
     }
     condition {
       matches_prefix = ["backups"]
+      age            = 400
+    }
+  }
+
+  # 検査に失敗して隔離したスナップショット・他のインスタンスと競合して公開しなかったスナップショット（調査用）
+  lifecycle_rule {
+    action {
+      type = "Delete"
+    }
+    condition {
+      matches_prefix = ["quarantine", "conflicts"]
+      age            = 30
+    }
+  }
+
+  # WAL のレプリカ（generations/）はスナップショットを公開するたびにアプリが整理する（Replicator.Prune）
+  # ライフサイクルルールは整理が止まった場合の保険（スナップショットを失った世代は復元に使わず、current から起動する）
+  lifecycle_rule {
+    action {
+      type = "Delete"
+    }
+    condition {
+      matches_prefix = ["generations"]
       age            = 30
     }
   }
@@ -76,12 +101,18 @@ resource "google_cloud_run_v2_service" "app_service" {
         value = "off"
       }
       env {
-        name  = "PERIODIC_BACKUP"
-        value = "off"
+        name  = "BACKUP_ON_WRITE"
+        value = "on"
       }
-      env {
-        name  = "PERIODIC_BACKUP_MINUTES"
-        value = "10"
+
+      # 書き込みリースを引き継ぐ（/readyz が 200 になる）までトラフィックを切り替えない
+      startup_probe {
+        http_get {
+          path = "/readyz"
+        }
+        period_seconds    = 2
+        timeout_seconds   = 1
+        failure_threshold = 60
       }
 
       resources {
@@ -89,6 +120,9 @@ resource "google_cloud_run_v2_service" "app_service" {
           cpu    = "1000m"
           memory = "512Mi"
         }
+        # リクエストの無い間も CPU を割り当てる（書き込みリースの延長・WAL 配送・定期バックアップがバックグラウンドで動くため。
+        # 割り当てないと延長が止まり、アイドル後の書き込みがリースの延長を待つ）
+        cpu_idle          = false
         startup_cpu_boost = true
       }
     }
@@ -175,12 +175,13 @@ func main() {
 	log.SetFlags(log.LstdFlags | log.Lmicroseconds)
 	_ = os.MkdirAll(filepath.Dir(dbPath), 0755)
 
-	db, err := sqlitedriver.OpenAndInit(context.Background(), dbPath)
+	conns, err := sqlitedriver.OpenAndInit(context.Background(), dbPath)
 	must(err)
-	defer db.Close()
-	// 接続プール設定（サーバと同様に 10 を使用）
-	db.SetMaxOpenConns(10)
-	db.SetMaxIdleConns(10)
+	defer conns.Close()
+	// サーバと同様、書き込みは 1 接続に直列化し、読み取りプールは 10 を使用
+	conns.Reader.SetMaxOpenConns(10)
+	conns.Reader.SetMaxIdleConns(10)
+	db := conns.Writer
 
 	must(initSchema(db))
 
@@ -208,7 +209,7 @@ loop:
 				r.err = err
 				log.Printf("[backup] ERR: %v", err)
 			} else {
-				r.mainCount, _ = countRows(db)
+				r.mainCount, _ = countRows(conns.Reader)
 				// バックアップ側の件数を確認
 				if bkDB, err := sql.Open("sqlite", backupPath); err == nil {
 					defer bkDB.Close()
@@ -229,7 +230,7 @@ loop:
 	log.Println("[backup] final...")
 	must(backupOnce(ctx, dbPath, backupPath))
 	ic, _ := integrityCheck(backupPath)
-	mainCount, _ := countRows(db)
+	mainCount, _ := countRows(conns.Reader)
 	bkDB, _ := sql.Open("sqlite", backupPath)
 	defer func() {
 		if bkDB != nil {
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/kawabatas/mini-web-app/internal/app/usecase"
+	"github.com/kawabatas/mini-web-app/internal/httpx"
+	"github.com/kawabatas/mini-web-app/internal/infra/config"
+	"github.com/kawabatas/mini-web-app/internal/infra/datastore"
+	sqlitestrat "github.com/kawabatas/mini-web-app/internal/infra/datastore/sqlite"
+	storageif "github.com/kawabatas/mini-web-app/internal/infra/storage"
+	"github.com/kawabatas/mini-web-app/internal/util/clock"
+)
+
+const commandUsage = `usage:
+  server                          HTTP サーバを起動
+  server snapshots                保管済みスナップショットを新しい順に表示
+  server restore -at <時刻> [-dry-run]
+                                  時刻（RFC 3339）以前で最も新しいスナップショットに復元し、current に昇格
+  server prune [-dry-run]         保持ポリシー（BACKUP_RETENTION）に従って backups/ の古いスナップショットを削除
+
+サーバと同じ環境変数（DB_DRIVER / STORAGE_PROVIDER / SQLITE_BUCKET など）を使用します。
+restore はサービスを止めた（またはメンテナンスモードの）状態で実行してください。
+稼働中のサーバで行う場合は管理者 API（POST /api/v1/snapshots:restore）を使います。
+`
+
+// runCommand はサブコマンドを実行し、終了コードを返します。
+func runCommand(ctx context.Context, cfg config.AppConfig, args []string) int {
+	var run func(ctx context.Context, cfg config.AppConfig, store storageif.ObjectStore, args []string) error
+	switch args[0] {
+	case "snapshots":
+		run = listSnapshots
+	case "restore":
+		run = runRestore
+	case "prune":
+		run = runPrune
+	case "help", "-h", "--help":
+		fmt.Fprint(os.Stdout, commandUsage)
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command: %s\n\n%s", args[0], commandUsage)
+		return 2
+	}
+	store := newObjectStore(ctx, cfg)
+	err := run(ctx, cfg, store, args[1:])
+	closeObjectStore(ctx, store)
+	if err != nil {
+		slog.ErrorContext(ctx, "command failed", slog.String("command", args[0]), slog.Any("error", err))
+		return 1
+	}
+	return 0
+}
+
+// listSnapshots は DB を開かずに（終了時のスナップショットを作らずに）保管済みスナップショットを表示します。
+func listSnapshots(ctx context.Context, cfg config.AppConfig, store storageif.ObjectStore, args []string) error {
+	lister, ok := newSnapshotStrategy(cfg, store).(interface {
+		ListSnapshots(ctx context.Context) ([]datastore.SnapshotInfo, error)
+	})
+	if !ok {
+		return datastore.ErrSnapshotUnsupported
+	}
+	snaps, err := lister.ListSnapshots(ctx)
+	if err != nil {
+		return err
+	}
+	items := make([]datastore.SnapshotInfo, 0, len(snaps))
+	for i := len(snaps) - 1; i >= 0; i-- {
+		items = append(items, snaps[i])
+	}
+	return printJSON(usecase.SnapshotListResult{Items: items})
+}
+
+func runRestore(ctx context.Context, cfg config.AppConfig, store storageif.ObjectStore, args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	at := fs.String("at", "", "復元したい時刻（RFC 3339）")
+	dryRun := fs.Bool("dry-run", false, "スナップショットの選択と検証のみ行う")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	t, err := time.Parse(time.RFC3339, *at)
+	if err != nil {
+		return fmt.Errorf("-at: %w", err)
+	}
+	// 監査ログの操作者は実行したユーザー
+	actor := "cli:" + os.Getenv("USER")
+	ctx = httpx.WithActor(ctx, actor)
+	return withDataStore(ctx, cfg, store, func(ds datastore.DataStore) error {
+		result, err := usecase.NewSnapshotService(ds).RestoreAt(ctx, usecase.SnapshotRestoreParams{At: t, DryRun: *dryRun})
+		if err != nil {
+			return err
+		}
+		return printJSON(result)
+	})
+}
+
+func runPrune(ctx context.Context, cfg config.AppConfig, store storageif.ObjectStore, args []string) error {
+	fs := flag.NewFlagSet("prune", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "削除せずに判定のみ表示する")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	decisions, err := pruneBackups(ctx, cfg, newSnapshotStrategy(cfg, store), *dryRun)
+	if err != nil {
+		return err
+	}
+	return printJSON(map[string]any{"dry_run": *dryRun, "items": decisions})
+}
+
+// backupPruner は backups/ の世代整理ができるスナップショット戦略です。
+type backupPruner interface {
+	PruneSnapshots(ctx context.Context, p sqlitestrat.RetentionPolicy, now time.Time, dryRun bool) ([]sqlitestrat.RetentionDecision, error)
+}
+
+// pruneBackups は設定の保持ポリシーで strat の backups/ を整理します。
+func pruneBackups(ctx context.Context, cfg config.AppConfig, strat datastore.SnapshotStrategy, dryRun bool) ([]sqlitestrat.RetentionDecision, error) {
+	pruner, ok := strat.(backupPruner)
+	if !ok {
+		return nil, datastore.ErrSnapshotUnsupported
+	}
+	policy, err := sqlitestrat.ParseRetentionPolicy(cfg.BackupRetention)
+	if err != nil {
+		return nil, err
+	}
+	return pruner.PruneSnapshots(ctx, policy, clock.Now(), dryRun)
+}
+
+// withDataStore はサーバと同じ構成で DataStore を開いて fn を実行し、閉じます（終了時のスナップショットも行われます）。
+func withDataStore(ctx context.Context, cfg config.AppConfig, store storageif.ObjectStore, fn func(ds datastore.DataStore) error) error {
+	ds, err := datastore.Open(ctx, datastore.Config{Driver: cfg.DBDriver, Source: cfg.SqliteSource, DSN: cfg.PostgresDSN, Strategy: newSnapshotStrategy(cfg, store), Lease: newWriteLease(cfg, store)})
+	if err != nil {
+		return err
+	}
+	err = fn(ds)
+	ctxClose, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Minute)
+	defer cancel()
+	if cErr := ds.Close(ctxClose); cErr != nil && err == nil {
+		err = cErr
+	}
+	return err
+}
+
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
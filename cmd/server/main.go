@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"errors"
+	"io"
 	"log"
 	"log/slog"
 	"net/http"
@@ -12,12 +13,16 @@ import (
 	"time"
 
 	apphttp "github.com/kawabatas/mini-web-app/internal/app/http"
+	"github.com/kawabatas/mini-web-app/internal/app/outbox"
+	"github.com/kawabatas/mini-web-app/internal/app/usecase"
+	"github.com/kawabatas/mini-web-app/internal/domain/event"
 	"github.com/kawabatas/mini-web-app/internal/httpx"
 	"github.com/kawabatas/mini-web-app/internal/infra/config"
 	"github.com/kawabatas/mini-web-app/internal/infra/datastore"
 	sqlitestrat "github.com/kawabatas/mini-web-app/internal/infra/datastore/sqlite"
 	"github.com/kawabatas/mini-web-app/internal/infra/platform/logger"
 	storageif "github.com/kawabatas/mini-web-app/internal/infra/storage"
+	"github.com/kawabatas/mini-web-app/internal/infra/storage/envelope"
 	gcsstore "github.com/kawabatas/mini-web-app/internal/infra/storage/gcs"
 	localstore "github.com/kawabatas/mini-web-app/internal/infra/storage/local"
 )
@@ -26,37 +31,44 @@ func main() {
 	cfg := config.NewFromEnv()
 	lvl := logger.ParseLevel(cfg.LogLevel)
 	slog.SetDefault(logger.New(cfg.LogProvider, lvl))
+	for _, msg := range cfg.Deprecations() {
+		slog.Warn("config: " + msg)
+	}
 
 	ctx := context.Background()
 
-	var objStore storageif.ObjectStore = localstore.Noop{}
-	if cfg.StorageProvider == "gcs" && cfg.SqliteBucket != "" {
-		objStore = &gcsstore.Adapter{}
+	// サブコマンド（スナップショットの一覧・復元など）
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(ctx, cfg, os.Args[1:]))
 	}
 
-	// スナップショット戦略を選択
-	var strat datastore.SnapshotStrategy = datastore.NoopSnapshotStrategy{}
-	if cfg.DBDriver == "" || cfg.DBDriver == "sqlite" {
-		if cfg.SnapshotEnabled() {
-			strat = sqlitestrat.GCSSnapshotStrategy{ObjectStore: objStore, Bucket: cfg.SqliteBucket}
-		} else {
-			strat = sqlitestrat.LocalSnapshotStrategy{OutputDir: ""}
-		}
+	// オブジェクトストレージのクライアントはスナップショット・WAL 配送・書き込みリースで共有し、DB を閉じた後に閉じる
+	objStore := newObjectStore(ctx, cfg)
+	strat := newSnapshotStrategy(cfg, objStore)
+	dsCfg := datastore.Config{Driver: cfg.DBDriver, Source: cfg.SqliteSource, DSN: cfg.PostgresDSN, Strategy: strat, Lease: newWriteLease(cfg, objStore)}
+	if cfg.BackupOnWriteEnabled() {
+		// 書き込みが止んでからバックアップ（まとまった編集でも 1 回、書き込みの無いインスタンスはアップロードしない）
+		dsCfg.AutoBackup = datastore.AutoBackupConfig{Quiet: cfg.BackupQuiet(), MaxDelay: cfg.BackupMaxDelay()}
 	}
-	ds, err := datastore.Open(ctx, datastore.Config{Driver: cfg.DBDriver, Source: cfg.SqliteSource, Strategy: strat})
+	// 書き込みリースを使う場合、新しいリビジョンは古いリビジョンにリースの引き継ぎを依頼し、引き継ぐまで読み取り専用で待つ（/readyz が 503）
+	dsCfg.Handover = dsCfg.Lease != nil
+	ds, err := datastore.Open(ctx, dsCfg)
 	if err != nil {
 		log.Fatalf("datastore open error: %v", err)
 	}
-	// 接続プール設定: 最大接続・アイドルともに 10
+	// 読み取りプール設定: 最大接続・アイドルともに 10（書き込みは 1 接続に直列化）
 	ds.SetConnPool(10, 10)
 	// defer ds.Close() --- シャットダウン時に呼び出し ---
 
 	mux := http.NewServeMux()
-	apphttp.Register(mux, ds)
+	if cfg.CursorSecret == "" {
+		slog.WarnContext(ctx, "CURSOR_SECRET is not set; paging cursors are invalidated on restart")
+	}
+	apphttp.Register(mux, ds, apphttp.Options{CursorSecret: []byte(cfg.CursorSecret), AdminToken: cfg.AdminToken})
 	// Static (serve built assets)
 	mux.Handle("/", httpx.CachingFileServer("./frontend/dist"))
 
-	handler := httpx.LoggingMiddleware(httpx.MaintenanceMiddleware(httpx.RecoverMiddleware(mux)))
+	handler := httpx.LoggingMiddleware(httpx.ActorMiddleware(cfg.IAPEnabled())(httpx.MaintenanceMiddleware(httpx.RecoverMiddleware(mux))))
 
 	srv := &http.Server{
 		Addr:              ":" + cfg.Port,
@@ -66,24 +78,59 @@ func main() {
 		IdleTimeout:       time.Second,
 	}
 
-	// 定期バックアップ（VACUUM INTO の負荷を避けるためデフォルトoff）
-	if (cfg.DBDriver == "" || cfg.DBDriver == "sqlite") && cfg.PeriodicBackupEnabled() {
+	// backups/ の世代整理（保持ポリシーに従い 1 時間ごと）
+	if cfg.BackupPruneEnabled() {
+		if _, err := sqlitestrat.ParseRetentionPolicy(cfg.BackupRetention); err != nil {
+			log.Fatalf("backup retention error: %v", err)
+		}
 		go func() {
-			ticker := time.NewTicker(time.Duration(cfg.PeriodicBackupIntervalMinutes()) * time.Minute)
+			ticker := time.NewTicker(time.Hour)
 			defer ticker.Stop()
-			for range ticker.C {
-				ctxSnap, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
-				slog.InfoContext(ctxSnap, "periodic snapshot start")
-				if err := ds.Backup(ctxSnap); err != nil {
-					slog.ErrorContext(ctxSnap, "periodic snapshot failed", slog.Any("error", err))
-				} else {
-					slog.InfoContext(ctxSnap, "periodic snapshot complete")
+			for {
+				ctxPrune, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+				if _, err := pruneBackups(ctxPrune, cfg, strat, cfg.BackupPruneDryRun()); err != nil {
+					slog.ErrorContext(ctxPrune, "backup prune failed", slog.Any("error", err))
 				}
 				cancel()
+				<-ticker.C
 			}
 		}()
 	}
 
+	// 論理削除から保持期間を過ぎた行を定期的に物理削除
+	go func() {
+		retention := cfg.SoftDeleteRetention()
+		svc := usecase.NewSingerService(ds, nil)
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for {
+			ctxPurge, cancel := context.WithTimeout(httpx.WithActor(context.Background(), "system:purge"), time.Minute)
+			if n, err := svc.PurgeDeleted(ctxPurge, retention); errors.Is(err, usecase.ErrReadOnly) {
+				slog.DebugContext(ctxPurge, "purge skipped: datastore is read-only")
+			} else if err != nil {
+				slog.ErrorContext(ctxPurge, "purge deleted singers failed", slog.Any("error", err))
+			} else if n > 0 {
+				slog.InfoContext(ctxPurge, "purged deleted singers", slog.Int64("rows", n), slog.Duration("retention", retention))
+			}
+			cancel()
+			<-ticker.C
+		}
+	}()
+
+	// ドメインイベントの配信（outbox）。購読者はここで登録する
+	dispatcher := outbox.NewDispatcher(ds)
+	for _, t := range event.Types() {
+		if err := dispatcher.Subscribe(t, outbox.LogHandler); err != nil {
+			log.Fatalf("outbox subscribe error: %v", err)
+		}
+	}
+	ctxDispatch, stopDispatch := context.WithCancel(context.Background())
+	dispatchDone := make(chan struct{})
+	go func() {
+		defer close(dispatchDone)
+		dispatcher.Run(ctxDispatch)
+	}()
+
 	go func() {
 		slog.InfoContext(ctx, "server starting", slog.String("addr", srv.Addr))
 		if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
@@ -104,9 +151,80 @@ func main() {
 	if err := srv.Shutdown(ctxShutdown); err != nil {
 		log.Fatalf("shutdown error: %v", err)
 	}
+	// 配信中のイベントを終えてから DB を閉じる（未配信分は次回起動時に配信される）
+	stopDispatch()
+	<-dispatchDone
 	if err := ds.Close(ctxShutdown); err != nil {
 		log.Fatalf("datastore close error: %v", err)
 	}
+	closeObjectStore(ctxShutdown, objStore)
 
 	slog.InfoContext(ctxShutdown, "graceful shutdown complete")
 }
+
+// newObjectStore は設定からスナップショットの保存先のオブジェクトストレージを選びます（closeObjectStore で閉じる）。
+func newObjectStore(ctx context.Context, cfg config.AppConfig) storageif.ObjectStore {
+	switch {
+	case cfg.StorageProvider == "gcs" && cfg.SqliteBucket != "":
+		store, err := gcsstore.NewAdapter(ctx)
+		if err != nil {
+			log.Fatalf("gcs client error: %v", err)
+		}
+		return store
+	case cfg.StorageProvider == "fs" && cfg.SqliteBucket != "":
+		return localstore.FS{}
+	}
+	return localstore.Noop{}
+}
+
+// closeObjectStore はクライアントを持つオブジェクトストレージ（GCS）を閉じます。
+func closeObjectStore(ctx context.Context, store storageif.ObjectStore) {
+	if c, ok := store.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			slog.WarnContext(ctx, "close object store failed", slog.Any("error", err))
+		}
+	}
+}
+
+// newSnapshotStrategy は設定からスナップショット戦略（圧縮・暗号化・WAL 配送）を組み立てます。
+func newSnapshotStrategy(cfg config.AppConfig, objStore storageif.ObjectStore) datastore.SnapshotStrategy {
+	var strat datastore.SnapshotStrategy = datastore.NoopSnapshotStrategy{}
+	if cfg.DBDriver == "" || cfg.DBDriver == "sqlite" {
+		if cfg.SnapshotEnabled() {
+			// 鍵が設定されていればスナップショット・WAL を暗号化してからアップロードする
+			keyring, err := envelope.LoadKeyring(cfg.SnapshotKEKs, cfg.SnapshotKEKsFile, cfg.SnapshotKEKActive)
+			if err != nil {
+				log.Fatalf("snapshot keys error: %v", err)
+			}
+			gcsStrat := sqlitestrat.GCSSnapshotStrategy{ObjectStore: objStore, Bucket: cfg.SqliteBucket, Compression: cfg.SnapshotCompression, Keyring: keyring}
+			// 起動時に読んだ current の世代番号を前提に公開し、他のインスタンスが公開していれば上書きしない
+			gcsStrat.Fence = &sqlitestrat.PublishFence{}
+			// 公開前の検査に失敗したスナップショットは current に昇格せず quarantine/ に保管し、
+			// 受け入れる（POST /api/v1/snapshots:accept）まで以降の公開も止める
+			gcsStrat.Hold = &sqlitestrat.PublishHold{}
+			gcsStrat.Verify = sqlitestrat.VerifyPolicy{
+				MaxRowDropPercent: cfg.SnapshotMaxRowDropPercent(),
+				Queries:           sqlitestrat.ParseSanityQueries(cfg.SnapshotSanitySQL),
+			}
+			if cfg.WALShippingEnabled() {
+				// WAL を数秒間隔で配送し、起動時は最新スナップショット + WAL から復元する
+				gcsStrat.Replicator = sqlitestrat.NewReplicator(objStore, cfg.SqliteBucket)
+				gcsStrat.Replicator.Interval = cfg.WALShipInterval()
+				gcsStrat.Replicator.Keyring = keyring
+			}
+			strat = gcsStrat
+		} else {
+			strat = sqlitestrat.LocalSnapshotStrategy{OutputDir: ""}
+		}
+	}
+	return strat
+}
+
+// newWriteLease は書き込みリースを組み立てます（無効なら nil）。
+// リースを保持するインスタンスだけが書き込みを受け付け、他は読み取り専用で動作します。
+func newWriteLease(cfg config.AppConfig, objStore storageif.ObjectStore) *sqlitestrat.Lease {
+	if !cfg.WriteLeaseEnabled() || (cfg.DBDriver != "" && cfg.DBDriver != "sqlite") {
+		return nil
+	}
+	return &sqlitestrat.Lease{ObjectStore: objStore, Bucket: cfg.SqliteBucket, Holder: sqlitestrat.NewLeaseHolder(), TTL: cfg.WriteLeaseTTL()}
+}
@@ -0,0 +1,33 @@
+package apphttp
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// adminAuth は管理者向け操作の認可です。
+// Authorization: Bearer <ADMIN_TOKEN> が一致するリクエストを管理者として扱います（トークン未設定時は常に拒否）。
+type adminAuth struct {
+	token []byte
+}
+
+func (a adminAuth) isAdmin(r *http.Request) bool {
+	if len(a.token) == 0 {
+		return false
+	}
+	got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(got), a.token) == 1
+}
+
+// require は管理者でなければ 403 を書き込み false を返します。
+func (a adminAuth) require(w http.ResponseWriter, r *http.Request) bool {
+	if !a.isAdmin(r) {
+		writeError(w, http.StatusForbidden, "admin privileges required")
+		return false
+	}
+	return true
+}
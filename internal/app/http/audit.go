@@ -0,0 +1,29 @@
+package apphttp
+
+import (
+	"net/http"
+
+	"github.com/kawabatas/mini-web-app/internal/app/usecase"
+)
+
+// listAudit は監査ログを新しい順に返します（管理者のみ）。
+// 絞り込み: entity / entity_id / actor（等価）、at[gt|gte|lt|lte]（RFC 3339 または日付）
+func listAudit(svc *usecase.AuditService, admin adminAuth) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !admin.require(w, r) {
+			return
+		}
+		filter, invalid := parseAuditListQuery(r.URL.Query())
+		if len(invalid) > 0 {
+			writeFieldsError(w, http.StatusBadRequest, "invalid query", invalid)
+			return
+		}
+		result, err := svc.List(r.Context(), usecase.AuditListParams{PageRequest: pageRequest(r), Filter: filter})
+		if err != nil {
+			writeQueryError(w, r, err, "failed to list audit log")
+			return
+		}
+		setLinkHeader(w, r, result.PageInfo)
+		writeJSON(w, http.StatusOK, result)
+	}
+}
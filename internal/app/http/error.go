@@ -2,12 +2,17 @@ package apphttp
 
 import (
 	"encoding/json"
+	"errors"
+	"log/slog"
 	"net/http"
+
+	"github.com/kawabatas/mini-web-app/internal/app/usecase"
 )
 
 type errorResp struct {
-	Error   string `json:"error"`
-	Message string `json:"message"`
+	Error   string            `json:"error"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"`
 }
 
 func writeJSON(w http.ResponseWriter, status int, v any) {
@@ -19,3 +24,43 @@ func writeJSON(w http.ResponseWriter, status int, v any) {
 func writeError(w http.ResponseWriter, status int, msg string) {
 	writeJSON(w, status, errorResp{Error: http.StatusText(status), Message: msg})
 }
+
+// writeFieldsError はフィールド単位のエラー詳細付きで返します。
+func writeFieldsError(w http.ResponseWriter, status int, msg string, fields map[string]string) {
+	writeJSON(w, status, errorResp{Error: http.StatusText(status), Message: msg, Fields: fields})
+}
+
+// writeUsecaseError はユースケース層のエラーを HTTP ステータスに変換して返します。
+// 想定外のエラーは 500 とし、詳細はログにのみ出力します。
+func writeUsecaseError(w http.ResponseWriter, r *http.Request, err error, msg string) {
+	var verr *usecase.ValidationError
+	switch {
+	case errors.As(err, &verr):
+		writeFieldsError(w, http.StatusUnprocessableEntity, "invalid input", verr.Fields)
+	case errors.Is(err, usecase.ErrNotFound):
+		writeError(w, http.StatusNotFound, "not found")
+	case errors.Is(err, usecase.ErrConflict):
+		writeError(w, http.StatusConflict, "conflicts with an existing record")
+	case errors.Is(err, usecase.ErrVersionConflict):
+		writeError(w, http.StatusPreconditionFailed, "If-Match does not match the current version")
+	case errors.Is(err, usecase.ErrReadOnly):
+		// 書き込みリースを保持していないインスタンス（リースの取得待ち・別インスタンスが稼働中）
+		w.Header().Set("Retry-After", "5")
+		writeError(w, http.StatusServiceUnavailable, "read-only: this instance does not hold the write lease")
+	case errors.Is(err, usecase.ErrNotSupported):
+		writeError(w, http.StatusNotImplemented, "not supported in this configuration")
+	default:
+		slog.ErrorContext(r.Context(), msg, slog.Any("error", err))
+		writeError(w, http.StatusInternalServerError, msg)
+	}
+}
+
+// writeQueryError はクエリパラメータ起因の検証エラーを 400 として返します（それ以外は writeUsecaseError と同じ）。
+func writeQueryError(w http.ResponseWriter, r *http.Request, err error, msg string) {
+	var verr *usecase.ValidationError
+	if errors.As(err, &verr) {
+		writeFieldsError(w, http.StatusBadRequest, "invalid query", verr.Fields)
+		return
+	}
+	writeUsecaseError(w, r, err, msg)
+}
@@ -0,0 +1,38 @@
+package apphttp
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// 楽観的排他制御
+//
+// 単一リソースのレスポンスはバージョンを ETag（例: "3"）として返します。
+// PUT / PATCH / DELETE では If-Match に直前に取得した ETag の指定を必須とし、
+//   - 未指定（または "*"）: 428 Precondition Required
+//   - 現在のバージョンと不一致: 412 Precondition Failed
+//
+// とします。
+
+// setETag はバージョンを強い ETag として設定します。
+func setETag(w http.ResponseWriter, version int64) {
+	w.Header().Set("ETag", `"`+strconv.FormatInt(version, 10)+`"`)
+}
+
+// ifMatchVersion は If-Match の ETag からバージョンを読み取ります。
+// 未指定の場合は 428、解釈できない場合（弱い ETag を含む）は一致しないものとして 412 を書き込み false を返します。
+func ifMatchVersion(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	h := strings.TrimSpace(r.Header.Get("If-Match"))
+	if h == "" || h == "*" {
+		writeError(w, http.StatusPreconditionRequired, `If-Match header with the resource ETag is required`)
+		return 0, false
+	}
+	// If-Match は強い比較のため、W/ 付きの ETag は一致しない
+	v, err := strconv.ParseInt(strings.Trim(h, `"`), 10, 64)
+	if err != nil || !strings.HasPrefix(h, `"`) || !strings.HasSuffix(h, `"`) || v <= 0 {
+		writeError(w, http.StatusPreconditionFailed, "If-Match does not match the current version")
+		return 0, false
+	}
+	return v, true
+}
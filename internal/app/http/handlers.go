@@ -2,53 +2,322 @@ package apphttp
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/kawabatas/mini-web-app/internal/app/usecase"
 	"github.com/kawabatas/mini-web-app/internal/infra/datastore"
 )
 
+// Options は API の依存設定です。
+type Options struct {
+	// CursorSecret はページングのカーソルトークンの署名鍵です（空の場合は起動ごとにランダム生成）。
+	CursorSecret []byte
+	// AdminToken は管理者向け操作（削除済みの参照・復元、監査ログ、スナップショットからの復元・受け入れ）の Bearer トークンです（空の場合は管理者操作を無効化）。
+	AdminToken string
+}
+
 // Register wires API endpoints onto the provided mux.
-func Register(mux *http.ServeMux, ds datastore.DataStore) {
+func Register(mux *http.ServeMux, ds datastore.DataStore, opts Options) {
 	mux.HandleFunc("GET /healthz", healthz(ds)) // DB接続も確認するため healthz
+	mux.HandleFunc("GET /readyz", readyz(ds))
+
+	cursor := usecase.NewCursorCodec(opts.CursorSecret)
+	admin := adminAuth{token: []byte(opts.AdminToken)}
 
 	// Singerはサンプル実装です。
-	svc := usecase.NewSingerService(ds)
-	mux.HandleFunc("GET /api/v1/singers", listSingers(svc))
+	svc := usecase.NewSingerService(ds, cursor)
+	mux.HandleFunc("GET /api/v1/singers", listSingers(svc, admin))
+	mux.HandleFunc("POST /api/v1/singers", createSinger(svc))
+	mux.HandleFunc("GET /api/v1/singers/search", searchSingers(svc))
+	mux.HandleFunc("GET /api/v1/singers/{id}", getSinger(svc))
+	mux.HandleFunc("PUT /api/v1/singers/{id}", updateSinger(svc))
+	mux.HandleFunc("PATCH /api/v1/singers/{id}", patchSinger(svc))
+	mux.HandleFunc("DELETE /api/v1/singers/{id}", deleteSinger(svc))
+	// {id}:restore の形式（カスタムメソッド）。ServeMux はセグメント途中のワイルドカードを扱えないため、ハンドラ側で分解する
+	mux.HandleFunc("POST /api/v1/singers/{id}", restoreSinger(svc, admin))
+
+	mux.HandleFunc("GET /api/v1/audit", listAudit(usecase.NewAuditService(ds, cursor), admin))
+
+	snapshots := usecase.NewSnapshotService(ds)
+	mux.HandleFunc("GET /api/v1/snapshots", listSnapshots(snapshots, admin))
+	mux.HandleFunc("POST /api/v1/snapshots:restore", restoreSnapshot(snapshots, admin))
+	mux.HandleFunc("POST /api/v1/snapshots:accept", acceptSnapshot(snapshots, admin))
 }
 
+// healthz は DB の疎通を返します。起動時に current が使えず backups/ の過去のスナップショットから復元した場合は
+// status を degraded とし、復元元を restored_from に返します（稼働は続けるため 200）。
+// 公開前の検査に失敗して current への公開を止めている場合も degraded とし、原因を snapshot_held に返します
+// （POST /api/v1/snapshots:accept で受け入れるまで、書き込みは current に反映されません）。
 func healthz(ds datastore.DataStore) http.HandlerFunc {
 	type resp struct {
-		Status string `json:"status"`
+		Status       string                  `json:"status"`
+		RestoredFrom string                  `json:"restored_from,omitempty"`
+		SnapshotHeld *datastore.HeldSnapshot `json:"snapshot_held,omitempty"`
 	}
 	return func(w http.ResponseWriter, r *http.Request) {
 		if err := ds.Ping(r.Context()); err != nil {
 			writeJSON(w, http.StatusServiceUnavailable, resp{Status: "ng"})
 			return
 		}
-		writeJSON(w, http.StatusOK, resp{Status: "ok"})
+		out := resp{Status: "ok", SnapshotHeld: snapshotHeld(ds)}
+		if sr, ok := ds.(datastore.StartupReporter); ok {
+			if rep := sr.StartupReport(); rep.Degraded {
+				out.Status, out.RestoredFrom = "degraded", rep.Source
+			}
+		}
+		if out.SnapshotHeld != nil {
+			out.Status = "degraded"
+		}
+		writeJSON(w, http.StatusOK, out)
+	}
+}
+
+// readyz は書き込みを受け付けているかを返します。書き込みリースを保持していない（読み取り専用の）間は 503 です。
+// 読み取りは受け付けるため、稼働の確認（liveness）には healthz を使います。
+// current への公開を止めている場合は snapshot_held に返します（書き込みは受け付けるため 200。起動プローブで
+// 再起動されると、公開していない書き込みを持つインスタンスを失うため）。
+func readyz(ds datastore.DataStore) http.HandlerFunc {
+	type resp struct {
+		Status       string                  `json:"status"`
+		Reason       string                  `json:"reason,omitempty"`
+		SnapshotHeld *datastore.HeldSnapshot `json:"snapshot_held,omitempty"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		held := snapshotHeld(ds)
+		if g, ok := ds.(datastore.WriteGate); ok && !g.Writable(r.Context()) {
+			writeJSON(w, http.StatusServiceUnavailable, resp{Status: "read-only", Reason: "write lease is not held", SnapshotHeld: held})
+			return
+		}
+		writeJSON(w, http.StatusOK, resp{Status: "ready", SnapshotHeld: held})
 	}
 }
 
+// snapshotHeld は current への公開を止めていれば、その原因を返します。
+func snapshotHeld(ds datastore.DataStore) *datastore.HeldSnapshot {
+	if a, ok := ds.(datastore.SnapshotAcceptor); ok {
+		if h, held := a.PublishHold(); held {
+			return &h
+		}
+	}
+	return nil
+}
+
 // listSingers はユースケース層（SingerService）を利用して一覧を返します。
-func listSingers(svc *usecase.SingerService) http.HandlerFunc {
+// 絞り込み・並び替えは parseSingerListQuery を参照。論理削除済みの行は include_deleted=true（管理者のみ）で含めます。
+// ページングはキーセット方式で、次ページ・前ページの URL を Link ヘッダ（RFC 8288）でも返します。
+func listSingers(svc *usecase.SingerService, admin adminAuth) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		q := r.URL.Query()
-		limit := atoiDefault(q.Get("limit"), 50)
-		offset := atoiDefault(q.Get("offset"), 0)
+		filter, sort, invalid := parseSingerListQuery(r.URL.Query())
+		if len(invalid) > 0 {
+			writeFieldsError(w, http.StatusBadRequest, "invalid query", invalid)
+			return
+		}
+		if filter.IncludeDeleted && !admin.require(w, r) {
+			return
+		}
 		params := usecase.SingerListParams{
-			Limit:  limit,
-			Offset: offset,
+			PageRequest: pageRequest(r),
+			Filter:      filter,
+			Sort:        sort,
 		}
 		result, err := svc.List(r.Context(), params)
 		if err != nil {
-			writeError(w, http.StatusInternalServerError, "failed to list singers")
+			writeQueryError(w, r, err, "failed to list singers")
+			return
+		}
+		setLinkHeader(w, r, result.PageInfo)
+		writeJSON(w, http.StatusOK, result)
+	}
+}
+
+// searchSingers は q（空白区切りの AND）で name / genre を部分一致検索し、関連度順に返します。
+// ページングは一覧と同じキーセット方式（limit / cursor、Link ヘッダ）です。
+func searchSingers(svc *usecase.SingerService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := usecase.SingerSearchParams{
+			PageRequest: pageRequest(r),
+			Query:       r.URL.Query().Get("q"),
+		}
+		result, err := svc.Search(r.Context(), params)
+		if err != nil {
+			writeQueryError(w, r, err, "failed to search singers")
+			return
+		}
+		setLinkHeader(w, r, result.PageInfo)
+		writeJSON(w, http.StatusOK, result)
+	}
+}
+
+// singerBody は POST / PUT のリクエストボディです。
+type singerBody struct {
+	Name      string `json:"name"`
+	Genre     string `json:"genre"`
+	DebutYear int    `json:"debut_year"`
+}
+
+// singerPatchBody は PATCH のリクエストボディです。省略したフィールドは変更しません。
+type singerPatchBody struct {
+	Name      *string `json:"name"`
+	Genre     *string `json:"genre"`
+	DebutYear *int    `json:"debut_year"`
+}
+
+func getSinger(svc *usecase.SingerService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := pathID(w, r)
+		if !ok {
+			return
+		}
+		s, err := svc.Get(r.Context(), id)
+		if err != nil {
+			writeUsecaseError(w, r, err, "failed to get singer")
+			return
+		}
+		setETag(w, s.Version)
+		writeJSON(w, http.StatusOK, s)
+	}
+}
+
+func createSinger(svc *usecase.SingerService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body singerBody
+		if !decodeBody(w, r, &body) {
+			return
+		}
+		s, err := svc.Create(r.Context(), usecase.SingerInput(body))
+		if err != nil {
+			writeUsecaseError(w, r, err, "failed to create singer")
+			return
+		}
+		w.Header().Set("Location", fmt.Sprintf("/api/v1/singers/%d", s.ID))
+		setETag(w, s.Version)
+		writeJSON(w, http.StatusCreated, s)
+	}
+}
+
+func updateSinger(svc *usecase.SingerService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := pathID(w, r)
+		if !ok {
+			return
+		}
+		version, ok := ifMatchVersion(w, r)
+		if !ok {
+			return
+		}
+		var body singerBody
+		if !decodeBody(w, r, &body) {
+			return
+		}
+		s, err := svc.Update(r.Context(), id, version, usecase.SingerInput(body))
+		if err != nil {
+			writeUsecaseError(w, r, err, "failed to update singer")
+			return
+		}
+		setETag(w, s.Version)
+		writeJSON(w, http.StatusOK, s)
+	}
+}
+
+func patchSinger(svc *usecase.SingerService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := pathID(w, r)
+		if !ok {
+			return
+		}
+		version, ok := ifMatchVersion(w, r)
+		if !ok {
+			return
+		}
+		var body singerPatchBody
+		if !decodeBody(w, r, &body) {
+			return
+		}
+		s, err := svc.Patch(r.Context(), id, version, usecase.SingerPatch(body))
+		if err != nil {
+			writeUsecaseError(w, r, err, "failed to patch singer")
 			return
 		}
-		w.Header().Set("Content-Type", "application/json")
-		_ = json.NewEncoder(w).Encode(result)
+		setETag(w, s.Version)
+		writeJSON(w, http.StatusOK, s)
+	}
+}
+
+func deleteSinger(svc *usecase.SingerService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := pathID(w, r)
+		if !ok {
+			return
+		}
+		version, ok := ifMatchVersion(w, r)
+		if !ok {
+			return
+		}
+		if err := svc.Delete(r.Context(), id, version); err != nil {
+			writeUsecaseError(w, r, err, "failed to delete singer")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// restoreSinger は POST /api/v1/singers/{id}:restore で論理削除済みのレコードを復元します（管理者のみ）。
+func restoreSinger(svc *usecase.SingerService, admin adminAuth) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		raw, ok := strings.CutSuffix(r.PathValue("id"), ":restore")
+		if !ok {
+			writeError(w, http.StatusNotFound, "not found")
+			return
+		}
+		id, ok := parseID(w, raw)
+		if !ok || !admin.require(w, r) {
+			return
+		}
+		s, err := svc.Restore(r.Context(), id)
+		if err != nil {
+			writeUsecaseError(w, r, err, "failed to restore singer")
+			return
+		}
+		setETag(w, s.Version)
+		writeJSON(w, http.StatusOK, s)
+	}
+}
+
+// maxBodyBytes はリクエストボディの上限です。
+const maxBodyBytes = 1 << 20
+
+// decodeBody は JSON ボディを v に読み込みます。失敗時は 400 を書き込み false を返します。
+func decodeBody(w http.ResponseWriter, r *http.Request, v any) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			writeError(w, http.StatusRequestEntityTooLarge, "request body too large")
+			return false
+		}
+		writeError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return false
+	}
+	return true
+}
+
+// pathID はパスの {id} を読み取ります。不正な場合は 400 を書き込み false を返します。
+func pathID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	return parseID(w, r.PathValue("id"))
+}
+
+func parseID(w http.ResponseWriter, s string) (int64, bool) {
+	id, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || id <= 0 {
+		writeError(w, http.StatusBadRequest, "invalid id")
+		return 0, false
 	}
+	return id, true
 }
 
 // 文字列を int に変換（不正時はデフォルト値）
@@ -0,0 +1,410 @@
+package apphttp
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/kawabatas/mini-web-app/internal/domain/model"
+	"github.com/kawabatas/mini-web-app/internal/infra/datastore"
+)
+
+const testAdminToken = "test-admin-token"
+
+// fixtureSingers はテスト用の初期データです（id は 1 から順に採番される）。
+var fixtureSingers = []model.Singer{
+	{Name: "Adele", Genre: "Soul", DebutYear: 2008},
+	{Name: "Beyonce", Genre: "R&B", DebutYear: 1997},
+	{Name: "Coldplay", Genre: "Rock", DebutYear: 1998},
+	{Name: "Daft Punk", Genre: "Electronic", DebutYear: 1993},
+	{Name: "Eminem", Genre: "Hip Hop", DebutYear: 1996},
+}
+
+// newTestServer は singers を投入したインメモリ DataStore で API を公開するサーバを返します。
+func newTestServer(t *testing.T, singers ...model.Singer) *httptest.Server {
+	t.Helper()
+	ctx := context.Background()
+	ds, err := datastore.OpenMemory(ctx, func(ctx context.Context, tx datastore.Repositories) error {
+		for _, s := range singers {
+			if _, err := tx.Singers().Create(ctx, s); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("OpenMemory: %v", err)
+	}
+	mux := http.NewServeMux()
+	Register(mux, ds, Options{CursorSecret: []byte("test-secret"), AdminToken: testAdminToken})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(func() {
+		srv.Close()
+		_ = ds.Close(context.Background())
+	})
+	return srv
+}
+
+type testResponse struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+// decode はレスポンスボディを v に読み込みます。
+func (r testResponse) decode(t *testing.T, v any) {
+	t.Helper()
+	if err := json.Unmarshal(r.body, v); err != nil {
+		t.Fatalf("decode %s: %v", r.body, err)
+	}
+}
+
+// do はリクエストを送信します。header は "Key: Value" 形式で指定します。
+func do(t *testing.T, srv *httptest.Server, method, path, body string, header ...string) testResponse {
+	t.Helper()
+	req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, h := range header {
+		k, v, _ := strings.Cut(h, ": ")
+		req.Header.Set(k, v)
+	}
+	res, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testResponse{status: res.StatusCode, header: res.Header, body: b}
+}
+
+func wantStatus(t *testing.T, res testResponse, want int) {
+	t.Helper()
+	if res.status != want {
+		t.Fatalf("status = %d, want %d (body: %s)", res.status, want, res.body)
+	}
+}
+
+const asAdmin = "Authorization: Bearer " + testAdminToken
+
+func TestSingerHandlers_CRUD(t *testing.T) {
+	srv := newTestServer(t)
+
+	res := do(t, srv, "POST", "/api/v1/singers", `{"name":"Adele","genre":"Soul","debut_year":2008}`)
+	wantStatus(t, res, http.StatusCreated)
+	var s model.Singer
+	res.decode(t, &s)
+	if loc := res.header.Get("Location"); loc != "/api/v1/singers/1" {
+		t.Fatalf("Location = %q", loc)
+	}
+	if etag := res.header.Get("ETag"); etag != `"1"` {
+		t.Fatalf("ETag = %q, want \"1\"", etag)
+	}
+
+	res = do(t, srv, "GET", "/api/v1/singers/1", "")
+	wantStatus(t, res, http.StatusOK)
+	res.decode(t, &s)
+	if s.Name != "Adele" || res.header.Get("ETag") != `"1"` {
+		t.Fatalf("GET = %+v, ETag %q", s, res.header.Get("ETag"))
+	}
+
+	res = do(t, srv, "PUT", "/api/v1/singers/1", `{"name":"Adele","genre":"Pop","debut_year":2008}`, `If-Match: "1"`)
+	wantStatus(t, res, http.StatusOK)
+	res.decode(t, &s)
+	if s.Genre != "Pop" || res.header.Get("ETag") != `"2"` {
+		t.Fatalf("PUT = %+v, ETag %q", s, res.header.Get("ETag"))
+	}
+
+	res = do(t, srv, "PATCH", "/api/v1/singers/1", `{"debut_year":2006}`, `If-Match: "2"`)
+	wantStatus(t, res, http.StatusOK)
+	res.decode(t, &s)
+	if s.DebutYear != 2006 || s.Genre != "Pop" || res.header.Get("ETag") != `"3"` {
+		t.Fatalf("PATCH = %+v, ETag %q", s, res.header.Get("ETag"))
+	}
+
+	wantStatus(t, do(t, srv, "DELETE", "/api/v1/singers/1", "", `If-Match: "3"`), http.StatusNoContent)
+	wantStatus(t, do(t, srv, "GET", "/api/v1/singers/1", ""), http.StatusNotFound)
+}
+
+func TestSingerHandlers_BadRequests(t *testing.T) {
+	srv := newTestServer(t, fixtureSingers...)
+
+	for name, tc := range map[string]struct {
+		method, path, body string
+		want               int
+	}{
+		"invalid id":       {"GET", "/api/v1/singers/abc", "", http.StatusBadRequest},
+		"unknown id":       {"GET", "/api/v1/singers/99", "", http.StatusNotFound},
+		"malformed json":   {"POST", "/api/v1/singers", `{"name":`, http.StatusBadRequest},
+		"unknown field":    {"POST", "/api/v1/singers", `{"name":"A","genre":"B","debut_year":2000,"x":1}`, http.StatusBadRequest},
+		"validation":       {"POST", "/api/v1/singers", `{"name":"","genre":"B","debut_year":2000}`, http.StatusUnprocessableEntity},
+		"unknown filter":   {"GET", "/api/v1/singers?color=red", "", http.StatusBadRequest},
+		"unknown sort":     {"GET", "/api/v1/singers?sort=color", "", http.StatusBadRequest},
+		"invalid cursor":   {"GET", "/api/v1/singers?cursor=bogus", "", http.StatusBadRequest},
+		"unknown audit qs": {"GET", "/api/v1/audit?sort=id", "", http.StatusBadRequest},
+		"list limit":       {"GET", "/api/v1/singers?limit=101", "", http.StatusBadRequest},
+		"search limit":     {"GET", "/api/v1/singers/search?q=pop&limit=101", "", http.StatusBadRequest},
+		"search cursor":    {"GET", "/api/v1/singers/search?q=pop&cursor=bogus", "", http.StatusBadRequest},
+		"empty search":     {"GET", "/api/v1/singers/search?q=", "", http.StatusBadRequest},
+	} {
+		t.Run(name, func(t *testing.T) {
+			res := do(t, srv, tc.method, tc.path, tc.body, asAdmin)
+			wantStatus(t, res, tc.want)
+			var e errorResp
+			res.decode(t, &e)
+			if e.Error == "" {
+				t.Fatalf("error body = %s", res.body)
+			}
+		})
+	}
+}
+
+func TestSingerHandlers_IfMatch(t *testing.T) {
+	srv := newTestServer(t, fixtureSingers...)
+	const body = `{"name":"Adele","genre":"Pop","debut_year":2008}`
+
+	for name, tc := range map[string]struct {
+		ifMatch string
+		want    int
+	}{
+		"missing":  {"", http.StatusPreconditionRequired},
+		"wildcard": {`If-Match: *`, http.StatusPreconditionRequired},
+		"stale":    {`If-Match: "2"`, http.StatusPreconditionFailed},
+		"weak":     {`If-Match: W/"1"`, http.StatusPreconditionFailed},
+		"unquoted": {`If-Match: 1`, http.StatusPreconditionFailed},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var header []string
+			if tc.ifMatch != "" {
+				header = append(header, tc.ifMatch)
+			}
+			wantStatus(t, do(t, srv, "PUT", "/api/v1/singers/1", body, header...), tc.want)
+			wantStatus(t, do(t, srv, "PATCH", "/api/v1/singers/1", `{"genre":"Pop"}`, header...), tc.want)
+			wantStatus(t, do(t, srv, "DELETE", "/api/v1/singers/1", "", header...), tc.want)
+		})
+	}
+
+	// 失敗したリクエストは何も変更しておらず、最新の ETag で更新できる
+	res := do(t, srv, "GET", "/api/v1/singers/1", "")
+	wantStatus(t, res, http.StatusOK)
+	etag := res.header.Get("ETag")
+	if etag != `"1"` {
+		t.Fatalf("ETag = %q, want \"1\"", etag)
+	}
+	wantStatus(t, do(t, srv, "PUT", "/api/v1/singers/1", body, "If-Match: "+etag), http.StatusOK)
+	// 同じ ETag での 2 回目は更新を失わないよう 412
+	wantStatus(t, do(t, srv, "PUT", "/api/v1/singers/1", body, "If-Match: "+etag), http.StatusPreconditionFailed)
+}
+
+func TestSingerHandlers_ListPaging(t *testing.T) {
+	srv := newTestServer(t, fixtureSingers...)
+	type page struct {
+		Items      []model.Singer `json:"items"`
+		NextCursor string         `json:"next_cursor"`
+		PrevCursor string         `json:"prev_cursor"`
+		Total      *int           `json:"total"`
+	}
+
+	var (
+		names []string
+		path  = "/api/v1/singers?sort=name&limit=2&include_total=true"
+	)
+	for i := 0; path != ""; i++ {
+		if i > len(fixtureSingers) {
+			t.Fatal("paging did not terminate")
+		}
+		res := do(t, srv, "GET", path, "")
+		wantStatus(t, res, http.StatusOK)
+		var p page
+		res.decode(t, &p)
+		if p.Total == nil || *p.Total != len(fixtureSingers) {
+			t.Fatalf("total = %v, want %d", p.Total, len(fixtureSingers))
+		}
+		for _, s := range p.Items {
+			names = append(names, s.Name)
+		}
+		path = nextLink(t, res.header.Get("Link"))
+		if (path == "") != (p.NextCursor == "") {
+			t.Fatalf("Link %q disagrees with next_cursor %q", res.header.Get("Link"), p.NextCursor)
+		}
+		if path != "" {
+			u, _ := url.Parse(path)
+			if q := u.Query(); q.Get("sort") != "name" || q.Get("limit") != "2" || q.Get("cursor") != p.NextCursor {
+				t.Fatalf("next link %q does not keep the query", path)
+			}
+		}
+	}
+	if got := strings.Join(names, ","); got != "Adele,Beyonce,Coldplay,Daft Punk,Eminem" {
+		t.Fatalf("names = %s", got)
+	}
+
+	// 別のソート順のカーソルは受け付けない
+	res := do(t, srv, "GET", "/api/v1/singers?sort=name&limit=2", "")
+	var p page
+	res.decode(t, &p)
+	wantStatus(t, do(t, srv, "GET", "/api/v1/singers?sort=-name&cursor="+url.QueryEscape(p.NextCursor), ""), http.StatusBadRequest)
+}
+
+func TestSingerHandlers_SearchPaging(t *testing.T) {
+	srv := newTestServer(t, fixtureSingers...)
+	type page struct {
+		Items []struct {
+			model.Singer
+			Score float64 `json:"score"`
+		} `json:"items"`
+		NextCursor string `json:"next_cursor"`
+	}
+
+	var names []string
+	path := "/api/v1/singers/search?q=" + url.QueryEscape("e") + "&limit=2"
+	for i := 0; path != ""; i++ {
+		if i > len(fixtureSingers) {
+			t.Fatal("paging did not terminate")
+		}
+		res := do(t, srv, "GET", path, "")
+		wantStatus(t, res, http.StatusOK)
+		var p page
+		res.decode(t, &p)
+		for _, s := range p.Items {
+			names = append(names, s.Name)
+		}
+		path = nextLink(t, res.header.Get("Link"))
+		if (path == "") != (p.NextCursor == "") {
+			t.Fatalf("Link %q disagrees with next_cursor %q", res.header.Get("Link"), p.NextCursor)
+		}
+	}
+	// 3 文字未満の語は関連度が同点のため id 順（"e" を含む歌手）
+	if got := strings.Join(names, ","); got != "Adele,Beyonce,Daft Punk,Eminem" {
+		t.Fatalf("names = %s", got)
+	}
+}
+
+// nextLink は Link ヘッダから rel="next" の URL を返します（無ければ空）。
+func nextLink(t *testing.T, header string) string {
+	t.Helper()
+	for _, l := range strings.Split(header, ", ") {
+		if u, ok := strings.CutSuffix(l, `>; rel="next"`); ok {
+			return strings.TrimPrefix(u, "<")
+		}
+	}
+	return ""
+}
+
+func TestSingerHandlers_SoftDeleteAndRestore(t *testing.T) {
+	srv := newTestServer(t, fixtureSingers...)
+	type page struct {
+		Items []model.Singer `json:"items"`
+	}
+	ids := func(res testResponse) map[int64]bool {
+		t.Helper()
+		wantStatus(t, res, http.StatusOK)
+		var p page
+		res.decode(t, &p)
+		out := map[int64]bool{}
+		for _, s := range p.Items {
+			out[s.ID] = s.DeletedAt != nil
+		}
+		return out
+	}
+
+	wantStatus(t, do(t, srv, "DELETE", "/api/v1/singers/2", "", `If-Match: "1"`), http.StatusNoContent)
+	wantStatus(t, do(t, srv, "GET", "/api/v1/singers/2", ""), http.StatusNotFound)
+	if _, ok := ids(do(t, srv, "GET", "/api/v1/singers", ""))[2]; ok {
+		t.Fatal("list contains the deleted singer")
+	}
+
+	// 削除済みの参照・復元は管理者のみ
+	wantStatus(t, do(t, srv, "GET", "/api/v1/singers?include_deleted=true", ""), http.StatusForbidden)
+	wantStatus(t, do(t, srv, "GET", "/api/v1/singers?include_deleted=true", "", "Authorization: Bearer wrong"), http.StatusForbidden)
+	if deleted, ok := ids(do(t, srv, "GET", "/api/v1/singers?include_deleted=true", "", asAdmin))[2]; !ok || !deleted {
+		t.Fatal("include_deleted=true does not return the deleted singer with deleted_at")
+	}
+	wantStatus(t, do(t, srv, "POST", "/api/v1/singers/2:restore", ""), http.StatusForbidden)
+	wantStatus(t, do(t, srv, "POST", "/api/v1/singers/2:undelete", "", asAdmin), http.StatusNotFound)
+
+	res := do(t, srv, "POST", "/api/v1/singers/2:restore", "", asAdmin)
+	wantStatus(t, res, http.StatusOK)
+	var s model.Singer
+	res.decode(t, &s)
+	if s.ID != 2 || s.DeletedAt != nil || res.header.Get("ETag") != `"3"` {
+		t.Fatalf("restore = %+v, ETag %q", s, res.header.Get("ETag"))
+	}
+	wantStatus(t, do(t, srv, "GET", "/api/v1/singers/2", ""), http.StatusOK)
+	// 未削除のレコードの復元は 404
+	wantStatus(t, do(t, srv, "POST", "/api/v1/singers/2:restore", "", asAdmin), http.StatusNotFound)
+}
+
+func TestAuditHandler(t *testing.T) {
+	srv := newTestServer(t, fixtureSingers...)
+
+	wantStatus(t, do(t, srv, "PATCH", "/api/v1/singers/1", `{"genre":"Pop"}`, `If-Match: "1"`), http.StatusOK)
+	wantStatus(t, do(t, srv, "DELETE", "/api/v1/singers/3", "", `If-Match: "1"`), http.StatusNoContent)
+
+	wantStatus(t, do(t, srv, "GET", "/api/v1/audit", ""), http.StatusForbidden)
+
+	res := do(t, srv, "GET", "/api/v1/audit?entity=singer", "", asAdmin)
+	wantStatus(t, res, http.StatusOK)
+	var p struct {
+		Items []model.AuditEntry `json:"items"`
+	}
+	res.decode(t, &p)
+	// 新しい順（フィクスチャの投入は監査ログに記録しない）
+	if len(p.Items) != 2 || p.Items[0].Action != "delete" || p.Items[1].Action != "update" {
+		t.Fatalf("audit = %s", res.body)
+	}
+	if p.Items[0].EntityID != 3 || p.Items[0].Actor != "anonymous" {
+		t.Fatalf("delete entry = %+v", p.Items[0])
+	}
+
+	res = do(t, srv, "GET", "/api/v1/audit?entity_id=1", "", asAdmin)
+	wantStatus(t, res, http.StatusOK)
+	res.decode(t, &p)
+	if len(p.Items) != 1 || p.Items[0].Action != "update" {
+		t.Fatalf("audit entity_id=1 = %s", res.body)
+	}
+}
+
+func TestSnapshotAcceptHandler(t *testing.T) {
+	srv := newTestServer(t, fixtureSingers...)
+
+	wantStatus(t, do(t, srv, "POST", "/api/v1/snapshots:accept", `{}`), http.StatusForbidden)
+	wantStatus(t, do(t, srv, "POST", "/api/v1/snapshots:accept", `{"quarantined":"backups/2025-10-16/140000-app.sqlite"}`, asAdmin), http.StatusUnprocessableEntity)
+	// インメモリ DB には quarantine/ が無い
+	wantStatus(t, do(t, srv, "POST", "/api/v1/snapshots:accept", `{"quarantined":"quarantine/2025-10-16/140000-app.sqlite"}`, asAdmin), http.StatusNotImplemented)
+
+	res := do(t, srv, "POST", "/api/v1/snapshots:accept", `{}`, asAdmin)
+	wantStatus(t, res, http.StatusOK)
+	var got struct {
+		Source string `json:"source"`
+		Held   any    `json:"held"`
+	}
+	res.decode(t, &got)
+	if got.Source != "local" || got.Held != nil {
+		t.Fatalf("accept = %s", res.body)
+	}
+
+	res = do(t, srv, "GET", "/api/v1/audit?entity=datastore", "", asAdmin)
+	wantStatus(t, res, http.StatusOK)
+	var p struct {
+		Items []model.AuditEntry `json:"items"`
+	}
+	res.decode(t, &p)
+	if len(p.Items) != 1 || p.Items[0].Action != "accept_snapshot" {
+		t.Fatalf("audit = %s", res.body)
+	}
+
+	res = do(t, srv, "GET", "/healthz", "")
+	wantStatus(t, res, http.StatusOK)
+	if strings.Contains(string(res.body), "snapshot_held") {
+		t.Fatalf("healthz = %s, want no snapshot_held", res.body)
+	}
+}
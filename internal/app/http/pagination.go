@@ -0,0 +1,40 @@
+package apphttp
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/kawabatas/mini-web-app/internal/app/usecase"
+)
+
+// pageRequest はキーセットページングの共通クエリ（limit / cursor / include_total）を読み取ります。
+func pageRequest(r *http.Request) usecase.PageRequest {
+	q := r.URL.Query()
+	return usecase.PageRequest{
+		Limit:        atoiDefault(q.Get("limit"), 20),
+		Cursor:       q.Get("cursor"),
+		IncludeTotal: q.Get("include_total") == "true",
+	}
+}
+
+// setLinkHeader は next / prev のページ URL を Link ヘッダ（RFC 8288）に設定します。
+// 元のクエリ（フィルタ・limit など）は維持し、cursor のみ差し替えます。
+func setLinkHeader(w http.ResponseWriter, r *http.Request, info usecase.PageInfo) {
+	var links []string
+	for _, l := range []struct{ rel, cursor string }{
+		{"next", info.NextCursor},
+		{"prev", info.PrevCursor},
+	} {
+		if l.cursor == "" {
+			continue
+		}
+		q := r.URL.Query()
+		q.Set("cursor", l.cursor)
+		u := url.URL{Path: r.URL.Path, RawQuery: q.Encode()}
+		links = append(links, "<"+u.String()+`>; rel="`+l.rel+`"`)
+	}
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+}
@@ -0,0 +1,231 @@
+package apphttp
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kawabatas/mini-web-app/internal/domain/repository"
+)
+
+// 一覧 API のクエリ言語
+//
+//	絞り込み: <field>=<value>（等価）または <field>[<op>]=<value>（op: gt / gte / lt / lte）
+//	並び替え: sort=-debut_year,name（- は降順、カンマ区切りで複数指定）
+//	論理削除済みを含める: include_deleted=true（管理者のみ。権限はハンドラで確認）
+//
+// 使用できるフィールド・演算子はホワイトリストで制限し、違反はフィールドごとの理由付きで 400 とします。
+
+// pagingParams はページング用の予約済みパラメータです（絞り込みとしては扱わない）。
+var pagingParams = map[string]bool{"limit": true, "cursor": true, "include_total": true, "sort": true}
+
+// parseFilterKey は "debut_year[gte]" を ("debut_year", "gte") に分解します（演算子省略時は "eq"）。
+func parseFilterKey(key string) (field, op string, ok bool) {
+	field, rest, found := strings.Cut(key, "[")
+	if !found {
+		return key, "eq", true
+	}
+	op, found = strings.CutSuffix(rest, "]")
+	if !found || op == "" || field == "" {
+		return "", "", false
+	}
+	return field, op, true
+}
+
+// parseSort は "-debut_year,name" を SortField の並びに変換します。
+func parseSort(raw string, allowed map[string]bool) ([]repository.SortField, string) {
+	if raw == "" {
+		return nil, ""
+	}
+	var (
+		out  []repository.SortField
+		seen = map[string]bool{}
+	)
+	for _, part := range strings.Split(raw, ",") {
+		f := repository.SortField{Field: strings.TrimSpace(part)}
+		if name, ok := strings.CutPrefix(f.Field, "-"); ok {
+			f.Field, f.Desc = name, true
+		}
+		switch {
+		case !allowed[f.Field]:
+			return nil, fmt.Sprintf("unknown sort field %q", f.Field)
+		case seen[f.Field]:
+			return nil, fmt.Sprintf("duplicate sort field %q", f.Field)
+		}
+		seen[f.Field] = true
+		out = append(out, f)
+	}
+	return out, ""
+}
+
+// parseTimeParam は RFC 3339（例: 2025-10-01T09:00:00+09:00）または日付（2025-10-01, UTC）を受け付けます。
+func parseTimeParam(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, v)
+}
+
+// singerSortFields は /api/v1/singers の sort に指定できるフィールドです。
+var singerSortFields = map[string]bool{
+	repository.SingerFieldName:      true,
+	repository.SingerFieldGenre:     true,
+	repository.SingerFieldDebutYear: true,
+	repository.SingerFieldCreatedAt: true,
+}
+
+// parseSingerListQuery は /api/v1/singers の絞り込み・並び替えを検証して変換します。
+// 不正なパラメータはキー → 理由の map で返します。
+func parseSingerListQuery(q url.Values) (repository.SingerFilter, []repository.SortField, map[string]string) {
+	var (
+		f       repository.SingerFilter
+		invalid = map[string]string{}
+	)
+	for key, vals := range q {
+		if key == "sort" || pagingParams[key] {
+			continue
+		}
+		if len(vals) != 1 {
+			invalid[key] = "must be specified once"
+			continue
+		}
+		v := vals[0]
+		field, op, ok := parseFilterKey(key)
+		if !ok {
+			invalid[key] = "malformed parameter"
+			continue
+		}
+		switch field {
+		case "include_deleted":
+			b, err := strconv.ParseBool(v)
+			if err != nil || op != "eq" {
+				invalid[key] = "must be true or false"
+				continue
+			}
+			f.IncludeDeleted = b
+		case repository.SingerFieldGenre:
+			if op != "eq" {
+				invalid[key] = "unsupported operator (allowed: eq)"
+				continue
+			}
+			f.Genre = &v
+		case repository.SingerFieldDebutYear:
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				invalid[key] = "must be an integer"
+				continue
+			}
+			var dst **int
+			switch op {
+			case "eq":
+				dst = &f.DebutYear.Eq
+			case "gt":
+				dst = &f.DebutYear.Gt
+			case "gte":
+				dst = &f.DebutYear.Gte
+			case "lt":
+				dst = &f.DebutYear.Lt
+			case "lte":
+				dst = &f.DebutYear.Lte
+			default:
+				invalid[key] = "unsupported operator (allowed: eq, gt, gte, lt, lte)"
+				continue
+			}
+			*dst = &n
+		case repository.SingerFieldCreatedAt:
+			t, err := parseTimeParam(v)
+			if err != nil {
+				invalid[key] = "must be RFC 3339 date-time or YYYY-MM-DD"
+				continue
+			}
+			var dst **time.Time
+			switch op {
+			case "gt":
+				dst = &f.CreatedAt.Gt
+			case "gte":
+				dst = &f.CreatedAt.Gte
+			case "lt":
+				dst = &f.CreatedAt.Lt
+			case "lte":
+				dst = &f.CreatedAt.Lte
+			default:
+				invalid[key] = "unsupported operator (allowed: gt, gte, lt, lte)"
+				continue
+			}
+			*dst = &t
+		default:
+			invalid[key] = "unknown parameter"
+		}
+	}
+	sort, reason := parseSort(q.Get("sort"), singerSortFields)
+	if reason != "" {
+		invalid["sort"] = reason
+	}
+	return f, sort, invalid
+}
+
+// parseAuditListQuery は /api/v1/audit の絞り込み（entity / entity_id / actor は等価、at は範囲）を検証して変換します。
+func parseAuditListQuery(q url.Values) (repository.AuditFilter, map[string]string) {
+	var (
+		f       repository.AuditFilter
+		invalid = map[string]string{}
+	)
+	for key, vals := range q {
+		if pagingParams[key] && key != "sort" { // 並び順は id 降順固定のため sort は受け付けない
+			continue
+		}
+		if len(vals) != 1 {
+			invalid[key] = "must be specified once"
+			continue
+		}
+		v := vals[0]
+		field, op, ok := parseFilterKey(key)
+		if !ok {
+			invalid[key] = "malformed parameter"
+			continue
+		}
+		switch field {
+		case "entity", "actor", "entity_id":
+			if op != "eq" {
+				invalid[key] = "unsupported operator (allowed: eq)"
+				continue
+			}
+			switch field {
+			case "entity":
+				f.Entity = &v
+			case "actor":
+				f.Actor = &v
+			default:
+				id, err := strconv.ParseInt(v, 10, 64)
+				if err != nil {
+					invalid[key] = "must be an integer"
+					continue
+				}
+				f.EntityID = &id
+			}
+		case "at":
+			t, err := parseTimeParam(v)
+			if err != nil {
+				invalid[key] = "must be RFC 3339 date-time or YYYY-MM-DD"
+				continue
+			}
+			switch op {
+			case "gt":
+				f.At.Gt = &t
+			case "gte":
+				f.At.Gte = &t
+			case "lt":
+				f.At.Lt = &t
+			case "lte":
+				f.At.Lte = &t
+			default:
+				invalid[key] = "unsupported operator (allowed: gt, gte, lt, lte)"
+			}
+		default:
+			invalid[key] = "unknown parameter"
+		}
+	}
+	return f, invalid
+}
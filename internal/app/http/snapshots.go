@@ -0,0 +1,62 @@
+package apphttp
+
+import (
+	"net/http"
+
+	"github.com/kawabatas/mini-web-app/internal/app/usecase"
+)
+
+// listSnapshots は backups/ に保管されたスナップショットを新しい順に返します（管理者のみ）。
+func listSnapshots(svc *usecase.SnapshotService, admin adminAuth) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !admin.require(w, r) {
+			return
+		}
+		result, err := svc.List(r.Context())
+		if err != nil {
+			writeUsecaseError(w, r, err, "failed to list snapshots")
+			return
+		}
+		writeJSON(w, http.StatusOK, result)
+	}
+}
+
+// restoreSnapshot は指定時刻以前で最も新しいスナップショットに復元します（管理者のみ）。
+// リクエスト: {"at": "2025-10-16T14:00:00+09:00", "dry_run": true}
+func restoreSnapshot(svc *usecase.SnapshotService, admin adminAuth) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !admin.require(w, r) {
+			return
+		}
+		var in usecase.SnapshotRestoreParams
+		if !decodeBody(w, r, &in) {
+			return
+		}
+		result, err := svc.RestoreAt(r.Context(), in)
+		if err != nil {
+			writeUsecaseError(w, r, err, "failed to restore snapshot")
+			return
+		}
+		writeJSON(w, http.StatusOK, result)
+	}
+}
+
+// acceptSnapshot は公開前の検査に失敗して止めている current への公開を受け入れます（管理者のみ）。
+// リクエスト: {} で現在の DB を公開、{"quarantined": "quarantine/2025-10-16/140000-app.sqlite"} でその内容に置き換えてから公開
+func acceptSnapshot(svc *usecase.SnapshotService, admin adminAuth) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !admin.require(w, r) {
+			return
+		}
+		var in usecase.SnapshotAcceptParams
+		if !decodeBody(w, r, &in) {
+			return
+		}
+		result, err := svc.Accept(r.Context(), in)
+		if err != nil {
+			writeUsecaseError(w, r, err, "failed to accept snapshot")
+			return
+		}
+		writeJSON(w, http.StatusOK, result)
+	}
+}
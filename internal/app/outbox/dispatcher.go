@@ -0,0 +1,186 @@
+// Package outbox は outbox テーブルに追記されたドメインイベントを購読者へ配信します。
+//
+// 配信は少なくとも 1 回（at-least-once）です。購読者がエラーを返した・配信途中でプロセスが落ちた場合は
+// 同じイベントが再配信されるため、購読者は OutboxEvent.ID などで冪等に処理してください。
+// 失敗したイベントは指数バックオフで再試行し、後続のイベントの配信は止めません（順序は保証しない）。
+// 書き込みリースを保持していない（読み取り専用の）インスタンスは配信しません。
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/kawabatas/mini-web-app/internal/domain/event"
+	"github.com/kawabatas/mini-web-app/internal/domain/model"
+	"github.com/kawabatas/mini-web-app/internal/domain/repository"
+	"github.com/kawabatas/mini-web-app/internal/infra/datastore"
+	"github.com/kawabatas/mini-web-app/internal/util/clock"
+)
+
+// Handler はイベントの購読者です。nil 以外を返すと再配信されます。
+type Handler func(ctx context.Context, e model.OutboxEvent) error
+
+const (
+	defaultInterval  = time.Second
+	defaultBatchSize = 100
+	defaultRetention = 7 * 24 * time.Hour
+	maxBackoff       = 10 * time.Minute
+	cleanupInterval  = time.Hour
+)
+
+// Dispatcher は未配信のイベントを定期的に読み出して購読者へ配信します。
+type Dispatcher struct {
+	ds datastore.DataStore
+
+	// Interval はポーリング間隔です（0 の場合は 1 秒）。
+	Interval time.Duration
+	// BatchSize は 1 回に読み出す件数です（0 の場合は 100）。
+	BatchSize int
+	// Retention は配信済みイベントを保持する期間です（0 の場合は 7 日）。
+	Retention time.Duration
+
+	mu   sync.RWMutex
+	subs map[string][]Handler
+}
+
+func NewDispatcher(ds datastore.DataStore) *Dispatcher {
+	return &Dispatcher{ds: ds, subs: map[string][]Handler{}}
+}
+
+// Subscribe は eventType（登録済みの種別）の購読者を追加します。
+func (d *Dispatcher) Subscribe(eventType string, h Handler) error {
+	if err := event.Validate(eventType); err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.subs[eventType] = append(d.subs[eventType], h)
+	return nil
+}
+
+// Run は ctx が終了するまで配信を続けます。
+func (d *Dispatcher) Run(ctx context.Context) {
+	interval := d.Interval
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var lastCleanup time.Time
+	for {
+		for d.writable(ctx) {
+			n, err := d.DispatchOnce(ctx)
+			if err != nil {
+				if errors.Is(err, repository.ErrReadOnly) {
+					// バッチの途中で書き込みリースを失った（配信済みのイベントは新しい保持者が再配信する）
+					slog.WarnContext(ctx, "outbox: dispatch stopped: datastore became read-only")
+				} else if ctx.Err() == nil {
+					slog.ErrorContext(ctx, "outbox: dispatch failed", slog.Any("error", err))
+				}
+				break
+			}
+			if n < d.batchSize() { // 残りが無ければ次のティックまで待つ
+				break
+			}
+		}
+		if d.writable(ctx) && clock.Now().Sub(lastCleanup) >= cleanupInterval {
+			d.cleanup(ctx)
+			lastCleanup = clock.Now()
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// writable はデータストアが書き込みを受け付けているかを返します（配信状態を記録できない間は配信しない）。
+func (d *Dispatcher) writable(ctx context.Context) bool {
+	g, ok := d.ds.(datastore.WriteGate)
+	return !ok || g.Writable(ctx)
+}
+
+// DispatchOnce は配信可能なイベントを 1 バッチ分配信し、処理した件数を返します。
+func (d *Dispatcher) DispatchOnce(ctx context.Context) (int, error) {
+	repo := d.ds.Outbox()
+	events, err := repo.Pending(ctx, clock.Now(), d.batchSize())
+	if err != nil {
+		return 0, err
+	}
+	for _, e := range events {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		if derr := d.deliver(ctx, e); derr != nil {
+			next := clock.Now().Add(backoff(e.Attempts))
+			slog.WarnContext(ctx, "outbox: delivery failed",
+				slog.Int64("id", e.ID), slog.String("type", e.Type), slog.Int("attempts", e.Attempts+1),
+				slog.Time("next_attempt_at", next), slog.Any("error", derr))
+			if err := repo.MarkFailed(ctx, e.ID, derr.Error(), next); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		if err := repo.MarkDone(ctx, e.ID, clock.Now()); err != nil {
+			return 0, err
+		}
+	}
+	return len(events), nil
+}
+
+// deliver はイベントを全ての購読者に渡します。1 つでも失敗すればイベント全体を再配信します。
+func (d *Dispatcher) deliver(ctx context.Context, e model.OutboxEvent) (err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("subscriber panic: %v", rec)
+		}
+	}()
+	d.mu.RLock()
+	handlers := d.subs[e.Type]
+	d.mu.RUnlock()
+	for _, h := range handlers {
+		if err := h(ctx, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *Dispatcher) cleanup(ctx context.Context) {
+	retention := d.Retention
+	if retention <= 0 {
+		retention = defaultRetention
+	}
+	n, err := d.ds.Outbox().DeleteDone(ctx, clock.Now().Add(-retention))
+	if err != nil {
+		slog.ErrorContext(ctx, "outbox: cleanup failed", slog.Any("error", err))
+		return
+	}
+	if n > 0 {
+		slog.InfoContext(ctx, "outbox: deleted delivered events", slog.Int64("rows", n))
+	}
+}
+
+func (d *Dispatcher) batchSize() int {
+	if d.BatchSize <= 0 {
+		return defaultBatchSize
+	}
+	return d.BatchSize
+}
+
+// backoff は attempts 回失敗済みのイベントの再試行までの待ち時間です（1s, 2s, 4s, ... 最大 10 分）。
+func backoff(attempts int) time.Duration {
+	d := time.Second << min(attempts, 10)
+	return min(d, maxBackoff)
+}
+
+// LogHandler はイベントをログに出力する購読者です（動作確認用）。
+func LogHandler(ctx context.Context, e model.OutboxEvent) error {
+	slog.InfoContext(ctx, "outbox: event", slog.Int64("id", e.ID), slog.String("type", e.Type), slog.String("payload", string(e.Payload)))
+	return nil
+}
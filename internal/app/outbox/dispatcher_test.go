@@ -0,0 +1,355 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kawabatas/mini-web-app/internal/domain/event"
+	"github.com/kawabatas/mini-web-app/internal/domain/model"
+	"github.com/kawabatas/mini-web-app/internal/domain/repository"
+	"github.com/kawabatas/mini-web-app/internal/infra/datastore"
+	"github.com/kawabatas/mini-web-app/internal/util/clock"
+)
+
+// testClock は Advance でのみ進む時計です。
+type testClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *testClock) Advance(d time.Duration) { c.Set(c.Now().Add(d)) }
+
+func (c *testClock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = t
+}
+
+// setTestClock は clock.Default をテストの間 testClock に置き換えます。
+func setTestClock(t *testing.T) *testClock {
+	t.Helper()
+	c := &testClock{now: time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)}
+	t.Cleanup(clock.Set(c))
+	return c
+}
+
+// openTestStore は n 件の singer.created イベントを追記したインメモリ DataStore を返します（id は 1 から順に採番される）。
+func openTestStore(t *testing.T, n int) datastore.DataStore {
+	t.Helper()
+	ctx := context.Background()
+	ds, err := datastore.OpenMemory(ctx, func(ctx context.Context, tx datastore.Repositories) error {
+		for i := 0; i < n; i++ {
+			if err := tx.Outbox().Append(ctx, model.OutboxEvent{Type: event.SingerCreated, Payload: []byte(`{}`), CreatedAt: clock.Now()}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("OpenMemory: %v", err)
+	}
+	t.Cleanup(func() { _ = ds.Close(context.Background()) })
+	return ds
+}
+
+// pendingIDs は現在配信可能なイベントの id を返します。
+func pendingIDs(t *testing.T, ds datastore.DataStore) []int64 {
+	t.Helper()
+	events, err := ds.Outbox().Pending(context.Background(), clock.Now(), 100)
+	if err != nil {
+		t.Fatalf("Pending: %v", err)
+	}
+	var ids []int64
+	for _, e := range events {
+		ids = append(ids, e.ID)
+	}
+	return ids
+}
+
+// recorder は受け取ったイベントの id と試行回数を記録する購読者です。fail が true を返したイベントは失敗させます。
+type recorder struct {
+	mu       sync.Mutex
+	ids      []int64
+	attempts []int
+	fail     func(e model.OutboxEvent) bool
+}
+
+func (r *recorder) handle(ctx context.Context, e model.OutboxEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ids = append(r.ids, e.ID)
+	r.attempts = append(r.attempts, e.Attempts)
+	if r.fail != nil && r.fail(e) {
+		return errors.New("boom")
+	}
+	return nil
+}
+
+func (r *recorder) delivered() []int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.ids)
+}
+
+func newTestDispatcher(t *testing.T, ds datastore.DataStore, handlers ...Handler) *Dispatcher {
+	t.Helper()
+	d := NewDispatcher(ds)
+	for _, h := range handlers {
+		if err := d.Subscribe(event.SingerCreated, h); err != nil {
+			t.Fatalf("Subscribe: %v", err)
+		}
+	}
+	return d
+}
+
+func dispatchOnce(t *testing.T, d *Dispatcher, want int) {
+	t.Helper()
+	n, err := d.DispatchOnce(context.Background())
+	if err != nil || n != want {
+		t.Fatalf("DispatchOnce = %d, %v; want %d", n, err, want)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for _, tc := range []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, time.Second},
+		{1, 2 * time.Second},
+		{3, 8 * time.Second},
+		{9, 512 * time.Second},
+		{10, maxBackoff},
+		{100, maxBackoff},
+	} {
+		if got := backoff(tc.attempts); got != tc.want {
+			t.Errorf("backoff(%d) = %s, want %s", tc.attempts, got, tc.want)
+		}
+	}
+}
+
+func TestDispatchOnce_RetriesWithBackoff(t *testing.T) {
+	c := setTestClock(t)
+	ds := openTestStore(t, 2)
+	// id 1 は 2 回失敗してから成功する
+	rec := &recorder{fail: func(e model.OutboxEvent) bool { return e.ID == 1 && e.Attempts < 2 }}
+	d := newTestDispatcher(t, ds, rec.handle)
+
+	// 失敗したイベントだけが 1 秒後まで保留され、後続のイベントは配信される
+	dispatchOnce(t, d, 2)
+	if got := pendingIDs(t, ds); len(got) != 0 {
+		t.Fatalf("pending right after a failure = %v, want none", got)
+	}
+	c.Advance(time.Second)
+	dispatchOnce(t, d, 1)
+
+	// 2 回目の失敗の後は 2 秒待つ
+	c.Advance(time.Second)
+	dispatchOnce(t, d, 0)
+	c.Advance(time.Second)
+	dispatchOnce(t, d, 1)
+	dispatchOnce(t, d, 0)
+
+	if !slices.Equal(rec.ids, []int64{1, 2, 1, 1}) || !slices.Equal(rec.attempts, []int{0, 0, 1, 2}) {
+		t.Fatalf("deliveries = %v (attempts %v)", rec.ids, rec.attempts)
+	}
+	// 配信済みのイベントは再配信しない
+	c.Advance(time.Hour)
+	if got := pendingIDs(t, ds); len(got) != 0 {
+		t.Fatalf("pending after delivery = %v, want none", got)
+	}
+}
+
+func TestDispatchOnce_FailingSubscriber(t *testing.T) {
+	for name, failing := range map[string]Handler{
+		"error": func(ctx context.Context, e model.OutboxEvent) error {
+			if e.ID == 1 {
+				return errors.New("boom")
+			}
+			return nil
+		},
+		"panic": func(ctx context.Context, e model.OutboxEvent) error {
+			if e.ID == 1 {
+				panic("boom")
+			}
+			return nil
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c := setTestClock(t)
+			ds := openTestStore(t, 2)
+			// 1 つの購読者の失敗で、他の購読者にも再配信する
+			rec := &recorder{}
+			d := newTestDispatcher(t, ds, rec.handle, failing)
+			dispatchOnce(t, d, 2)
+			c.Advance(time.Second)
+			if got := pendingIDs(t, ds); !slices.Equal(got, []int64{1}) {
+				t.Fatalf("pending = %v, want [1]", got)
+			}
+			dispatchOnce(t, d, 1)
+			if got := rec.delivered(); !slices.Equal(got, []int64{1, 2, 1}) {
+				t.Fatalf("deliveries = %v, want [1 2 1]", got)
+			}
+		})
+	}
+}
+
+// readOnlyStore は readOnly になった後の配信状態の記録を repository.ErrReadOnly で失敗させる DataStore です
+// （バッチの途中で書き込みリースを失った状態）。
+type readOnlyStore struct {
+	datastore.DataStore
+	readOnly atomic.Bool
+}
+
+func (s *readOnlyStore) Outbox() repository.OutboxRepository {
+	return readOnlyOutbox{s.DataStore.Outbox(), &s.readOnly}
+}
+
+func (s *readOnlyStore) Writable(ctx context.Context) bool { return !s.readOnly.Load() }
+
+type readOnlyOutbox struct {
+	repository.OutboxRepository
+	readOnly *atomic.Bool
+}
+
+func (r readOnlyOutbox) MarkDone(ctx context.Context, id int64, at time.Time) error {
+	if r.readOnly.Load() {
+		return repository.ErrReadOnly
+	}
+	return r.OutboxRepository.MarkDone(ctx, id, at)
+}
+
+func (r readOnlyOutbox) MarkFailed(ctx context.Context, id int64, errMsg string, next time.Time) error {
+	if r.readOnly.Load() {
+		return repository.ErrReadOnly
+	}
+	return r.OutboxRepository.MarkFailed(ctx, id, errMsg, next)
+}
+
+func TestDispatchOnce_StopsWhenReadOnly(t *testing.T) {
+	setTestClock(t)
+	ds := &readOnlyStore{DataStore: openTestStore(t, 3)}
+	rec := &recorder{}
+	d := newTestDispatcher(t, ds, rec.handle, func(ctx context.Context, e model.OutboxEvent) error {
+		if e.ID == 2 {
+			ds.readOnly.Store(true)
+		}
+		return nil
+	})
+
+	// id 2 の配信を記録できず、以降のイベントは配信しない
+	if _, err := d.DispatchOnce(context.Background()); !errors.Is(err, repository.ErrReadOnly) {
+		t.Fatalf("DispatchOnce = %v, want ErrReadOnly", err)
+	}
+	if got := rec.delivered(); !slices.Equal(got, []int64{1, 2}) {
+		t.Fatalf("deliveries = %v, want [1 2]", got)
+	}
+	// 記録できなかったイベントは未配信のまま（新しい保持者が再配信する）
+	if got := pendingIDs(t, ds); !slices.Equal(got, []int64{2, 3}) {
+		t.Fatalf("pending = %v, want [2 3]", got)
+	}
+}
+
+func TestRun_DispatchesOnlyWhileWritable(t *testing.T) {
+	ds := &readOnlyStore{DataStore: openTestStore(t, 2)}
+	ds.readOnly.Store(true)
+	rec := &recorder{}
+	d := newTestDispatcher(t, ds, rec.handle)
+	d.Interval = 10 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		d.Run(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	time.Sleep(5 * d.Interval)
+	if got := rec.delivered(); len(got) != 0 {
+		t.Fatalf("delivered while read-only: %v", got)
+	}
+	ds.readOnly.Store(false)
+	deadline := time.Now().Add(5 * time.Second)
+	for len(rec.delivered()) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("deliveries = %v, want [1 2]", rec.delivered())
+		}
+		time.Sleep(d.Interval)
+	}
+}
+
+func TestCleanup_Retention(t *testing.T) {
+	ctx := context.Background()
+	for name, tc := range map[string]struct {
+		retention time.Duration
+		// doneAgo は各イベントを配信済みにしてからクリーンアップまでの経過時間です（0 は未配信）
+		doneAgo     []time.Duration
+		wantLeft    int64 // 削除されずに残る配信済みのイベント数
+		wantPending int
+	}{
+		"default keeps a week": {
+			doneAgo:  []time.Duration{8 * 24 * time.Hour, 6 * 24 * time.Hour},
+			wantLeft: 1,
+		},
+		"custom retention": {
+			retention: time.Hour,
+			doneAgo:   []time.Duration{2 * time.Hour, time.Hour + time.Second, 30 * time.Minute},
+			wantLeft:  1,
+		},
+		"pending events are kept": {
+			retention:   time.Hour,
+			doneAgo:     []time.Duration{0, 2 * time.Hour},
+			wantPending: 1,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c := setTestClock(t)
+			ds := openTestStore(t, len(tc.doneAgo))
+			// 古く配信済みにしたものから順に時計を進める
+			end := c.Now().Add(30 * 24 * time.Hour)
+			for i, ago := range tc.doneAgo {
+				if ago == 0 {
+					continue
+				}
+				c.Set(end.Add(-ago))
+				if err := ds.Outbox().MarkDone(ctx, int64(i+1), clock.Now()); err != nil {
+					t.Fatal(err)
+				}
+			}
+			c.Set(end)
+			d := NewDispatcher(ds)
+			d.Retention = tc.retention
+			d.cleanup(ctx)
+
+			// 残っている配信済みのイベントを数える
+			left, err := ds.Outbox().DeleteDone(ctx, end.Add(time.Hour))
+			if err != nil || left != tc.wantLeft {
+				t.Fatalf("delivered events left = %d, %v; want %d", left, err, tc.wantLeft)
+			}
+			if got := pendingIDs(t, ds); len(got) != tc.wantPending {
+				t.Fatalf("pending = %v, want %d events", got, tc.wantPending)
+			}
+		})
+	}
+}
+
+func TestSubscribe_UnknownEventType(t *testing.T) {
+	d := NewDispatcher(openTestStore(t, 0))
+	if err := d.Subscribe("singer.renamed", LogHandler); err == nil {
+		t.Fatal("Subscribe succeeded with an unknown event type")
+	}
+}
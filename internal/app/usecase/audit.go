@@ -0,0 +1,149 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/kawabatas/mini-web-app/internal/domain/model"
+	"github.com/kawabatas/mini-web-app/internal/domain/repository"
+	"github.com/kawabatas/mini-web-app/internal/httpx"
+	"github.com/kawabatas/mini-web-app/internal/infra/datastore"
+	"github.com/kawabatas/mini-web-app/internal/util/clock"
+)
+
+// 監査ログの対象エンティティ・操作
+const (
+	auditEntitySinger = "singer"
+
+	auditActionCreate  = "create"
+	auditActionUpdate  = "update"
+	auditActionDelete  = "delete"
+	auditActionRestore = "restore"
+	auditActionPurge   = "purge"
+)
+
+// anonymousActor は操作者が Context に無い場合の記録値です。
+const anonymousActor = "anonymous"
+
+// recordAudit は変更の監査ログを tx 内で追記します（before / after は nil 可）。
+// 操作者・リクエスト ID は Context（httpx.WithActor / httpx.WithRequestID）から取得します。
+func recordAudit(ctx context.Context, tx datastore.Repositories, entity string, id int64, action string, before, after any) error {
+	e := model.AuditEntry{
+		At:        clock.Now(),
+		Actor:     httpx.ActorFromCtx(ctx),
+		RequestID: httpx.RequestIDFromCtx(ctx),
+		Entity:    entity,
+		EntityID:  id,
+		Action:    action,
+	}
+	if e.Actor == "" {
+		e.Actor = anonymousActor
+	}
+	var err error
+	if e.Before, err = marshalAudit(before); err != nil {
+		return err
+	}
+	if e.After, err = marshalAudit(after); err != nil {
+		return err
+	}
+	if e.Diff, err = auditDiff(e.Before, e.After); err != nil {
+		return err
+	}
+	if _, err := tx.Audit().Append(ctx, e); err != nil {
+		return fmt.Errorf("append audit log: %w", err)
+	}
+	return nil
+}
+
+func marshalAudit(v any) (json.RawMessage, error) {
+	if v == nil {
+		return nil, nil
+	}
+	if rv := reflect.ValueOf(v); (rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Map) && rv.IsNil() {
+		return nil, nil
+	}
+	return json.Marshal(v)
+}
+
+// auditDiff は before / after の JSON オブジェクトを比較し、変更されたフィールドを
+// {"<field>": {"from": <before>, "to": <after>}} の形で返します（変更が無ければ nil）。
+func auditDiff(before, after json.RawMessage) (json.RawMessage, error) {
+	type change struct {
+		From any `json:"from"`
+		To   any `json:"to"`
+	}
+	b, a := map[string]any{}, map[string]any{}
+	if len(before) > 0 {
+		if err := json.Unmarshal(before, &b); err != nil {
+			return nil, err
+		}
+	}
+	if len(after) > 0 {
+		if err := json.Unmarshal(after, &a); err != nil {
+			return nil, err
+		}
+	}
+	keys := make([]string, 0, len(a)+len(b))
+	for k := range b {
+		keys = append(keys, k)
+	}
+	for k := range a {
+		if _, ok := b[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	diff := map[string]change{}
+	for _, k := range keys {
+		if !reflect.DeepEqual(b[k], a[k]) {
+			diff[k] = change{From: b[k], To: a[k]}
+		}
+	}
+	if len(diff) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(diff)
+}
+
+// AuditListParams は /api/v1/audit のリクエストのパラメータです。
+type AuditListParams struct {
+	PageRequest
+	Filter repository.AuditFilter
+}
+
+type AuditListResult struct {
+	Items []model.AuditEntry `json:"items"`
+	PageInfo
+}
+
+type AuditService struct {
+	ds     datastore.DataStore
+	cursor *CursorCodec
+}
+
+func NewAuditService(ds datastore.DataStore, cursor *CursorCodec) *AuditService {
+	return &AuditService{ds: ds, cursor: cursor}
+}
+
+// List は監査ログを新しい順にキーセット方式で返します。
+func (s *AuditService) List(ctx context.Context, p AuditListParams) (AuditListResult, error) {
+	repo := s.ds.Audit()
+	items, info, err := fetchPage(s.cursor, p.PageRequest, pageQuery[model.AuditEntry]{
+		sort: "audit:-id",
+		fetch: func(after *repository.Keyset, limit int) ([]model.AuditEntry, error) {
+			return repo.List(ctx, repository.AuditListQuery{Filter: p.Filter, After: after, Limit: limit})
+		},
+		keyOf: func(e model.AuditEntry) repository.Keyset { return repository.Keyset{ID: e.ID} },
+		count: func() (int, error) { return repo.Count(ctx, p.Filter) },
+	})
+	if err != nil {
+		return AuditListResult{}, err
+	}
+	if items == nil {
+		items = []model.AuditEntry{}
+	}
+	return AuditListResult{Items: items, PageInfo: info}, nil
+}
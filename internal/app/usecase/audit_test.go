@@ -0,0 +1,197 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/kawabatas/mini-web-app/internal/domain/model"
+	"github.com/kawabatas/mini-web-app/internal/domain/repository"
+	"github.com/kawabatas/mini-web-app/internal/httpx"
+)
+
+// auditOf は entity_id の監査ログを古い順に返します。
+func auditOf(t *testing.T, svc *AuditService, id int64) []model.AuditEntry {
+	t.Helper()
+	res, err := svc.List(context.Background(), AuditListParams{
+		PageRequest: PageRequest{Limit: maxPageLimit},
+		Filter:      repository.AuditFilter{EntityID: &id},
+	})
+	if err != nil {
+		t.Fatalf("AuditService.List: %v", err)
+	}
+	out := res.Items
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return out
+}
+
+// diffOf は監査ログの diff を {"field": {"from", "to"}} として読み取ります。
+func diffOf(t *testing.T, e model.AuditEntry) map[string]map[string]any {
+	t.Helper()
+	var d map[string]map[string]any
+	if len(e.Diff) == 0 {
+		return d
+	}
+	if err := json.Unmarshal(e.Diff, &d); err != nil {
+		t.Fatalf("unmarshal diff %s: %v", e.Diff, err)
+	}
+	return d
+}
+
+func TestAudit_RecordsEachChange(t *testing.T) {
+	svc, ds := newTestSingerService(t)
+	audit := NewAuditService(ds, NewCursorCodec([]byte("test-secret")))
+	ctx := httpx.WithRequestID(httpx.WithActor(context.Background(), "alice@example.com"), "req-1")
+
+	s, err := svc.Create(ctx, SingerInput{Name: "Adele", Genre: "Soul", DebutYear: 2008})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err := svc.Update(ctx, s.ID, 1, SingerInput{Name: "Adele", Genre: "Pop", DebutYear: 2008}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if err := svc.Delete(ctx, s.ID, 2); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := svc.Restore(ctx, s.ID); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+
+	entries := auditOf(t, audit, s.ID)
+	var actions []string
+	for _, e := range entries {
+		actions = append(actions, e.Action)
+		if e.Actor != "alice@example.com" || e.RequestID != "req-1" || e.Entity != auditEntitySinger {
+			t.Errorf("%s: actor=%q request_id=%q entity=%q", e.Action, e.Actor, e.RequestID, e.Entity)
+		}
+	}
+	want := []string{auditActionCreate, auditActionUpdate, auditActionDelete, auditActionRestore}
+	if len(actions) != len(want) {
+		t.Fatalf("actions = %v, want %v", actions, want)
+	}
+	for i := range want {
+		if actions[i] != want[i] {
+			t.Fatalf("actions = %v, want %v", actions, want)
+		}
+	}
+
+	create, update, del := entries[0], entries[1], entries[2]
+	if create.Before != nil || create.After == nil {
+		t.Errorf("create: before=%s after=%s", create.Before, create.After)
+	}
+	if del.Before == nil || del.After != nil {
+		t.Errorf("delete: before=%s after=%s", del.Before, del.After)
+	}
+	d := diffOf(t, update)
+	if g := d["genre"]; g["from"] != "Soul" || g["to"] != "Pop" {
+		t.Errorf("update diff genre = %v, want Soul -> Pop", g)
+	}
+	if _, ok := d["name"]; ok {
+		t.Errorf("update diff contains unchanged name: %s", update.Diff)
+	}
+}
+
+func TestAudit_AnonymousActorAndPurge(t *testing.T) {
+	ctx := context.Background()
+	svc, ds := newTestSingerService(t, fixtureSingers...)
+	audit := NewAuditService(ds, NewCursorCodec([]byte("test-secret")))
+
+	if err := svc.Delete(ctx, 1, 1); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if n, err := svc.PurgeDeleted(ctx, -time.Hour); err != nil || n != 1 {
+		t.Fatalf("PurgeDeleted = %d, %v; want 1", n, err)
+	}
+	entity := auditEntitySinger
+	res, err := audit.List(ctx, AuditListParams{Filter: repository.AuditFilter{Entity: &entity}})
+	if err != nil {
+		t.Fatalf("AuditService.List: %v", err)
+	}
+	// 新しい順: purge → delete
+	if len(res.Items) != 2 || res.Items[0].Action != auditActionPurge || res.Items[1].Action != auditActionDelete {
+		t.Fatalf("audit = %+v, want purge then delete", res.Items)
+	}
+	for _, e := range res.Items {
+		if e.Actor != anonymousActor {
+			t.Errorf("%s: actor = %q, want %q", e.Action, e.Actor, anonymousActor)
+		}
+	}
+	if purge := res.Items[0]; purge.EntityID != 0 || purge.After == nil {
+		t.Errorf("purge entry = %+v, want entity_id 0 with a summary", purge)
+	}
+}
+
+func TestAuditService_ListPaging(t *testing.T) {
+	ctx := context.Background()
+	svc, ds := newTestSingerService(t)
+	audit := NewAuditService(ds, NewCursorCodec([]byte("test-secret")))
+	for _, s := range fixtureSingers {
+		if _, err := svc.Create(ctx, SingerInput{Name: s.Name, Genre: s.Genre, DebutYear: s.DebutYear}); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+
+	var ids []int64
+	cursor := ""
+	for range len(fixtureSingers) {
+		res, err := audit.List(ctx, AuditListParams{PageRequest: PageRequest{Limit: 2, Cursor: cursor}})
+		if err != nil {
+			t.Fatalf("List(cursor=%q): %v", cursor, err)
+		}
+		for _, e := range res.Items {
+			ids = append(ids, e.EntityID)
+		}
+		if cursor = res.NextCursor; cursor == "" {
+			break
+		}
+	}
+	// 新しい順に重複・欠落なく全件を辿れる
+	want := []int64{5, 4, 3, 2, 1}
+	if len(ids) != len(want) {
+		t.Fatalf("entity ids = %v, want %v", ids, want)
+	}
+	for i := range want {
+		if ids[i] != want[i] {
+			t.Fatalf("entity ids = %v, want %v", ids, want)
+		}
+	}
+}
+
+func TestAudit_PatchRecordsChangedFields(t *testing.T) {
+	ctx := context.Background()
+	svc, ds := newTestSingerService(t, fixtureSingers...)
+	audit := NewAuditService(ds, NewCursorCodec([]byte("test-secret")))
+
+	name := "Adele Adkins"
+	if _, err := svc.Patch(ctx, 1, 1, SingerPatch{Name: &name}); err != nil {
+		t.Fatalf("Patch: %v", err)
+	}
+	entries := auditOf(t, audit, 1)
+	if len(entries) != 1 || entries[0].Action != auditActionUpdate {
+		t.Fatalf("audit = %+v, want one update", entries)
+	}
+	e := entries[0]
+	var before, after model.Singer
+	if err := json.Unmarshal(e.Before, &before); err != nil {
+		t.Fatalf("unmarshal before: %v", err)
+	}
+	if err := json.Unmarshal(e.After, &after); err != nil {
+		t.Fatalf("unmarshal after: %v", err)
+	}
+	if before.Name != "Adele" || before.Version != 1 || after.Name != name || after.Version != 2 {
+		t.Fatalf("before = %+v, after = %+v", before, after)
+	}
+	d := diffOf(t, e)
+	if n := d["name"]; n["from"] != "Adele" || n["to"] != name {
+		t.Fatalf("diff name = %v, want Adele -> %s (diff: %s)", n, name, e.Diff)
+	}
+	if v := d["version"]; v["from"] != float64(1) || v["to"] != float64(2) {
+		t.Fatalf("diff version = %v, want 1 -> 2", v)
+	}
+	if _, ok := d["genre"]; ok {
+		t.Fatalf("diff contains unchanged genre: %s", e.Diff)
+	}
+}
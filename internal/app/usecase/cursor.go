@@ -0,0 +1,181 @@
+package usecase
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/kawabatas/mini-web-app/internal/domain/repository"
+)
+
+// ErrInvalidCursor はカーソルトークンが改ざん・破損している、または別のソート順のものである場合のエラーです。
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// CursorCodec はキーセットページングのカーソルを、署名付きの不透明なトークンに変換します。
+//
+// トークン形式: base64url(JSON) + "." + base64url(HMAC-SHA256(JSON))
+// クライアントは中身を解釈せず、next_cursor / prev_cursor をそのまま送り返す前提です。
+type CursorCodec struct {
+	key []byte
+}
+
+// NewCursorCodec は secret で署名する CursorCodec を返します。
+// secret が空の場合はランダムな鍵を生成します（再起動でそれ以前のカーソルは無効になります）。
+func NewCursorCodec(secret []byte) *CursorCodec {
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		_, _ = rand.Read(secret)
+	}
+	return &CursorCodec{key: secret}
+}
+
+// cursorPayload はトークンに埋め込む内容です。
+type cursorPayload struct {
+	Sort   string   `json:"s"`           // ソート順の識別子（ソート指定が変わったカーソルを拒否する）
+	Values []string `json:"v,omitempty"` // ソートキーの値
+	ID     int64    `json:"i"`
+	Prev   bool     `json:"p,omitempty"`
+}
+
+func (c *CursorCodec) encode(sort string, k repository.Keyset) string {
+	body, _ := json.Marshal(cursorPayload{Sort: sort, Values: k.Values, ID: k.ID, Prev: k.Backward})
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString(body) + "." + enc.EncodeToString(c.sign(body))
+}
+
+func (c *CursorCodec) decode(sort, token string) (*repository.Keyset, error) {
+	enc := base64.RawURLEncoding
+	b64, sig64, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+	body, err := enc.DecodeString(b64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	sig, err := enc.DecodeString(sig64)
+	if err != nil || !hmac.Equal(sig, c.sign(body)) {
+		return nil, ErrInvalidCursor
+	}
+	var p cursorPayload
+	if err := json.Unmarshal(body, &p); err != nil || p.Sort != sort {
+		return nil, ErrInvalidCursor
+	}
+	return &repository.Keyset{Values: p.Values, ID: p.ID, Backward: p.Prev}, nil
+}
+
+func (c *CursorCodec) sign(body []byte) []byte {
+	m := hmac.New(sha256.New, c.key)
+	m.Write(body)
+	return m.Sum(nil)
+}
+
+// PageRequest はキーセットページングの共通パラメータです。
+type PageRequest struct {
+	Limit        int
+	Cursor       string // 前回レスポンスの next_cursor / prev_cursor
+	IncludeTotal bool
+}
+
+// PageInfo はキーセットページングの共通レスポンスです。
+type PageInfo struct {
+	NextCursor string `json:"next_cursor,omitempty"`
+	PrevCursor string `json:"prev_cursor,omitempty"`
+	Total      *int   `json:"total,omitempty"` // IncludeTotal 指定時のみ
+}
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+// sortSignature はソート指定をカーソルに埋め込む識別子（例: "-debut_year,name"）に変換します。
+func sortSignature(sort []repository.SortField) string {
+	if len(sort) == 0 {
+		return "id"
+	}
+	parts := make([]string, 0, len(sort))
+	for _, f := range sort {
+		if f.Desc {
+			parts = append(parts, "-"+f.Field)
+		} else {
+			parts = append(parts, f.Field)
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// pageQuery はエンティティごとのページ取得処理です。
+type pageQuery[T any] struct {
+	// sort はソート順の識別子です（カーソルに埋め込み、異なるソート順のカーソルを拒否する）。
+	sort string
+	// fetch は after（nil なら先頭）から limit 件を走査順で返します（Backward なら逆順）。
+	fetch func(after *repository.Keyset, limit int) ([]T, error)
+	// keyOf は行からキーセットの基点を作ります（Backward は設定不要）。
+	keyOf func(T) repository.Keyset
+	// count は全件数を返します（IncludeTotal 指定時のみ呼ばれる）。
+	count func() (int, error)
+}
+
+// fetchPage はキーセットページングの共通処理です。
+// limit+1 件を取得して次ページの有無を判定し、next / prev のカーソルを組み立てます。
+// limit は 0（未指定）なら既定値、範囲外（負数・上限超過）は検証エラーとします。
+func fetchPage[T any](codec *CursorCodec, req PageRequest, q pageQuery[T]) ([]T, PageInfo, error) {
+	limit := defaultPageLimit
+	switch {
+	case req.Limit < 0 || req.Limit > maxPageLimit:
+		return nil, PageInfo{}, &ValidationError{Fields: map[string]string{"limit": fmt.Sprintf("must be between 1 and %d", maxPageLimit)}}
+	case req.Limit > 0:
+		limit = req.Limit
+	}
+	var after *repository.Keyset
+	if req.Cursor != "" {
+		k, err := codec.decode(q.sort, req.Cursor)
+		if err != nil {
+			return nil, PageInfo{}, &ValidationError{Fields: map[string]string{"cursor": "invalid or expired cursor"}}
+		}
+		after = k
+	}
+
+	items, err := q.fetch(after, limit+1) // 次ページ確認のため +1 で取得
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
+	hasMore := len(items) > limit
+	if hasMore {
+		items = items[:limit]
+	}
+	backward := after != nil && after.Backward
+	if backward {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+	}
+
+	var info PageInfo
+	if len(items) > 0 {
+		first, last := q.keyOf(items[0]), q.keyOf(items[len(items)-1])
+		first.Backward = true
+		// 前方向: 続きがあれば next。カーソル指定時は戻れるので prev
+		// 後方向: 続き（さらに前）があれば prev。来た方向には常に next
+		if (!backward && hasMore) || backward {
+			info.NextCursor = codec.encode(q.sort, last)
+		}
+		if (backward && hasMore) || (!backward && after != nil) {
+			info.PrevCursor = codec.encode(q.sort, first)
+		}
+	}
+	if req.IncludeTotal {
+		n, err := q.count()
+		if err != nil {
+			return nil, PageInfo{}, err
+		}
+		info.Total = &n
+	}
+	return items, info, nil
+}
@@ -0,0 +1,125 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/kawabatas/mini-web-app/internal/domain/model"
+	"github.com/kawabatas/mini-web-app/internal/domain/repository"
+)
+
+func singerNames(items []model.Singer) []string {
+	out := make([]string, 0, len(items))
+	for _, s := range items {
+		out = append(out, s.Name)
+	}
+	return out
+}
+
+func TestSingerService_ListPaging(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := newTestSingerService(t, fixtureSingers...)
+	sort := []repository.SortField{{Field: repository.SingerFieldDebutYear, Desc: true}}
+	list := func(limit int, cursor string) SingerListResult {
+		t.Helper()
+		res, err := svc.List(ctx, SingerListParams{PageRequest: PageRequest{Limit: limit, Cursor: cursor}, Sort: sort})
+		if err != nil {
+			t.Fatalf("List(cursor=%q): %v", cursor, err)
+		}
+		return res
+	}
+
+	// 先頭ページ: 前ページは無い
+	p1 := list(2, "")
+	if got := singerNames(p1.Items); !slices.Equal(got, []string{"Adele", "Coldplay"}) {
+		t.Fatalf("page 1 = %v", got)
+	}
+	if p1.NextCursor == "" || p1.PrevCursor != "" {
+		t.Fatalf("page 1 cursors: next=%q prev=%q", p1.NextCursor, p1.PrevCursor)
+	}
+
+	p2 := list(2, p1.NextCursor)
+	if got := singerNames(p2.Items); !slices.Equal(got, []string{"Beyonce", "Eminem"}) {
+		t.Fatalf("page 2 = %v", got)
+	}
+	if p2.NextCursor == "" || p2.PrevCursor == "" {
+		t.Fatalf("page 2 cursors: next=%q prev=%q", p2.NextCursor, p2.PrevCursor)
+	}
+
+	// 最終ページ: 次ページは無い
+	p3 := list(2, p2.NextCursor)
+	if got := singerNames(p3.Items); !slices.Equal(got, []string{"Daft Punk"}) {
+		t.Fatalf("page 3 = %v", got)
+	}
+	if p3.NextCursor != "" || p3.PrevCursor == "" {
+		t.Fatalf("page 3 cursors: next=%q prev=%q", p3.NextCursor, p3.PrevCursor)
+	}
+
+	// prev で戻ると同じページが同じ順で返る
+	back := list(2, p3.PrevCursor)
+	if got := singerNames(back.Items); !slices.Equal(got, singerNames(p2.Items)) {
+		t.Fatalf("prev of page 3 = %v, want %v", got, singerNames(p2.Items))
+	}
+	first := list(2, back.PrevCursor)
+	if got := singerNames(first.Items); !slices.Equal(got, singerNames(p1.Items)) {
+		t.Fatalf("prev of page 2 = %v, want %v", got, singerNames(p1.Items))
+	}
+	if first.PrevCursor != "" {
+		t.Fatalf("prev cursor on the first page = %q, want none", first.PrevCursor)
+	}
+}
+
+func TestSingerService_ListLimitAndTotal(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := newTestSingerService(t, fixtureSingers...)
+
+	res, err := svc.List(ctx, SingerListParams{PageRequest: PageRequest{Limit: 1, IncludeTotal: true}})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(res.Items) != 1 || res.Total == nil || *res.Total != len(fixtureSingers) {
+		t.Fatalf("List = %d items, total %v; want 1 item, total %d", len(res.Items), res.Total, len(fixtureSingers))
+	}
+	res, err = svc.List(ctx, SingerListParams{})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if res.Total != nil {
+		t.Fatalf("Total = %d without IncludeTotal", *res.Total)
+	}
+}
+
+func TestSingerService_ListRejectsInvalidCursor(t *testing.T) {
+	ctx := context.Background()
+	svc, ds := newTestSingerService(t, fixtureSingers...)
+	byName := []repository.SortField{{Field: repository.SingerFieldName}}
+
+	res, err := svc.List(ctx, SingerListParams{PageRequest: PageRequest{Limit: 2}, Sort: byName})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	tampered := []byte(res.NextCursor)
+	tampered[0] ^= 1
+	other := NewSingerService(ds, NewCursorCodec([]byte("other-secret")))
+
+	for name, tc := range map[string]struct {
+		svc    *SingerService
+		cursor string
+		sort   []repository.SortField
+	}{
+		"tampered":     {svc, string(tampered), byName},
+		"garbage":      {svc, "not-a-cursor", byName},
+		"other sort":   {svc, res.NextCursor, nil},
+		"other secret": {other, res.NextCursor, byName},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := tc.svc.List(ctx, SingerListParams{PageRequest: PageRequest{Cursor: tc.cursor}, Sort: tc.sort})
+			var verr *ValidationError
+			if !errors.As(err, &verr) || verr.Fields["cursor"] == "" {
+				t.Fatalf("List = %v, want a cursor ValidationError", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/kawabatas/mini-web-app/internal/domain/repository"
+)
+
+// ハンドラ層がリポジトリ層を直接参照せずに判定できるよう再公開します。
+var (
+	ErrNotFound        = repository.ErrNotFound
+	ErrConflict        = repository.ErrConflict
+	ErrVersionConflict = repository.ErrVersionConflict
+	ErrReadOnly        = repository.ErrReadOnly
+)
+
+// ErrNotSupported は現在の構成（DB ドライバ・ストレージ）では実行できない操作であることを表します。
+var ErrNotSupported = errors.New("operation is not supported in this configuration")
+
+// ValidationError は入力値の検証エラーです。Fields はフィールド名→理由。
+type ValidationError struct {
+	Fields map[string]string
+}
+
+func (e *ValidationError) Error() string {
+	keys := make([]string, 0, len(e.Fields))
+	for k := range e.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s: %s", k, e.Fields[k]))
+	}
+	return "validation failed: " + strings.Join(parts, ", ")
+}
+
+// add はフィールドのエラーを追加します（同一フィールドは最初のものを優先）。
+func (e *ValidationError) add(field, reason string) {
+	if e.Fields == nil {
+		e.Fields = map[string]string{}
+	}
+	if _, ok := e.Fields[field]; !ok {
+		e.Fields[field] = reason
+	}
+}
+
+// errOrNil はエラーが無ければ nil を返します。
+func (e *ValidationError) errOrNil() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
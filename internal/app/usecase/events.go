@@ -0,0 +1,28 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/kawabatas/mini-web-app/internal/domain/event"
+	"github.com/kawabatas/mini-web-app/internal/domain/model"
+	"github.com/kawabatas/mini-web-app/internal/infra/datastore"
+	"github.com/kawabatas/mini-web-app/internal/util/clock"
+)
+
+// publishEvent はドメインイベントを tx 内で outbox に追記します（transactional outbox）。
+// 変更がコミットされた場合に限りイベントが残り、ディスパッチャが後から配信します。
+func publishEvent(ctx context.Context, tx datastore.Repositories, eventType string, payload any) error {
+	if err := event.Validate(eventType); err != nil {
+		return err
+	}
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	if err := tx.Outbox().Append(ctx, model.OutboxEvent{Type: eventType, Payload: b, CreatedAt: clock.Now()}); err != nil {
+		return fmt.Errorf("append outbox: %w", err)
+	}
+	return nil
+}
@@ -2,49 +2,280 @@ package usecase
 
 import (
 	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
+	"github.com/kawabatas/mini-web-app/internal/domain/event"
 	"github.com/kawabatas/mini-web-app/internal/domain/model"
+	"github.com/kawabatas/mini-web-app/internal/domain/repository"
 	"github.com/kawabatas/mini-web-app/internal/infra/datastore"
+	"github.com/kawabatas/mini-web-app/internal/util/clock"
 )
 
-// SingerListParams は /api/singers のリクエストのパラメータです。
+// SingerListParams は /api/v1/singers のリクエストのパラメータです。
 type SingerListParams struct {
-	Limit  int
-	Offset int
+	PageRequest
+	Filter repository.SingerFilter
+	// Sort は並び順です（空の場合は id 昇順）。id は常に最後のタイブレークとして付与されます。
+	Sort []repository.SortField
 }
 
 type SingerListResult struct {
-	Items      []model.Singer `json:"items"`
-	Total      int            `json:"total"`
-	NextOffset int            `json:"next_offset"`
+	Items []model.Singer `json:"items"`
+	PageInfo
 }
 
 type SingerService struct {
-	ds datastore.DataStore
+	ds     datastore.DataStore
+	cursor *CursorCodec
 }
 
-func NewSingerService(ds datastore.DataStore) *SingerService {
-	return &SingerService{ds: ds}
+func NewSingerService(ds datastore.DataStore, cursor *CursorCodec) *SingerService {
+	return &SingerService{ds: ds, cursor: cursor}
 }
 
+// List は絞り込み・並び替えを適用し、キーセット方式で一覧を返します。
 func (s *SingerService) List(ctx context.Context, p SingerListParams) (SingerListResult, error) {
-	offset, limit := 0, 20
-	if p.Offset > 0 {
-		offset = p.Offset
+	repo := s.ds.Singers()
+	items, info, err := fetchPage(s.cursor, p.PageRequest, pageQuery[model.Singer]{
+		sort: sortSignature(p.Sort),
+		fetch: func(after *repository.Keyset, limit int) ([]model.Singer, error) {
+			return repo.List(ctx, repository.SingerListQuery{Filter: p.Filter, Sort: p.Sort, After: after, Limit: limit})
+		},
+		keyOf: func(m model.Singer) repository.Keyset {
+			vals := make([]string, 0, len(p.Sort))
+			for _, f := range p.Sort {
+				vals = append(vals, singerFieldString(m, f.Field))
+			}
+			return repository.Keyset{Values: vals, ID: m.ID}
+		},
+		count: func() (int, error) { return repo.Count(ctx, p.Filter) },
+	})
+	if err != nil {
+		return SingerListResult{}, err
+	}
+	if items == nil {
+		items = []model.Singer{}
 	}
-	// limit は 1〜100 の範囲に制限
-	if limit > 0 && limit <= 100 {
-		limit = p.Limit
+	return SingerListResult{Items: items, PageInfo: info}, nil
+}
+
+// singerFieldString はキーセットに埋め込むフィールド値の文字列表現を返します。
+func singerFieldString(m model.Singer, field string) string {
+	switch field {
+	case repository.SingerFieldName:
+		return m.Name
+	case repository.SingerFieldGenre:
+		return m.Genre
+	case repository.SingerFieldDebutYear:
+		return strconv.Itoa(m.DebutYear)
+	case repository.SingerFieldCreatedAt:
+		return m.CreatedAt.UTC().Format(time.RFC3339Nano)
 	}
+	return ""
+}
 
-	base, err := s.ds.Singers().List(ctx, offset, limit+1) // 次ページ確認のため +1 で取得
+// SingerInput は作成・全体更新（PUT）時の入力です。
+type SingerInput struct {
+	Name      string
+	Genre     string
+	DebutYear int
+}
+
+// SingerPatch は部分更新（PATCH）時の入力です。nil のフィールドは変更しません。
+type SingerPatch struct {
+	Name      *string
+	Genre     *string
+	DebutYear *int
+}
+
+const (
+	maxSingerNameLen  = 100
+	maxSingerGenreLen = 50
+	minDebutYear      = 1900
+)
+
+func (s *SingerService) Get(ctx context.Context, id int64) (model.Singer, error) {
+	return s.ds.Singers().Get(ctx, id)
+}
+
+// 更新系はいずれも変更・監査ログ・ドメインイベント（outbox）の追記を 1 トランザクションで行います。
+
+func (s *SingerService) Create(ctx context.Context, in SingerInput) (model.Singer, error) {
+	m := in.toModel()
+	if err := validateSinger(m); err != nil {
+		return model.Singer{}, err
+	}
+	var out model.Singer
+	err := s.ds.WithTx(ctx, func(tx datastore.Repositories) error {
+		var err error
+		if out, err = tx.Singers().Create(ctx, m); err != nil {
+			return err
+		}
+		if err := recordAudit(ctx, tx, auditEntitySinger, out.ID, auditActionCreate, nil, &out); err != nil {
+			return err
+		}
+		return publishEvent(ctx, tx, event.SingerCreated, event.SingerPayload{Singer: out})
+	})
 	if err != nil {
-		return SingerListResult{}, err
+		return model.Singer{}, err
+	}
+	return out, nil
+}
+
+// Update は id のレコードを in の内容で置き換えます。
+// version が現在のバージョンと一致しない場合は ErrVersionConflict を返します。
+func (s *SingerService) Update(ctx context.Context, id, version int64, in SingerInput) (model.Singer, error) {
+	m := in.toModel()
+	m.ID = id
+	m.Version = version
+	if err := validateSinger(m); err != nil {
+		return model.Singer{}, err
+	}
+	var out model.Singer
+	err := s.ds.WithTx(ctx, func(tx datastore.Repositories) error {
+		before, err := tx.Singers().Get(ctx, id)
+		if err != nil {
+			return err
+		}
+		if out, err = tx.Singers().Update(ctx, m); err != nil {
+			return err
+		}
+		if err := recordAudit(ctx, tx, auditEntitySinger, id, auditActionUpdate, &before, &out); err != nil {
+			return err
+		}
+		return publishEvent(ctx, tx, event.SingerUpdated, event.SingerPayload{Singer: out})
+	})
+	if err != nil {
+		return model.Singer{}, err
+	}
+	return out, nil
+}
+
+// Patch は指定されたフィールドのみ更新します。読み取りと更新は同一トランザクションで行います。
+// version が現在のバージョンと一致しない場合は ErrVersionConflict を返します。
+func (s *SingerService) Patch(ctx context.Context, id, version int64, p SingerPatch) (model.Singer, error) {
+	var out model.Singer
+	err := s.ds.WithTx(ctx, func(tx datastore.Repositories) error {
+		cur, err := tx.Singers().Get(ctx, id)
+		if err != nil {
+			return err
+		}
+		if cur.Version != version {
+			// 入力検証より先に判定し、古い版を基にした変更であることを優先して返す
+			return ErrVersionConflict
+		}
+		before := cur // 監査ログ用に変更前の値を控える
+		if p.Name != nil {
+			cur.Name = strings.TrimSpace(*p.Name)
+		}
+		if p.Genre != nil {
+			cur.Genre = strings.TrimSpace(*p.Genre)
+		}
+		if p.DebutYear != nil {
+			cur.DebutYear = *p.DebutYear
+		}
+		if err := validateSinger(cur); err != nil {
+			return err
+		}
+		if out, err = tx.Singers().Update(ctx, cur); err != nil {
+			return err
+		}
+		if err := recordAudit(ctx, tx, auditEntitySinger, id, auditActionUpdate, &before, &out); err != nil {
+			return err
+		}
+		return publishEvent(ctx, tx, event.SingerUpdated, event.SingerPayload{Singer: out})
+	})
+	if err != nil {
+		return model.Singer{}, err
 	}
+	return out, nil
+}
 
-	next := offset + limit
-	if len(base) <= limit {
-		next = -1 // 次ページなし
+// Delete は id のレコードを論理削除します。version が現在のバージョンと一致しない場合は ErrVersionConflict を返します。
+// 削除済みのレコードは Restore で復元でき、PurgeDeleted で物理削除されるまで保持されます。
+func (s *SingerService) Delete(ctx context.Context, id, version int64) error {
+	return s.ds.WithTx(ctx, func(tx datastore.Repositories) error {
+		before, err := tx.Singers().Get(ctx, id)
+		if err != nil {
+			return err
+		}
+		if err := tx.Singers().Delete(ctx, id, version); err != nil {
+			return err
+		}
+		if err := recordAudit(ctx, tx, auditEntitySinger, id, auditActionDelete, &before, nil); err != nil {
+			return err
+		}
+		return publishEvent(ctx, tx, event.SingerDeleted, event.SingerPayload{Singer: before})
+	})
+}
+
+// Restore は論理削除済みのレコードを復元します。
+func (s *SingerService) Restore(ctx context.Context, id int64) (model.Singer, error) {
+	var out model.Singer
+	err := s.ds.WithTx(ctx, func(tx datastore.Repositories) error {
+		var err error
+		if out, err = tx.Singers().Restore(ctx, id); err != nil {
+			return err
+		}
+		if err := recordAudit(ctx, tx, auditEntitySinger, id, auditActionRestore, nil, &out); err != nil {
+			return err
+		}
+		return publishEvent(ctx, tx, event.SingerUpdated, event.SingerPayload{Singer: out})
+	})
+	if err != nil {
+		return model.Singer{}, err
+	}
+	return out, nil
+}
+
+// PurgeDeleted は論理削除から retention 以上経過した行を物理削除し、削除件数を返します。
+// 監査ログには対象の期限と件数を 1 件として記録します（削除が無い場合は記録しません）。
+func (s *SingerService) PurgeDeleted(ctx context.Context, retention time.Duration) (int64, error) {
+	before := clock.Now().Add(-retention)
+	var n int64
+	err := s.ds.WithTx(ctx, func(tx datastore.Repositories) error {
+		var err error
+		if n, err = tx.Singers().Purge(ctx, before); err != nil || n == 0 {
+			return err
+		}
+		summary := map[string]any{"deleted_before": before.UTC(), "rows": n}
+		return recordAudit(ctx, tx, auditEntitySinger, 0, auditActionPurge, nil, summary)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func (in SingerInput) toModel() model.Singer {
+	return model.Singer{
+		Name:      strings.TrimSpace(in.Name),
+		Genre:     strings.TrimSpace(in.Genre),
+		DebutYear: in.DebutYear,
+	}
+}
+
+// validateSinger は name / genre が空でないこと、debut_year が 1900〜今年の範囲であることを検証します。
+func validateSinger(m model.Singer) error {
+	var verr ValidationError
+	switch {
+	case m.Name == "":
+		verr.add("name", "must not be empty")
+	case utf8.RuneCountInString(m.Name) > maxSingerNameLen:
+		verr.add("name", fmt.Sprintf("must be at most %d characters", maxSingerNameLen))
+	}
+	switch {
+	case m.Genre == "":
+		verr.add("genre", "must not be empty")
+	case utf8.RuneCountInString(m.Genre) > maxSingerGenreLen:
+		verr.add("genre", fmt.Sprintf("must be at most %d characters", maxSingerGenreLen))
+	}
+	if thisYear := clock.Now().Year(); m.DebutYear < minDebutYear || m.DebutYear > thisYear {
+		verr.add("debut_year", fmt.Sprintf("must be between %d and %d", minDebutYear, thisYear))
 	}
-	return SingerListResult{Items: base, Total: len(base), NextOffset: next}, nil
+	return verr.errOrNil()
 }
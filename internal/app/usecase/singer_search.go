@@ -0,0 +1,117 @@
+package usecase
+
+import (
+	"context"
+	"html"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/kawabatas/mini-web-app/internal/domain/model"
+	"github.com/kawabatas/mini-web-app/internal/domain/repository"
+)
+
+// SingerSearchParams は /api/v1/singers/search のリクエストのパラメータです（IncludeTotal は使用しません）。
+type SingerSearchParams struct {
+	PageRequest
+	Query string
+}
+
+// SingerSearchItem は検索結果の 1 件です。
+// Highlights は一致箇所を <mark> で囲んだ HTML エスケープ済みのフィールド値です（name / genre）。
+type SingerSearchItem struct {
+	model.Singer
+	Score      float64           `json:"score"`
+	Highlights map[string]string `json:"highlights"`
+}
+
+type SingerSearchResult struct {
+	Items []SingerSearchItem `json:"items"`
+	PageInfo
+}
+
+const maxSearchQueryLen = 200
+
+// Search は name / genre の部分一致で検索し、関連度順にキーセット方式で返します。
+// カーソルは (score, id) を基点とし、検索語ごとに署名するため別の検索語のカーソルは拒否します。
+func (s *SingerService) Search(ctx context.Context, p SingerSearchParams) (SingerSearchResult, error) {
+	q := strings.TrimSpace(p.Query)
+	var verr ValidationError
+	switch {
+	case q == "":
+		verr.add("q", "must not be empty")
+	case len([]rune(q)) > maxSearchQueryLen:
+		verr.add("q", "too long")
+	}
+	if err := verr.errOrNil(); err != nil {
+		return SingerSearchResult{}, err
+	}
+
+	repo := s.ds.Singers()
+	req := p.PageRequest
+	req.IncludeTotal = false // 検索結果の件数は返さない
+	hits, info, err := fetchPage(s.cursor, req, pageQuery[model.SingerHit]{
+		sort: "search:" + q,
+		fetch: func(after *repository.Keyset, limit int) ([]model.SingerHit, error) {
+			return repo.Search(ctx, repository.SingerSearchQuery{Query: q, After: after, Limit: limit})
+		},
+		keyOf: func(h model.SingerHit) repository.Keyset {
+			return repository.Keyset{Values: []string{strconv.FormatFloat(h.Score, 'g', -1, 64)}, ID: h.ID}
+		},
+	})
+	if err != nil {
+		return SingerSearchResult{}, err
+	}
+	terms := strings.Fields(q)
+	items := make([]SingerSearchItem, 0, len(hits))
+	for _, h := range hits {
+		items = append(items, SingerSearchItem{
+			Singer: h.Singer,
+			Score:  h.Score,
+			Highlights: map[string]string{
+				"name":  highlight(h.Name, terms),
+				"genre": highlight(h.Genre, terms),
+			},
+		})
+	}
+	return SingerSearchResult{Items: items, PageInfo: info}, nil
+}
+
+// highlight は text 中の terms（大文字小文字を区別しない）を <mark> で囲みます。
+// 値そのものは HTML エスケープするため、そのまま innerHTML に使用できます。
+func highlight(text string, terms []string) string {
+	src := []rune(text)
+	lower := make([]rune, len(src))
+	for i, r := range src {
+		lower[i] = unicode.ToLower(r)
+	}
+	marked := make([]bool, len(src))
+	for _, t := range terms {
+		tr := []rune(strings.ToLower(t))
+		if len(tr) == 0 {
+			continue
+		}
+		for i := 0; i+len(tr) <= len(lower); i++ {
+			if string(lower[i:i+len(tr)]) == string(tr) {
+				for j := i; j < i+len(tr); j++ {
+					marked[j] = true
+				}
+			}
+		}
+	}
+	var b strings.Builder
+	for i := 0; i < len(src); {
+		j := i
+		for j < len(src) && marked[j] == marked[i] {
+			j++
+		}
+		seg := html.EscapeString(string(src[i:j]))
+		if marked[i] {
+			b.WriteString("<mark>" + seg + "</mark>")
+		} else {
+			b.WriteString(seg)
+		}
+		i = j
+	}
+	return b.String()
+}
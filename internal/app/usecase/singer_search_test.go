@@ -0,0 +1,114 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/kawabatas/mini-web-app/internal/domain/model"
+)
+
+// searchFixture は関連度が同点・異なる行を含む検索用の初期データです。
+var searchFixture = []model.Singer{
+	{Name: "Taylor Swift", Genre: "Pop", DebutYear: 2006},
+	{Name: "Ed Sheeran", Genre: "Pop", DebutYear: 2011},
+	{Name: "Adele", Genre: "Soul", DebutYear: 2008},
+	{Name: "Popstar", Genre: "Pop", DebutYear: 2020},
+	{Name: "Bruno Mars", Genre: "Pop", DebutYear: 2010},
+	{Name: "Iggy Pop", Genre: "Rock", DebutYear: 1977},
+}
+
+func searchIDs(items []SingerSearchItem) []int64 {
+	out := make([]int64, 0, len(items))
+	for _, it := range items {
+		out = append(out, it.ID)
+	}
+	return out
+}
+
+func TestSingerService_SearchPaging(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := newTestSingerService(t, searchFixture...)
+	search := func(limit int, cursor string) SingerSearchResult {
+		t.Helper()
+		res, err := svc.Search(ctx, SingerSearchParams{Query: "pop", PageRequest: PageRequest{Limit: limit, Cursor: cursor}})
+		if err != nil {
+			t.Fatalf("Search(cursor=%q): %v", cursor, err)
+		}
+		return res
+	}
+
+	all := search(maxPageLimit, "")
+	if len(all.Items) != 5 || all.NextCursor != "" {
+		t.Fatalf("Search = %d items (next %q), want 5 without next", len(all.Items), all.NextCursor)
+	}
+	for i := 1; i < len(all.Items); i++ {
+		if prev, cur := all.Items[i-1], all.Items[i]; prev.Score < cur.Score || (prev.Score == cur.Score && prev.ID > cur.ID) {
+			t.Fatalf("items are not ordered by (score desc, id asc): %+v", all.Items)
+		}
+	}
+
+	// 2 件ずつ辿っても、1 ページで取得した場合と同じ並びを重複・欠落なく返す
+	var (
+		ids   []int64
+		pages []SingerSearchResult
+	)
+	for cursor := ""; ; {
+		p := search(2, cursor)
+		pages = append(pages, p)
+		ids = append(ids, searchIDs(p.Items)...)
+		if cursor = p.NextCursor; cursor == "" {
+			break
+		}
+	}
+	if want := searchIDs(all.Items); !slices.Equal(ids, want) {
+		t.Fatalf("paged ids = %v, want %v", ids, want)
+	}
+	if len(pages) != 3 || pages[0].PrevCursor != "" {
+		t.Fatalf("pages = %d, first prev = %q", len(pages), pages[0].PrevCursor)
+	}
+	// prev で前のページに戻れる
+	back := search(2, pages[2].PrevCursor)
+	if got, want := searchIDs(back.Items), searchIDs(pages[1].Items); !slices.Equal(got, want) {
+		t.Fatalf("prev of the last page = %v, want %v", got, want)
+	}
+
+	// 別の検索語のカーソルは受け付けない
+	_, err := svc.Search(ctx, SingerSearchParams{Query: "rock", PageRequest: PageRequest{Cursor: pages[0].NextCursor}})
+	var verr *ValidationError
+	if !errors.As(err, &verr) || verr.Fields["cursor"] == "" {
+		t.Fatalf("Search with a cursor of another query = %v, want a cursor ValidationError", err)
+	}
+}
+
+func TestSingerService_SearchValidation(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := newTestSingerService(t, searchFixture...)
+
+	for name, tc := range map[string]struct {
+		params SingerSearchParams
+		field  string
+	}{
+		"empty query":    {SingerSearchParams{Query: "  "}, "q"},
+		"limit too big":  {SingerSearchParams{Query: "pop", PageRequest: PageRequest{Limit: maxPageLimit + 1}}, "limit"},
+		"negative limit": {SingerSearchParams{Query: "pop", PageRequest: PageRequest{Limit: -1}}, "limit"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := svc.Search(ctx, tc.params)
+			var verr *ValidationError
+			if !errors.As(err, &verr) || verr.Fields[tc.field] == "" {
+				t.Fatalf("Search = %v, want a ValidationError for %q", err, tc.field)
+			}
+		})
+	}
+
+	// 3 文字未満の語のみは関連度を計算しないため、すべて同点で id 順
+	res, err := svc.Search(ctx, SingerSearchParams{Query: "Ed"})
+	if err != nil {
+		t.Fatalf("Search(Ed): %v", err)
+	}
+	if len(res.Items) != 1 || res.Items[0].Name != "Ed Sheeran" || res.Items[0].Highlights["name"] != "<mark>Ed</mark> Sheeran" {
+		t.Fatalf("Search(Ed) = %+v", res.Items)
+	}
+}
@@ -0,0 +1,200 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kawabatas/mini-web-app/internal/domain/model"
+	"github.com/kawabatas/mini-web-app/internal/domain/repository"
+	"github.com/kawabatas/mini-web-app/internal/infra/datastore"
+)
+
+// fixtureSingers はテスト用の初期データです（id は 1 から順に採番される）。
+var fixtureSingers = []model.Singer{
+	{Name: "Adele", Genre: "Soul", DebutYear: 2008},
+	{Name: "Beyonce", Genre: "R&B", DebutYear: 1997},
+	{Name: "Coldplay", Genre: "Rock", DebutYear: 1998},
+	{Name: "Daft Punk", Genre: "Electronic", DebutYear: 1993},
+	{Name: "Eminem", Genre: "Hip Hop", DebutYear: 1996},
+}
+
+// openTestStore は singers を投入したインメモリ DataStore を返します。
+func openTestStore(t *testing.T, singers ...model.Singer) datastore.DataStore {
+	t.Helper()
+	ctx := context.Background()
+	ds, err := datastore.OpenMemory(ctx, func(ctx context.Context, tx datastore.Repositories) error {
+		for _, s := range singers {
+			if _, err := tx.Singers().Create(ctx, s); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("OpenMemory: %v", err)
+	}
+	t.Cleanup(func() { _ = ds.Close(context.Background()) })
+	return ds
+}
+
+func newTestSingerService(t *testing.T, singers ...model.Singer) (*SingerService, datastore.DataStore) {
+	t.Helper()
+	ds := openTestStore(t, singers...)
+	return NewSingerService(ds, NewCursorCodec([]byte("test-secret"))), ds
+}
+
+func TestSingerService_CRUD(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := newTestSingerService(t)
+
+	created, err := svc.Create(ctx, SingerInput{Name: "  Adele ", Genre: "Soul", DebutYear: 2008})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if created.ID == 0 || created.Name != "Adele" || created.Version != 1 {
+		t.Fatalf("Create = %+v, want trimmed name and version 1", created)
+	}
+
+	got, err := svc.Get(ctx, created.ID)
+	if err != nil || got.Name != "Adele" {
+		t.Fatalf("Get = %+v, %v", got, err)
+	}
+
+	updated, err := svc.Update(ctx, created.ID, 1, SingerInput{Name: "Adele", Genre: "Pop", DebutYear: 2008})
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if updated.Genre != "Pop" || updated.Version != 2 {
+		t.Fatalf("Update = %+v, want genre Pop and version 2", updated)
+	}
+
+	year := 2006
+	patched, err := svc.Patch(ctx, created.ID, 2, SingerPatch{DebutYear: &year})
+	if err != nil {
+		t.Fatalf("Patch: %v", err)
+	}
+	if patched.DebutYear != 2006 || patched.Genre != "Pop" || patched.Version != 3 {
+		t.Fatalf("Patch = %+v, want debut_year 2006 with other fields kept", patched)
+	}
+
+	if err := svc.Delete(ctx, created.ID, 3); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := svc.Get(ctx, created.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get after delete = %v, want ErrNotFound", err)
+	}
+}
+
+func TestSingerService_Validation(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := newTestSingerService(t, fixtureSingers...)
+
+	_, err := svc.Create(ctx, SingerInput{Name: " ", Genre: "", DebutYear: 1800})
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("Create = %v, want ValidationError", err)
+	}
+	for _, f := range []string{"name", "genre", "debut_year"} {
+		if _, ok := verr.Fields[f]; !ok {
+			t.Errorf("Fields[%q] is missing: %v", f, verr.Fields)
+		}
+	}
+
+	empty := ""
+	if _, err := svc.Patch(ctx, 1, 1, SingerPatch{Name: &empty}); !errors.As(err, &verr) {
+		t.Fatalf("Patch with empty name = %v, want ValidationError", err)
+	}
+}
+
+func TestSingerService_VersionConflict(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := newTestSingerService(t, fixtureSingers...)
+
+	if _, err := svc.Update(ctx, 1, 2, SingerInput{Name: "Adele", Genre: "Pop", DebutYear: 2008}); !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("Update with stale version = %v, want ErrVersionConflict", err)
+	}
+	// 古い版を基にした PATCH は入力が不正でも ErrVersionConflict を優先する
+	empty := ""
+	if _, err := svc.Patch(ctx, 1, 2, SingerPatch{Name: &empty}); !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("Patch with stale version = %v, want ErrVersionConflict", err)
+	}
+	if err := svc.Delete(ctx, 1, 2); !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("Delete with stale version = %v, want ErrVersionConflict", err)
+	}
+	if _, err := svc.Update(ctx, 99, 1, SingerInput{Name: "X", Genre: "Y", DebutYear: 2000}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Update of unknown id = %v, want ErrNotFound", err)
+	}
+}
+
+func TestSingerService_SoftDeleteAndRestore(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := newTestSingerService(t, fixtureSingers...)
+
+	if err := svc.Delete(ctx, 2, 1); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	res, err := svc.List(ctx, SingerListParams{PageRequest: PageRequest{IncludeTotal: true}})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if *res.Total != 4 || containsSinger(res.Items, 2) {
+		t.Fatalf("List after delete = %d items (total %d), want 4 without id 2", len(res.Items), *res.Total)
+	}
+
+	res, err = svc.List(ctx, SingerListParams{Filter: repository.SingerFilter{IncludeDeleted: true}})
+	if err != nil {
+		t.Fatalf("List include_deleted: %v", err)
+	}
+	if !containsSinger(res.Items, 2) {
+		t.Fatal("List with IncludeDeleted does not contain the deleted singer")
+	}
+	for _, s := range res.Items {
+		if (s.ID == 2) != (s.DeletedAt != nil) {
+			t.Fatalf("singer %d: DeletedAt = %v", s.ID, s.DeletedAt)
+		}
+	}
+
+	restored, err := svc.Restore(ctx, 2)
+	if err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if restored.DeletedAt != nil || restored.Name != "Beyonce" {
+		t.Fatalf("Restore = %+v", restored)
+	}
+	if _, err := svc.Get(ctx, 2); err != nil {
+		t.Fatalf("Get after restore: %v", err)
+	}
+	if _, err := svc.Restore(ctx, 2); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Restore of a live singer = %v, want ErrNotFound", err)
+	}
+}
+
+func TestSingerService_PurgeDeleted(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := newTestSingerService(t, fixtureSingers...)
+
+	if err := svc.Delete(ctx, 3, 1); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	// 保持期間内は残す
+	if n, err := svc.PurgeDeleted(ctx, time.Hour); err != nil || n != 0 {
+		t.Fatalf("PurgeDeleted(1h) = %d, %v; want 0", n, err)
+	}
+	if n, err := svc.PurgeDeleted(ctx, -time.Hour); err != nil || n != 1 {
+		t.Fatalf("PurgeDeleted(-1h) = %d, %v; want 1", n, err)
+	}
+	if _, err := svc.Restore(ctx, 3); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Restore after purge = %v, want ErrNotFound", err)
+	}
+}
+
+func containsSinger(items []model.Singer, id int64) bool {
+	for _, s := range items {
+		if s.ID == id {
+			return true
+		}
+	}
+	return false
+}
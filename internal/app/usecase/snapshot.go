@@ -0,0 +1,169 @@
+package usecase
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kawabatas/mini-web-app/internal/infra/datastore"
+)
+
+// 監査ログの対象エンティティ・操作（スナップショットからの復元）
+const (
+	auditEntityDatastore       = "datastore"
+	auditActionRestoreSnapshot = "restore_snapshot"
+	auditActionAcceptSnapshot  = "accept_snapshot"
+)
+
+// quarantinePrefix は公開前の検査に失敗したスナップショットの保管キーの接頭辞です。
+const quarantinePrefix = "quarantine/"
+
+// SnapshotRestoreParams は指定時刻への復元（ポイントインタイムリストア）のパラメータです。
+type SnapshotRestoreParams struct {
+	// At は復元したい時刻です。At 以前で最も新しいスナップショットを使います。
+	At time.Time `json:"at"`
+	// DryRun は対象のスナップショットの選択と検証のみ行い、復元はしません。
+	DryRun bool `json:"dry_run"`
+}
+
+type SnapshotRestoreResult struct {
+	Snapshot    datastore.SnapshotInfo `json:"snapshot"`
+	RequestedAt time.Time              `json:"requested_at"`
+	DryRun      bool                   `json:"dry_run"`
+}
+
+type SnapshotListResult struct {
+	Items []datastore.SnapshotInfo `json:"items"`
+}
+
+// SnapshotService は保管済みスナップショットの一覧と、スナップショットからの復元を扱います。
+type SnapshotService struct {
+	ds datastore.DataStore
+}
+
+func NewSnapshotService(ds datastore.DataStore) *SnapshotService {
+	return &SnapshotService{ds: ds}
+}
+
+func (s *SnapshotService) restorer() (datastore.SnapshotRestorer, error) {
+	r, ok := s.ds.(datastore.SnapshotRestorer)
+	if !ok {
+		return nil, ErrNotSupported
+	}
+	return r, nil
+}
+
+// List は保管済みのスナップショットを新しい順に返します。
+func (s *SnapshotService) List(ctx context.Context) (SnapshotListResult, error) {
+	r, err := s.restorer()
+	if err != nil {
+		return SnapshotListResult{}, err
+	}
+	snaps, err := r.ListSnapshots(ctx)
+	if err != nil {
+		return SnapshotListResult{}, mapSnapshotErr(err)
+	}
+	items := make([]datastore.SnapshotInfo, 0, len(snaps))
+	for i := len(snaps) - 1; i >= 0; i-- {
+		items = append(items, snaps[i])
+	}
+	return SnapshotListResult{Items: items}, nil
+}
+
+// RestoreAt は p.At 以前で最も新しいスナップショットを検証し、その時点の内容に復元します。
+// 復元は監査ログ（entity=datastore, action=restore_snapshot）に同じトランザクションで記録します。
+// 該当するスナップショットが無い場合は ErrNotFound を返します。
+func (s *SnapshotService) RestoreAt(ctx context.Context, p SnapshotRestoreParams) (SnapshotRestoreResult, error) {
+	if p.At.IsZero() {
+		var verr ValidationError
+		verr.add("at", "must be set")
+		return SnapshotRestoreResult{}, &verr
+	}
+	r, err := s.restorer()
+	if err != nil {
+		return SnapshotRestoreResult{}, err
+	}
+	snaps, err := r.ListSnapshots(ctx)
+	if err != nil {
+		return SnapshotRestoreResult{}, mapSnapshotErr(err)
+	}
+	target, ok := nearestSnapshotBefore(snaps, p.At)
+	if !ok {
+		return SnapshotRestoreResult{}, fmt.Errorf("%w: no snapshot at or before %s", ErrNotFound, p.At.UTC().Format(time.RFC3339))
+	}
+
+	info, err := r.RestoreSnapshot(ctx, target.Key, p.DryRun, func(tx datastore.Repositories) error {
+		summary := map[string]any{
+			"snapshot":     target.Key,
+			"snapshot_at":  target.At,
+			"requested_at": p.At.UTC(),
+		}
+		return recordAudit(ctx, tx, auditEntityDatastore, 0, auditActionRestoreSnapshot, nil, summary)
+	})
+	if err != nil {
+		return SnapshotRestoreResult{}, mapSnapshotErr(err)
+	}
+	return SnapshotRestoreResult{Snapshot: info, RequestedAt: p.At.UTC(), DryRun: p.DryRun}, nil
+}
+
+// SnapshotAcceptParams は公開を止めたスナップショットの受け入れのパラメータです。
+type SnapshotAcceptParams struct {
+	// Quarantined は DB 全体を置き換える quarantine/ のキーです。空なら現在の DB をそのまま公開します。
+	Quarantined string `json:"quarantined"`
+}
+
+type SnapshotAcceptResult struct {
+	// Held は受け入れる前に公開を止めていた原因です（止めていなかった場合は nil）。
+	Held   *datastore.HeldSnapshot `json:"held,omitempty"`
+	Source string                  `json:"source"` // "local" または p.Quarantined
+}
+
+// Accept は公開前の検査（行数の比較）を省いて current に公開し、公開の停止を解除します。
+// 受け入れは監査ログ（entity=datastore, action=accept_snapshot）に同じトランザクションで記録します。
+func (s *SnapshotService) Accept(ctx context.Context, p SnapshotAcceptParams) (SnapshotAcceptResult, error) {
+	if p.Quarantined != "" && !strings.HasPrefix(p.Quarantined, quarantinePrefix) {
+		var verr ValidationError
+		verr.add("quarantined", "must be a key under "+quarantinePrefix)
+		return SnapshotAcceptResult{}, &verr
+	}
+	a, ok := s.ds.(datastore.SnapshotAcceptor)
+	if !ok {
+		return SnapshotAcceptResult{}, ErrNotSupported
+	}
+	res := SnapshotAcceptResult{Source: cmp.Or(p.Quarantined, "local")}
+	if h, held := a.PublishHold(); held {
+		res.Held = &h
+	}
+	err := a.AcceptSnapshot(ctx, p.Quarantined, func(tx datastore.Repositories) error {
+		return recordAudit(ctx, tx, auditEntityDatastore, 0, auditActionAcceptSnapshot, res.Held, map[string]any{"source": res.Source})
+	})
+	if err != nil {
+		return SnapshotAcceptResult{}, mapSnapshotErr(err)
+	}
+	return res, nil
+}
+
+// nearestSnapshotBefore は古い順の snaps から at 以前で最も新しいものを返します。
+func nearestSnapshotBefore(snaps []datastore.SnapshotInfo, at time.Time) (datastore.SnapshotInfo, bool) {
+	var (
+		out   datastore.SnapshotInfo
+		found bool
+	)
+	for _, sn := range snaps {
+		if sn.At.After(at) {
+			break
+		}
+		out, found = sn, true
+	}
+	return out, found
+}
+
+func mapSnapshotErr(err error) error {
+	if errors.Is(err, datastore.ErrSnapshotUnsupported) {
+		return fmt.Errorf("%w: %v", ErrNotSupported, err)
+	}
+	return err
+}
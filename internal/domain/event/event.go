@@ -0,0 +1,66 @@
+// Package event はドメインイベントの種別とペイロードを定義します。
+//
+// イベントは変更と同じトランザクションで outbox テーブルに追記され、
+// ディスパッチャ（internal/app/outbox）が購読者へ少なくとも 1 回（at-least-once）配信します。
+package event
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/kawabatas/mini-web-app/internal/domain/model"
+)
+
+// イベント種別
+const (
+	SingerCreated = "singer.created"
+	SingerUpdated = "singer.updated" // 復元（論理削除の取り消し）も含む
+	SingerDeleted = "singer.deleted"
+)
+
+var (
+	mu       sync.RWMutex
+	registry = map[string]struct{}{}
+)
+
+func init() {
+	for _, t := range []string{SingerCreated, SingerUpdated, SingerDeleted} {
+		Register(t)
+	}
+}
+
+// Register はイベント種別を登録します。未登録の種別は outbox に追記できません。
+func Register(eventType string) {
+	mu.Lock()
+	defer mu.Unlock()
+	registry[eventType] = struct{}{}
+}
+
+// Validate は eventType が登録済みか確認します。
+func Validate(eventType string) error {
+	mu.RLock()
+	defer mu.RUnlock()
+	if _, ok := registry[eventType]; !ok {
+		return fmt.Errorf("unknown event type: %q", eventType)
+	}
+	return nil
+}
+
+// Types は登録済みのイベント種別を名前順に返します。
+func Types() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	out := make([]string, 0, len(registry))
+	for t := range registry {
+		out = append(out, t)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// SingerPayload は singer.* イベントのペイロードです。
+// 作成・更新は変更後、削除は削除前のレコードを保持します。
+type SingerPayload struct {
+	Singer model.Singer `json:"singer"`
+}
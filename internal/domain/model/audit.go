@@ -0,0 +1,22 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// AuditEntry はデータ変更 1 件の監査ログです。
+type AuditEntry struct {
+	ID        int64     `json:"id"`
+	At        time.Time `json:"at"`
+	Actor     string    `json:"actor"`
+	RequestID string    `json:"request_id,omitempty"`
+	Entity    string    `json:"entity"`              // 例: "singer"
+	EntityID  int64     `json:"entity_id,omitempty"` // 複数行に及ぶ操作（パージなど）は 0
+	Action    string    `json:"action"`              // create | update | delete | restore | purge
+	// Before / After は変更前後の JSON（作成時の Before・削除時の After は無し）。
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+	// Diff は変更されたフィールドごとの {"from": ..., "to": ...} です。
+	Diff json.RawMessage `json:"diff,omitempty"`
+}
@@ -0,0 +1,15 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// OutboxEvent は配信待ちのドメインイベントです。
+type OutboxEvent struct {
+	ID        int64
+	Type      string // 例: "singer.created"（event パッケージに登録済みの種別）
+	Payload   json.RawMessage
+	CreatedAt time.Time
+	Attempts  int // これまでの配信試行回数
+}
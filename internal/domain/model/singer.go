@@ -8,4 +8,14 @@ type Singer struct {
 	Genre     string    `json:"genre"`
 	DebutYear int       `json:"debut_year"`
 	CreatedAt time.Time `json:"created_at"`
+	// Version は楽観的排他制御用のバージョンです（作成時 1、更新のたびに +1）。
+	Version int64 `json:"version"`
+	// DeletedAt は論理削除された日時です（未削除は nil）。
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// SingerHit は検索結果の 1 件です。Score は大きいほど関連度が高いことを表します。
+type SingerHit struct {
+	Singer
+	Score float64
 }
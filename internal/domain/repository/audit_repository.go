@@ -0,0 +1,34 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/kawabatas/mini-web-app/internal/domain/model"
+)
+
+// AuditRepository は監査ログの永続化を抽象化します（追記のみ）。
+type AuditRepository interface {
+	// Append は ID を採番して保存し、保存後のエントリを返します。
+	// 変更と同じトランザクション（WithTx）内で呼び出すこと。
+	Append(ctx context.Context, e model.AuditEntry) (model.AuditEntry, error)
+	// List は新しい順（id 降順）にキーセット方式で q.Limit 件までを返します。
+	// q.After が Backward の場合は逆順（基点に近い順）で返します。
+	List(ctx context.Context, q AuditListQuery) ([]model.AuditEntry, error)
+	// Count は filter に一致する件数を返します。
+	Count(ctx context.Context, filter AuditFilter) (int, error)
+}
+
+// AuditFilter は監査ログの絞り込み条件です（各条件は AND で結合）。
+type AuditFilter struct {
+	Entity   *string
+	EntityID *int64
+	Actor    *string
+	At       TimeRange
+}
+
+// AuditListQuery は AuditRepository.List の条件です。After.Values は使用しません（id のみで並べるため）。
+type AuditListQuery struct {
+	Filter AuditFilter
+	After  *Keyset
+	Limit  int
+}
@@ -0,0 +1,15 @@
+package repository
+
+import "errors"
+
+// リポジトリ実装は DB 固有のエラーを以下に変換して返します。
+var (
+	// ErrNotFound は対象レコードが存在しない場合のエラーです。
+	ErrNotFound = errors.New("record not found")
+	// ErrConflict は一意制約違反など、既存データと競合する場合のエラーです。
+	ErrConflict = errors.New("record conflict")
+	// ErrVersionConflict は指定したバージョンが現在のバージョンと一致しない（他者が先に更新した）場合のエラーです。
+	ErrVersionConflict = errors.New("record version conflict")
+	// ErrReadOnly はデータストアが書き込みを受け付けていない（書き込みリースを保持していない）場合のエラーです。
+	ErrReadOnly = errors.New("datastore is read-only")
+)
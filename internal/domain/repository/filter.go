@@ -0,0 +1,22 @@
+package repository
+
+import "time"
+
+// IntRange は整数の比較条件です。nil の条件は適用しません。
+type IntRange struct {
+	Eq, Gt, Gte, Lt, Lte *int
+}
+
+// TimeRange は日時の比較条件です。nil の条件は適用しません。
+type TimeRange struct {
+	Gt, Gte, Lt, Lte *time.Time
+}
+
+// SingerFilter は一覧の絞り込み条件です（各条件は AND で結合）。
+type SingerFilter struct {
+	Genre     *string
+	DebutYear IntRange
+	CreatedAt TimeRange
+	// IncludeDeleted は論理削除済みの行も含めるかどうかです（既定は除外）。
+	IncludeDeleted bool
+}
@@ -0,0 +1,22 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/kawabatas/mini-web-app/internal/domain/model"
+)
+
+// OutboxRepository はドメインイベントの送信待ちキューを抽象化します。
+type OutboxRepository interface {
+	// Append はイベントを追記します。変更と同じトランザクション（WithTx）内で呼び出すこと。
+	Append(ctx context.Context, e model.OutboxEvent) error
+	// Pending は now 時点で配信可能な未完了のイベントを id 昇順に limit 件まで返します。
+	Pending(ctx context.Context, now time.Time, limit int) ([]model.OutboxEvent, error)
+	// MarkDone はイベントを配信済みにします。
+	MarkDone(ctx context.Context, id int64, at time.Time) error
+	// MarkFailed は配信失敗を記録し（試行回数 +1）、next まで再配信を保留します。
+	MarkFailed(ctx context.Context, id int64, errMsg string, next time.Time) error
+	// DeleteDone は before より前に配信済みとなったイベントを削除し、削除件数を返します。
+	DeleteDone(ctx context.Context, before time.Time) (int64, error)
+}
@@ -0,0 +1,18 @@
+package repository
+
+// SortField はソート指定 1 件です。
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+// Keyset はキーセット方式のページングの基点です。
+//
+// Values は Sort の各フィールドの値の文字列表現（整数は 10 進、日時は RFC 3339）で、
+// 型への変換は各リポジトリ実装が行います。ID は基点の行の id です。
+// Backward が true の場合は基点より前のページを要求します。
+type Keyset struct {
+	Values   []string
+	ID       int64
+	Backward bool
+}
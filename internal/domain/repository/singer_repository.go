@@ -2,11 +2,57 @@ package repository
 
 import (
 	"context"
+	"time"
 
 	"github.com/kawabatas/mini-web-app/internal/domain/model"
 )
 
 // SingerRepository abstracts Singer persistence regardless of the underlying DB.
 type SingerRepository interface {
-	List(ctx context.Context, offset, limit int) ([]model.Singer, error)
+	// List はキーセット方式で q.Limit 件までを返します。
+	// q.After が Backward の場合は逆順（基点に近い順）で返します。
+	List(ctx context.Context, q SingerListQuery) ([]model.Singer, error)
+	// Count は filter に一致する件数を返します。
+	Count(ctx context.Context, filter SingerFilter) (int, error)
+	// Get は id のレコードを返します。存在しない（論理削除済みを含む）場合は ErrNotFound。
+	Get(ctx context.Context, id int64) (model.Singer, error)
+	// Create は ID / CreatedAt を採番して保存し、保存後のレコードを返します。
+	Create(ctx context.Context, s model.Singer) (model.Singer, error)
+	// Update は s.ID のレコードを s.Version が現在のバージョンと一致する場合のみ更新し、
+	// バージョンを +1 した更新後のレコードを返します。一致しない場合は ErrVersionConflict。
+	Update(ctx context.Context, s model.Singer) (model.Singer, error)
+	// Delete は id のレコードを version が現在のバージョンと一致する場合のみ論理削除します。
+	// 一致しない場合は ErrVersionConflict。
+	Delete(ctx context.Context, id, version int64) error
+	// Restore は論理削除済みの id のレコードを復元します。削除済みのレコードが無い場合は ErrNotFound。
+	Restore(ctx context.Context, id int64) (model.Singer, error)
+	// Purge は before より前に論理削除された行を物理削除し、削除件数を返します。
+	Purge(ctx context.Context, before time.Time) (int64, error)
+	// Search は name / genre の部分一致で検索し、関連度（Score）の高い順・id 昇順にキーセット方式で q.Limit 件までを返します。
+	// q.After が Backward の場合は逆順（基点に近い順）で返します。
+	Search(ctx context.Context, q SingerSearchQuery) ([]model.SingerHit, error)
 }
+
+// SingerListQuery は List の条件です。並び順は Sort の後ろに id 昇順が暗黙に付きます。
+type SingerListQuery struct {
+	Filter SingerFilter
+	Sort   []SortField
+	After  *Keyset // nil の場合は先頭から
+	Limit  int
+}
+
+// SingerSearchQuery は Search の条件です。After.Values は Score の 1 要素（strconv.FormatFloat の 'g' 形式）です。
+type SingerSearchQuery struct {
+	// Query は空白区切りの語の AND 条件として扱います。
+	Query string
+	After *Keyset // nil の場合は先頭から
+	Limit int
+}
+
+// Singer のソート・絞り込みに使うフィールド名
+const (
+	SingerFieldName      = "name"
+	SingerFieldGenre     = "genre"
+	SingerFieldDebutYear = "debut_year"
+	SingerFieldCreatedAt = "created_at"
+)
@@ -49,6 +49,28 @@ func LoggingMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// iapUserHeader は Identity-Aware Proxy が付与する認証済みユーザーのヘッダです（値は "accounts.google.com:<email>"）。
+// https://cloud.google.com/iap/docs/identity-howto
+const iapUserHeader = "X-Goog-Authenticated-User-Email"
+
+// ActorMiddleware は操作者を Context に紐付けます（監査ログ用）。
+// trustIAP の場合は IAP が付与した認証済みのメールアドレス、それ以外は "anonymous" とします。
+// ヘッダはクライアントが自由に付与できるため、IAP を経由しないと到達できない構成でのみ trustIAP を有効にすること。
+func ActorMiddleware(trustIAP bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			actor := "anonymous"
+			if v := r.Header.Get(iapUserHeader); trustIAP && v != "" {
+				if _, email, ok := strings.Cut(v, ":"); ok {
+					v = email
+				}
+				actor = v
+			}
+			next.ServeHTTP(w, r.WithContext(WithActor(r.Context(), actor)))
+		})
+	}
+}
+
 func MaintenanceMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// 静的ファイル or favicon は除外
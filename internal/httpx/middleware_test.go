@@ -0,0 +1,35 @@
+package httpx
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestActorMiddleware(t *testing.T) {
+	for name, tc := range map[string]struct {
+		trustIAP bool
+		header   string
+		want     string
+	}{
+		"trusted":               {true, "accounts.google.com:alice@example.com", "alice@example.com"},
+		"trusted without scope": {true, "alice@example.com", "alice@example.com"},
+		"trusted but missing":   {true, "", "anonymous"},
+		"untrusted":             {false, "accounts.google.com:alice@example.com", "anonymous"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var got string
+			h := ActorMiddleware(tc.trustIAP)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = ActorFromCtx(r.Context())
+			}))
+			req := httptest.NewRequest("GET", "/", nil)
+			if tc.header != "" {
+				req.Header.Set(iapUserHeader, tc.header)
+			}
+			h.ServeHTTP(httptest.NewRecorder(), req)
+			if got != tc.want {
+				t.Fatalf("actor = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -6,6 +6,7 @@ type requestIDCtxKey string
 
 const (
 	requestIDKey requestIDCtxKey = "requestID"
+	actorKey     requestIDCtxKey = "actor"
 )
 
 func WithRequestID(ctx context.Context, id string) context.Context {
@@ -22,3 +23,20 @@ func RequestIDFromCtx(ctx context.Context) string {
 	}
 	return ""
 }
+
+// WithActor は操作者（監査ログに記録する識別子）を Context に紐付けます。
+func WithActor(ctx context.Context, actor string) context.Context {
+	if actor == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, actorKey, actor)
+}
+
+// ActorFromCtx は操作者を返します（未設定は空文字）。
+func ActorFromCtx(ctx context.Context) string {
+	v := ctx.Value(actorKey)
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return ""
+}
@@ -0,0 +1,34 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPeriodicBackupDeprecation(t *testing.T) {
+	for name, tc := range map[string]struct {
+		cfg       AppConfig
+		onWrite   bool
+		maxDelay  time.Duration
+		warnCount int
+	}{
+		"unset":             {AppConfig{}, false, 300 * time.Second, 0},
+		"periodic on":       {AppConfig{PeriodicBackup: "on", PeriodicBackupMinutes: "10"}, true, 10 * time.Minute, 2},
+		"periodic off":      {AppConfig{PeriodicBackup: "off", StorageProvider: "gcs", SqliteBucket: "b"}, true, 300 * time.Second, 1},
+		"new settings win":  {AppConfig{PeriodicBackup: "on", PeriodicBackupMinutes: "10", BackupOnWrite: "off", BackupMaxDelaySec: "60"}, false, time.Minute, 2},
+		"invalid minutes":   {AppConfig{PeriodicBackupMinutes: "x"}, false, 300 * time.Second, 1},
+		"new settings only": {AppConfig{BackupOnWrite: "on"}, true, 300 * time.Second, 0},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if got := tc.cfg.BackupOnWriteEnabled(); got != tc.onWrite {
+				t.Errorf("BackupOnWriteEnabled = %v, want %v", got, tc.onWrite)
+			}
+			if got := tc.cfg.BackupMaxDelay(); got != tc.maxDelay {
+				t.Errorf("BackupMaxDelay = %v, want %v", got, tc.maxDelay)
+			}
+			if got := tc.cfg.Deprecations(); len(got) != tc.warnCount {
+				t.Errorf("Deprecations = %q, want %d warnings", got, tc.warnCount)
+			}
+		})
+	}
+}
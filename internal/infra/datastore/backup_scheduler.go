@@ -0,0 +1,179 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/kawabatas/mini-web-app/internal/domain/model"
+	"github.com/kawabatas/mini-web-app/internal/domain/repository"
+)
+
+// AutoBackupConfig は書き込みを契機にしたバックアップの設定です。
+// 書き込みの後 Quiet の間次の書き込みが無ければスナップショットを取得します。書き込みが続いても、最初の書き込みから
+// MaxDelay 経てば取得します。Quiet が 0 なら無効です（書き込みが無いインスタンスはアップロードしない）。
+type AutoBackupConfig struct {
+	Quiet    time.Duration
+	MaxDelay time.Duration
+}
+
+// backupTimeout は 1 回のバックアップ（VACUUM INTO + アップロード）の上限です。
+const backupTimeout = 2 * time.Minute
+
+// backupScheduler は書き込みの通知をまとめてバックアップを実行します（まとまった編集でも 1 回のアップロード）。
+type backupScheduler struct {
+	cfg    AutoBackupConfig
+	backup func(ctx context.Context) error
+
+	notifyCh chan struct{}
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+func startBackupScheduler(cfg AutoBackupConfig, backup func(ctx context.Context) error) *backupScheduler {
+	if cfg.MaxDelay < cfg.Quiet {
+		cfg.MaxDelay = cfg.Quiet
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	b := &backupScheduler{
+		cfg:      cfg,
+		backup:   backup,
+		notifyCh: make(chan struct{}, 1),
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+	go b.run(ctx)
+	return b
+}
+
+// notify は書き込みがあったことを伝えます（ブロックしない）。
+func (b *backupScheduler) notify() {
+	select {
+	case b.notifyCh <- struct{}{}:
+	default:
+	}
+}
+
+// stop は保留中のバックアップを取り消し、実行中のものは中断して終了を待ちます（終了時のスナップショットは呼び出し側で取る）。
+func (b *backupScheduler) stop(ctx context.Context) {
+	b.cancel()
+	select {
+	case <-b.done:
+	case <-ctx.Done():
+	}
+}
+
+func (b *backupScheduler) run(ctx context.Context) {
+	defer close(b.done)
+	quiet := time.NewTimer(0)
+	quiet.Stop()
+	maxDelay := time.NewTimer(0)
+	maxDelay.Stop()
+	pending := false
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-b.notifyCh:
+			if !pending {
+				// バースト中の最初の書き込みから MaxDelay で打ち切る
+				pending = true
+				maxDelay.Reset(b.cfg.MaxDelay)
+			}
+			quiet.Reset(b.cfg.Quiet)
+			continue
+		case <-quiet.C:
+			maxDelay.Stop()
+		case <-maxDelay.C:
+			quiet.Stop()
+		}
+		pending = false
+		// 実行中の書き込みは notifyCh に残り、終了後に次のバックアップを予約する
+		ctxBackup, cancel := context.WithTimeout(ctx, backupTimeout)
+		slog.InfoContext(ctxBackup, "write-triggered snapshot start")
+		if err := b.backup(ctxBackup); errors.Is(err, repository.ErrReadOnly) {
+			// 書き込みリースを引き継いだ後（最後のスナップショットは引き継ぎの際に公開済み）
+			slog.DebugContext(ctxBackup, "write-triggered snapshot skipped", slog.Any("error", err))
+		} else if err != nil {
+			slog.ErrorContext(ctxBackup, "write-triggered snapshot failed", slog.Any("error", err))
+		} else {
+			slog.InfoContext(ctxBackup, "write-triggered snapshot complete")
+		}
+		cancel()
+	}
+}
+
+// 以下は書き込みを通知するリポジトリのラッパーです（WithTx はコミット後にまとめて通知する）。
+// outbox の配信状態（MarkDone など）は失っても再配信されるだけのため通知しません（配信の再試行で idle 中にアップロードしない）。
+
+type notifyingSingerRepo struct {
+	repository.SingerRepository
+	notify func()
+}
+
+func (r notifyingSingerRepo) Create(ctx context.Context, s model.Singer) (model.Singer, error) {
+	out, err := r.SingerRepository.Create(ctx, s)
+	if err == nil {
+		r.notify()
+	}
+	return out, err
+}
+
+func (r notifyingSingerRepo) Update(ctx context.Context, s model.Singer) (model.Singer, error) {
+	out, err := r.SingerRepository.Update(ctx, s)
+	if err == nil {
+		r.notify()
+	}
+	return out, err
+}
+
+func (r notifyingSingerRepo) Delete(ctx context.Context, id, version int64) error {
+	err := r.SingerRepository.Delete(ctx, id, version)
+	if err == nil {
+		r.notify()
+	}
+	return err
+}
+
+func (r notifyingSingerRepo) Restore(ctx context.Context, id int64) (model.Singer, error) {
+	out, err := r.SingerRepository.Restore(ctx, id)
+	if err == nil {
+		r.notify()
+	}
+	return out, err
+}
+
+func (r notifyingSingerRepo) Purge(ctx context.Context, before time.Time) (int64, error) {
+	n, err := r.SingerRepository.Purge(ctx, before)
+	if err == nil && n > 0 {
+		r.notify()
+	}
+	return n, err
+}
+
+type notifyingAuditRepo struct {
+	repository.AuditRepository
+	notify func()
+}
+
+func (r notifyingAuditRepo) Append(ctx context.Context, e model.AuditEntry) (model.AuditEntry, error) {
+	out, err := r.AuditRepository.Append(ctx, e)
+	if err == nil {
+		r.notify()
+	}
+	return out, err
+}
+
+type notifyingOutboxRepo struct {
+	repository.OutboxRepository
+	notify func()
+}
+
+func (r notifyingOutboxRepo) Append(ctx context.Context, e model.OutboxEvent) error {
+	err := r.OutboxRepository.Append(ctx, e)
+	if err == nil {
+		r.notify()
+	}
+	return err
+}
@@ -2,36 +2,131 @@ package datastore
 
 import (
 	"context"
+	"errors"
 
 	"github.com/kawabatas/mini-web-app/internal/domain/repository"
+	sqlitedriver "github.com/kawabatas/mini-web-app/internal/infra/datastore/sqlite"
 )
 
+// Repositories はリポジトリへのアクセサの集合です。
+// DataStore 本体とトランザクション内（WithTx の引数）で同じ形で利用できます。
+type Repositories interface {
+	Singers() repository.SingerRepository
+	Audit() repository.AuditRepository
+	Outbox() repository.OutboxRepository
+}
+
 // DataStore is an app-facing facade for all repositories.
 type DataStore interface {
 	Ping(ctx context.Context) error
 	Close(ctx context.Context) error
-	// SetConnPool は接続プール設定を適用します。
+	// SetConnPool は（読み取り用の）接続プール設定を適用します。
 	SetConnPool(maxOpen, maxIdle int)
 	// Backup triggers a DB snapshot without closing connections.
+	// 前回のスナップショットから変更が無ければ何もしません（SQLite）。
 	Backup(ctx context.Context) error
 
+	// WithTx は fn を 1 トランザクションで実行します。
+	// fn が nil を返せばコミット、エラー / panic ならロールバックします。
+	// ロック競合（SQLITE_BUSY など）時は fn ごと再実行されることがあります。
+	// fn 内では引数 tx のリポジトリのみを使用すること（外側の DataStore を使うと書き込み接続を奪い合いデッドロックします）。
+	// 書き込みを受け付けていない（WriteGate）場合は repository.ErrReadOnly を返します。
+	WithTx(ctx context.Context, fn func(tx Repositories) error) error
+
 	// 個別の実装
-	Singers() repository.SingerRepository
+	Repositories
+}
+
+// SnapshotInfo は復元に使える保管済みスナップショットです。
+type SnapshotInfo = sqlitedriver.SnapshotInfo
+
+// ErrSnapshotUnsupported はスナップショットからの復元に対応していない構成であることを表します。
+var ErrSnapshotUnsupported = errors.New("snapshot restore is not supported by this datastore")
+
+// SnapshotRestorer はオブジェクトストレージに保管したスナップショットからの復元に対応した DataStore です。
+// 対応するのは SQLite + スナップショット同期（GCSSnapshotStrategy）の構成のみです。
+type SnapshotRestorer interface {
+	// ListSnapshots は保管済みのスナップショットを古い順に返します。
+	ListSnapshots(ctx context.Context) ([]SnapshotInfo, error)
+	// RestoreSnapshot はスナップショット key をダウンロード・検証し、業務データ（歌手）をその時点の内容に置き換えます。
+	// 置き換えと fn は 1 トランザクションで実行し、コミット後に current へ二相アップロードします。
+	// 監査ログと outbox は履歴として残すため置き換えません。dryRun の場合は検証のみ行います。
+	RestoreSnapshot(ctx context.Context, key string, dryRun bool, fn func(tx Repositories) error) (SnapshotInfo, error)
+}
+
+// HeldSnapshot は公開前の検査に失敗し、current への公開を止める原因となったスナップショットです。
+type HeldSnapshot = sqlitedriver.HeldSnapshot
+
+// SnapshotAcceptor は公開前の検査に失敗したスナップショットの公開を、明示的に受け入れられる DataStore です（SQLite のみ）。
+// 検査に失敗すると、受け入れるまで以降のスナップショットも current に公開せず quarantine/ に保管します。
+type SnapshotAcceptor interface {
+	// PublishHold は current への公開を止めていれば、その原因を返します。
+	PublishHold() (HeldSnapshot, bool)
+	// AcceptSnapshot は行数の比較を省いて current に公開し、公開の停止を解除します。
+	// key が空なら現在の DB を公開します。quarantine/ のキーなら DB 全体をその内容で置き換えてから公開します
+	// （前のインスタンスが公開を止めたまま終了した場合。起動後の書き込みは失われます）。
+	// fn は置き換え（key が空なら fn のみ）と同じトランザクションで実行します。
+	AcceptSnapshot(ctx context.Context, key string, fn func(tx Repositories) error) error
+}
+
+// StartupReport は起動時の DB の復元元です。
+type StartupReport = sqlitedriver.StartupReport
+
+// StartupReporter は起動時の DB の復元元を報告できる DataStore です（SQLite のみ）。
+type StartupReporter interface {
+	StartupReport() StartupReport
+}
+
+// WriteGate は書き込みリースを保持している間だけ書き込みを受け付ける DataStore です（SQLite のみ）。
+// 受け付けていない間は WithTx も、本体のリポジトリの書き込み（Create・MarkDone など）も repository.ErrReadOnly を返します。
+type WriteGate interface {
+	// Writable は書き込みを受け付けているかを返します（リースの延長が止まっていれば、その場で延長してから判定する）。
+	Writable(ctx context.Context) bool
 }
 
 // Config captures DB driver and DSN-like parameters.
 type Config struct {
-	Driver   string // e.g. "sqlite" (default)
-	Source   string // extra hint for path decisions (e.g., "gcs")
+	Driver   string // e.g. "sqlite" (default) | "postgres" | "memory"
+	Source   string // extra hint for path decisions (e.g., "gcs", ":memory:")
+	DSN      string // postgres 接続文字列
 	Strategy SnapshotStrategy
+	// AutoBackup は書き込みを契機にしたバックアップの設定です（SQLite のみ。ゼロ値は無効）。
+	AutoBackup AutoBackupConfig
+	// Lease は書き込みリースです（SQLite のみ。nil なら常に書き込みを受け付ける）。
+	// 保持していない間は読み取り専用で動作し、書き込みは ErrReadOnly、終了時のスナップショットも公開しません。
+	Lease *sqlitedriver.Lease
+	// Handover は起動時にリースを取得できなければ、保持者に引き継ぎを依頼します（サーバのみ。CLI は依頼しない。Lease が nil なら無視）。
+	// 保持者は書き込みを止めて最後のスナップショットを公開してからリースを渡し、受け取った側はその世代を取り込んでから書き込みます。
+	Handover bool
+	// Seed はインメモリ DB を開いた直後に 1 トランザクションで実行されます（テストのフィクスチャ投入用）。
+	Seed SeedFunc
 }
 
+// SeedFunc はフィクスチャ投入処理です。
+type SeedFunc func(ctx context.Context, tx Repositories) error
+
+// MemorySource は Config.Source に指定するとインメモリ SQLite を使用します。
+const MemorySource = ":memory:"
+
 // Open selects and opens a datastore by driver.
 func Open(ctx context.Context, cfg Config) (DataStore, error) {
+	if cfg.Source == MemorySource {
+		return openMemory(ctx, cfg)
+	}
 	switch cfg.Driver {
 	case "sqlite":
 		return openSQLite(ctx, cfg)
+	case "postgres":
+		return openPostgres(ctx, cfg)
+	case "memory":
+		return openMemory(ctx, cfg)
 	default:
 		return openSQLite(ctx, cfg)
 	}
 }
+
+// OpenMemory はフィクスチャ seed（nil 可）を投入したインメモリ DataStore を返します。
+// ディスクに触れずに usecase / ハンドラを検証するためのものです。
+func OpenMemory(ctx context.Context, seed SeedFunc) (DataStore, error) {
+	return openMemory(ctx, Config{Driver: "memory", Seed: seed})
+}
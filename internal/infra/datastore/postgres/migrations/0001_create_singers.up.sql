@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS singers (
+  id BIGSERIAL PRIMARY KEY,
+  name TEXT NOT NULL,
+  genre TEXT NOT NULL,
+  debut_year INTEGER NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1,2 @@
+-- 楽観的排他制御用のバージョン（更新のたびに +1）
+ALTER TABLE singers ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
@@ -0,0 +1,5 @@
+-- 論理削除: deleted_at が NULL でない行は削除済み（一定期間後に物理削除）
+ALTER TABLE singers ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+-- 物理削除（パージ）対象の検索用
+CREATE INDEX IF NOT EXISTS singers_deleted_at_idx ON singers(deleted_at) WHERE deleted_at IS NOT NULL;
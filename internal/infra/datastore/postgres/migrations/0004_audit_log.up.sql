@@ -0,0 +1,16 @@
+-- データ変更の監査ログ（変更と同じトランザクションで追記する）
+CREATE TABLE IF NOT EXISTS audit_log (
+  id BIGSERIAL PRIMARY KEY,
+  at TIMESTAMPTZ NOT NULL,
+  actor TEXT NOT NULL,
+  request_id TEXT NOT NULL DEFAULT '',
+  entity TEXT NOT NULL,
+  entity_id BIGINT,
+  action TEXT NOT NULL,
+  before_json JSONB,
+  after_json JSONB,
+  diff_json JSONB
+);
+CREATE INDEX IF NOT EXISTS audit_log_entity_idx ON audit_log(entity, entity_id);
+CREATE INDEX IF NOT EXISTS audit_log_actor_idx ON audit_log(actor);
+CREATE INDEX IF NOT EXISTS audit_log_at_idx ON audit_log(at);
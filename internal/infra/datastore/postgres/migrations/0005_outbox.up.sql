@@ -0,0 +1,13 @@
+-- ドメインイベントの送信待ちキュー（変更と同じトランザクションで追記し、ディスパッチャが配信する）
+CREATE TABLE IF NOT EXISTS outbox (
+  id BIGSERIAL PRIMARY KEY,
+  event_type TEXT NOT NULL,
+  payload JSONB NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL,
+  attempts INTEGER NOT NULL DEFAULT 0,
+  next_attempt_at TIMESTAMPTZ NOT NULL,
+  last_error TEXT NOT NULL DEFAULT '',
+  done_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS outbox_pending_idx ON outbox(next_attempt_at, id) WHERE done_at IS NULL;
+CREATE INDEX IF NOT EXISTS outbox_done_idx ON outbox(done_at) WHERE done_at IS NOT NULL;
@@ -0,0 +1,70 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/kawabatas/mini-web-app/internal/domain/model"
+)
+
+// OutboxRepo は outbox テーブルのリポジトリです。
+type OutboxRepo struct{ db dbtx }
+
+func NewOutboxRepo(db *sql.DB) *OutboxRepo { return &OutboxRepo{db: db} }
+
+// NewOutboxRepoTx はトランザクションに束縛された OutboxRepo を返します。
+func NewOutboxRepoTx(tx *sql.Tx) *OutboxRepo { return &OutboxRepo{db: tx} }
+
+func (r *OutboxRepo) Append(ctx context.Context, e model.OutboxEvent) error {
+	_, err := r.db.ExecContext(ctx, `
+INSERT INTO outbox(event_type, payload, created_at, next_attempt_at) VALUES ($1, $2, $3, $3)`,
+		e.Type, string(e.Payload), e.CreatedAt)
+	return err
+}
+
+func (r *OutboxRepo) Pending(ctx context.Context, now time.Time, limit int) ([]model.OutboxEvent, error) {
+	rows, err := r.db.QueryContext(ctx, `
+SELECT id, event_type, payload::text, created_at, attempts
+FROM outbox
+WHERE done_at IS NULL AND next_attempt_at <= $1
+ORDER BY id ASC
+LIMIT $2`, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []model.OutboxEvent
+	for rows.Next() {
+		var (
+			e       model.OutboxEvent
+			payload string
+		)
+		if err := rows.Scan(&e.ID, &e.Type, &payload, &e.CreatedAt, &e.Attempts); err != nil {
+			return nil, err
+		}
+		e.Payload = []byte(payload)
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+func (r *OutboxRepo) MarkDone(ctx context.Context, id int64, at time.Time) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE outbox SET done_at = $1, attempts = attempts + 1, last_error = '' WHERE id = $2`, at, id)
+	return err
+}
+
+func (r *OutboxRepo) MarkFailed(ctx context.Context, id int64, errMsg string, next time.Time) error {
+	_, err := r.db.ExecContext(ctx, `
+UPDATE outbox SET attempts = attempts + 1, last_error = $1, next_attempt_at = $2
+WHERE id = $3`, errMsg, next, id)
+	return err
+}
+
+func (r *OutboxRepo) DeleteDone(ctx context.Context, before time.Time) (int64, error) {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM outbox WHERE done_at IS NOT NULL AND done_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,261 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/kawabatas/mini-web-app/internal/domain/model"
+	"github.com/kawabatas/mini-web-app/internal/domain/repository"
+	"github.com/kawabatas/mini-web-app/internal/infra/datastore/sqlq"
+	"github.com/kawabatas/mini-web-app/internal/util/clock"
+)
+
+// dbtx は *sql.DB / *sql.Tx の共通部分です。
+type dbtx interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+type SingerRepo struct{ db dbtx }
+
+func NewSingerRepo(db *sql.DB) *SingerRepo { return &SingerRepo{db: db} }
+
+// NewSingerRepoTx はトランザクションに束縛された SingerRepo を返します。
+func NewSingerRepoTx(tx *sql.Tx) *SingerRepo { return &SingerRepo{db: tx} }
+
+const singerColumns = `id, name, genre, debut_year, created_at, version, deleted_at`
+
+func (r *SingerRepo) List(ctx context.Context, q repository.SingerListQuery) ([]model.Singer, error) {
+	if q.Limit <= 0 {
+		return nil, fmt.Errorf("invalid limit: %d", q.Limit)
+	}
+	orders, err := singerOrders(q.Sort)
+	if err != nil {
+		return nil, err
+	}
+	conds := singerConds(q.Filter)
+	var backward bool
+	if q.After != nil {
+		vals, err := singerKeyValues(q.Sort, q.After)
+		if err != nil {
+			return nil, err
+		}
+		backward = q.After.Backward
+		cond, args := sqlq.Keyset(orders, vals, backward)
+		conds.Add(cond, args...)
+	}
+	rows, err := r.db.QueryContext(ctx, sqlq.Rebind(`
+SELECT `+singerColumns+`
+FROM singers
+`+conds.Where()+`
+ORDER BY `+sqlq.OrderBy(orders, backward)+`
+LIMIT ?
+`), append(conds.Args(), q.Limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []model.Singer
+	for rows.Next() {
+		s, err := scanSinger(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+func (r *SingerRepo) Count(ctx context.Context, filter repository.SingerFilter) (int, error) {
+	conds := singerConds(filter)
+	var n int
+	err := r.db.QueryRowContext(ctx, sqlq.Rebind(`SELECT COUNT(1) FROM singers `+conds.Where()), conds.Args()...).Scan(&n)
+	return n, err
+}
+
+func (r *SingerRepo) Get(ctx context.Context, id int64) (model.Singer, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT `+singerColumns+` FROM singers WHERE id = $1 AND deleted_at IS NULL`, id)
+	return scanSingerRow(row)
+}
+
+func (r *SingerRepo) Create(ctx context.Context, s model.Singer) (model.Singer, error) {
+	row := r.db.QueryRowContext(ctx, `
+INSERT INTO singers(name, genre, debut_year) VALUES ($1, $2, $3)
+RETURNING `+singerColumns,
+		s.Name, s.Genre, s.DebutYear)
+	return scanSingerRow(row)
+}
+
+func (r *SingerRepo) Update(ctx context.Context, s model.Singer) (model.Singer, error) {
+	row := r.db.QueryRowContext(ctx, `
+UPDATE singers SET name = $1, genre = $2, debut_year = $3, version = version + 1
+WHERE id = $4 AND version = $5 AND deleted_at IS NULL
+RETURNING `+singerColumns,
+		s.Name, s.Genre, s.DebutYear, s.ID, s.Version)
+	out, err := scanSingerRow(row)
+	if errors.Is(err, repository.ErrNotFound) {
+		return model.Singer{}, r.missReason(ctx, s.ID)
+	}
+	return out, err
+}
+
+// Delete は deleted_at を設定して論理削除します（バージョンも +1）。
+func (r *SingerRepo) Delete(ctx context.Context, id, version int64) error {
+	res, err := r.db.ExecContext(ctx, `
+UPDATE singers SET deleted_at = $1, version = version + 1
+WHERE id = $2 AND version = $3 AND deleted_at IS NULL`,
+		clock.Now(), id, version)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return r.missReason(ctx, id)
+	}
+	return nil
+}
+
+func (r *SingerRepo) Restore(ctx context.Context, id int64) (model.Singer, error) {
+	row := r.db.QueryRowContext(ctx, `
+UPDATE singers SET deleted_at = NULL, version = version + 1
+WHERE id = $1 AND deleted_at IS NOT NULL
+RETURNING `+singerColumns, id)
+	return scanSingerRow(row)
+}
+
+func (r *SingerRepo) Purge(ctx context.Context, before time.Time) (int64, error) {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM singers WHERE deleted_at IS NOT NULL AND deleted_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// missReason はバージョン付きの更新・削除が 0 件だった理由を判定します。
+// 未削除のレコードが存在すればバージョン不一致（ErrVersionConflict）、無ければ ErrNotFound。
+func (r *SingerRepo) missReason(ctx context.Context, id int64) error {
+	var one int
+	err := r.db.QueryRowContext(ctx, `SELECT 1 FROM singers WHERE id = $1 AND deleted_at IS NULL`, id).Scan(&one)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return repository.ErrNotFound
+	case err != nil:
+		return err
+	}
+	return repository.ErrVersionConflict
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSinger(row rowScanner) (model.Singer, error) {
+	var (
+		s         model.Singer
+		deletedAt sql.NullTime
+	)
+	err := row.Scan(&s.ID, &s.Name, &s.Genre, &s.DebutYear, &s.CreatedAt, &s.Version, &deletedAt)
+	if deletedAt.Valid {
+		s.DeletedAt = &deletedAt.Time
+	}
+	return s, err
+}
+
+// scanSingerRow は単一行の結果を読み取り、PostgreSQL のエラーをリポジトリのエラーに変換します。
+func scanSingerRow(row *sql.Row) (model.Singer, error) {
+	s, err := scanSinger(row)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return model.Singer{}, repository.ErrNotFound
+	case isUniqueErr(err):
+		return model.Singer{}, fmt.Errorf("%w: %v", repository.ErrConflict, err)
+	case err != nil:
+		return model.Singer{}, err
+	}
+	return s, nil
+}
+
+// singerConds は絞り込み条件をパラメータ化した WHERE 条件に変換します。
+func singerConds(f repository.SingerFilter) *sqlq.Conds {
+	var c sqlq.Conds
+	if !f.IncludeDeleted {
+		c.Add("deleted_at IS NULL")
+	}
+	if f.Genre != nil {
+		c.Add("genre = ?", *f.Genre)
+	}
+	for _, x := range []struct {
+		op string
+		v  *int
+	}{{"=", f.DebutYear.Eq}, {">", f.DebutYear.Gt}, {">=", f.DebutYear.Gte}, {"<", f.DebutYear.Lt}, {"<=", f.DebutYear.Lte}} {
+		if x.v != nil {
+			c.Add("debut_year "+x.op+" ?", *x.v)
+		}
+	}
+	for _, x := range []struct {
+		op string
+		v  *time.Time
+	}{{">", f.CreatedAt.Gt}, {">=", f.CreatedAt.Gte}, {"<", f.CreatedAt.Lt}, {"<=", f.CreatedAt.Lte}} {
+		if x.v != nil {
+			c.Add("created_at "+x.op+" ?", *x.v)
+		}
+	}
+	return &c
+}
+
+// singerSortColumns はソート可能なフィールドと列の対応です（ORDER BY に埋め込むためのホワイトリスト）。
+var singerSortColumns = map[string]string{
+	repository.SingerFieldName:      "name",
+	repository.SingerFieldGenre:     "genre",
+	repository.SingerFieldDebutYear: "debut_year",
+	repository.SingerFieldCreatedAt: "created_at",
+}
+
+// singerOrders はソート指定を列の並びに変換し、末尾に id 昇順を付けます。
+func singerOrders(sort []repository.SortField) ([]sqlq.Order, error) {
+	orders := make([]sqlq.Order, 0, len(sort)+1)
+	for _, f := range sort {
+		col, ok := singerSortColumns[f.Field]
+		if !ok {
+			return nil, fmt.Errorf("unsupported sort field: %q", f.Field)
+		}
+		orders = append(orders, sqlq.Order{Column: col, Desc: f.Desc})
+	}
+	return append(orders, sqlq.Order{Column: "id"}), nil
+}
+
+// singerKeyValues はキーセットの文字列表現を列の型の値に変換します（末尾は id）。
+func singerKeyValues(sort []repository.SortField, k *repository.Keyset) ([]any, error) {
+	if len(k.Values) != len(sort) {
+		return nil, fmt.Errorf("keyset has %d values for %d sort fields", len(k.Values), len(sort))
+	}
+	vals := make([]any, 0, len(sort)+1)
+	for i, f := range sort {
+		v, err := singerFieldValue(f.Field, k.Values[i])
+		if err != nil {
+			return nil, err
+		}
+		vals = append(vals, v)
+	}
+	return append(vals, k.ID), nil
+}
+
+// singerFieldValue はフィールド値の文字列表現を PostgreSQL にバインドする値に変換します。
+func singerFieldValue(field, v string) (any, error) {
+	switch field {
+	case repository.SingerFieldDebutYear:
+		return strconv.Atoi(v)
+	case repository.SingerFieldCreatedAt:
+		return time.Parse(time.RFC3339Nano, v)
+	default:
+		return v, nil
+	}
+}
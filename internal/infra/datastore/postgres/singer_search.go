@@ -0,0 +1,94 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/kawabatas/mini-web-app/internal/domain/model"
+	"github.com/kawabatas/mini-web-app/internal/domain/repository"
+	"github.com/kawabatas/mini-web-app/internal/infra/datastore/sqlq"
+)
+
+// searchOrders は検索結果の並び順です（関連度の高い順、同点は id 昇順）。
+var searchOrders = []sqlq.Order{{Column: "score", Desc: true}, {Column: "id"}}
+
+// Search は name / genre の ILIKE による部分一致で検索します。
+// 小規模データを前提に索引は用いず、name に一致した語の数を Score として name の一致を優先します。
+func (r *SingerRepo) Search(ctx context.Context, q repository.SingerSearchQuery) ([]model.SingerHit, error) {
+	if q.Limit <= 0 {
+		return nil, fmt.Errorf("invalid limit: %d", q.Limit)
+	}
+	terms := strings.Fields(q.Query)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+	var (
+		conds, scores       []string
+		condArgs, scoreArgs []any
+	)
+	for _, term := range terms {
+		like := "%" + escapeLike(term) + "%"
+		conds = append(conds, `(name ILIKE ? OR genre ILIKE ?)`)
+		condArgs = append(condArgs, like, like)
+		scores = append(scores, `(name ILIKE ?)::int`)
+		scoreArgs = append(scoreArgs, like)
+	}
+	conds = append(conds, `deleted_at IS NULL`)
+
+	// score は算出列のため、キーセットの比較は副問い合わせの外側で行う
+	var (
+		outer    sqlq.Conds
+		backward bool
+	)
+	if q.After != nil {
+		score, err := searchScore(q.After)
+		if err != nil {
+			return nil, err
+		}
+		backward = q.After.Backward
+		cond, kargs := sqlq.Keyset(searchOrders, []any{score, q.After.ID}, backward)
+		outer.Add(cond, kargs...)
+	}
+	// 未削除の行のみのため deleted_at は取得しない（singerColumns とは列が異なる）
+	query := sqlq.Rebind(`
+SELECT id, name, genre, debut_year, created_at, version, score
+FROM (
+  SELECT id, name, genre, debut_year, created_at, version, (` + strings.Join(scores, " + ") + `)::float8 AS score
+  FROM singers
+  WHERE ` + strings.Join(conds, "\n    AND ") + `
+) AS hits
+` + outer.Where() + `
+ORDER BY ` + sqlq.OrderBy(searchOrders, backward) + `
+LIMIT ?`)
+	args := append(append(append(scoreArgs, condArgs...), outer.Args()...), q.Limit)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []model.SingerHit
+	for rows.Next() {
+		var h model.SingerHit
+		if err := rows.Scan(&h.ID, &h.Name, &h.Genre, &h.DebutYear, &h.CreatedAt, &h.Version, &h.Score); err != nil {
+			return nil, err
+		}
+		out = append(out, h)
+	}
+	return out, rows.Err()
+}
+
+// searchScore はキーセットの Score の文字列表現を float64 に変換します。
+func searchScore(k *repository.Keyset) (float64, error) {
+	if len(k.Values) != 1 {
+		return 0, fmt.Errorf("keyset has %d values for the search score", len(k.Values))
+	}
+	return strconv.ParseFloat(k.Values[0], 64)
+}
+
+// escapeLike は LIKE のワイルドカードをエスケープします（PostgreSQL の既定のエスケープ文字は '\'）。
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,20 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/kawabatas/mini-web-app/internal/infra/datastore/sqlrun"
+)
+
+// txRunner は直列化失敗・デッドロックの場合にトランザクションを再実行します。
+var txRunner = sqlrun.TxRunner{Retryable: isRetryableErr}
+
+// RunInTx は db 上で fn を 1 トランザクションとして実行します。
+//
+//   - fn が nil を返せばコミット、エラーを返すか panic した場合はロールバックします（panic は再送出）。
+//   - 直列化失敗・デッドロックの場合は、短いバックオフ付きで fn ごと再実行します。
+//     そのため fn は再実行されても問題ない（DB 以外に副作用を持たない）ように書くこと。
+func RunInTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	return txRunner.Run(ctx, db, fn)
+}
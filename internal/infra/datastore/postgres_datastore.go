@@ -0,0 +1,98 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+
+	"github.com/kawabatas/mini-web-app/internal/domain/repository"
+	pgdriver "github.com/kawabatas/mini-web-app/internal/infra/datastore/postgres"
+)
+
+type postgresStore struct {
+	db       *sql.DB
+	strategy SnapshotStrategy
+
+	singer repository.SingerRepository
+	audit  repository.AuditRepository
+	outbox repository.OutboxRepository
+}
+
+func (s *postgresStore) Ping(ctx context.Context) error { return s.db.PingContext(ctx) }
+func (s *postgresStore) Close(ctx context.Context) error {
+	if s.strategy != nil {
+		if err := s.strategy.OnShutdown(ctx, ""); err != nil {
+			slog.ErrorContext(ctx, "snapshot shutdown failed", slog.Any("error", err))
+		}
+	}
+	return s.db.Close()
+}
+
+// SetConnPool は PostgreSQL の接続プール設定を適用します。
+func (s *postgresStore) SetConnPool(maxOpen, maxIdle int) {
+	if maxOpen > 0 {
+		s.db.SetMaxOpenConns(maxOpen)
+	}
+	if maxIdle >= 0 {
+		s.db.SetMaxIdleConns(maxIdle)
+	}
+}
+
+// Backup は Strategy に委譲します。既定（NoopSnapshotStrategy）では何もしません。
+// PostgreSQL のバックアップはマネージドサービス側（PITR 等）で行う前提です。
+func (s *postgresStore) Backup(ctx context.Context) error {
+	if s.strategy != nil {
+		if b, ok := any(s.strategy).(backupCapable); ok {
+			return b.OnBackup(ctx, "")
+		}
+	}
+	slog.InfoContext(ctx, "backup skipped: managed by postgres")
+	return nil
+}
+
+func openPostgres(ctx context.Context, cfg Config) (DataStore, error) {
+	strat := cfg.Strategy
+	if strat == nil {
+		strat = NoopSnapshotStrategy{}
+	}
+	if err := strat.OnStartup(ctx, ""); err != nil {
+		return nil, err
+	}
+	db, err := pgdriver.OpenAndInit(ctx, cfg.DSN)
+	if err != nil {
+		return nil, err
+	}
+	return &postgresStore{
+		db:       db,
+		strategy: strat,
+		singer:   pgdriver.NewSingerRepo(db),
+		audit:    pgdriver.NewAuditRepo(db),
+		outbox:   pgdriver.NewOutboxRepo(db),
+	}, nil
+}
+
+func (s *postgresStore) Singers() repository.SingerRepository { return s.singer }
+func (s *postgresStore) Audit() repository.AuditRepository    { return s.audit }
+func (s *postgresStore) Outbox() repository.OutboxRepository  { return s.outbox }
+
+// WithTx はトランザクションに束縛したリポジトリで fn を実行します。
+func (s *postgresStore) WithTx(ctx context.Context, fn func(tx Repositories) error) error {
+	return pgdriver.RunInTx(ctx, s.db, func(tx *sql.Tx) error {
+		return fn(postgresTxRepos{
+			singer: pgdriver.NewSingerRepoTx(tx),
+			audit:  pgdriver.NewAuditRepoTx(tx),
+			outbox: pgdriver.NewOutboxRepoTx(tx),
+		})
+	})
+}
+
+// postgresTxRepos はトランザクションに束縛されたリポジトリの集合です。
+type postgresTxRepos struct {
+	singer repository.SingerRepository
+	audit  repository.AuditRepository
+	outbox repository.OutboxRepository
+}
+
+func (r postgresTxRepos) Singers() repository.SingerRepository { return r.singer }
+func (r postgresTxRepos) Audit() repository.AuditRepository    { return r.audit }
+func (r postgresTxRepos) Outbox() repository.OutboxRepository  { return r.outbox }
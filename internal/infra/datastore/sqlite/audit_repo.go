@@ -0,0 +1,128 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/kawabatas/mini-web-app/internal/domain/model"
+	"github.com/kawabatas/mini-web-app/internal/domain/repository"
+	"github.com/kawabatas/mini-web-app/internal/infra/datastore/sqlq"
+)
+
+// AuditRepo は監査ログのリポジトリです。SingerRepo と同様に参照系を r、追記を w に振り分けます。
+type AuditRepo struct{ r, w dbtx }
+
+func NewAuditRepo(c *Conns) *AuditRepo { return &AuditRepo{r: c.Reader, w: c.Writer} }
+
+// NewAuditRepoTx はトランザクションに束縛された AuditRepo を返します。
+func NewAuditRepoTx(tx *sql.Tx) *AuditRepo { return &AuditRepo{r: tx, w: tx} }
+
+const auditColumns = `id, at, actor, request_id, entity, entity_id, action, before_json, after_json, diff_json`
+
+// auditOrders は監査ログの並び順（新しい順）です。
+var auditOrders = []sqlq.Order{{Column: "id", Desc: true}}
+
+func (r *AuditRepo) Append(ctx context.Context, e model.AuditEntry) (model.AuditEntry, error) {
+	row := r.w.QueryRowContext(ctx, `
+INSERT INTO audit_log(at, actor, request_id, entity, entity_id, action, before_json, after_json, diff_json)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+RETURNING `+auditColumns,
+		timestampText(e.At), e.Actor, e.RequestID, e.Entity, nullID(e.EntityID), e.Action,
+		nullJSON(e.Before), nullJSON(e.After), nullJSON(e.Diff))
+	return scanAudit(row)
+}
+
+func (r *AuditRepo) List(ctx context.Context, q repository.AuditListQuery) ([]model.AuditEntry, error) {
+	if q.Limit <= 0 {
+		return nil, fmt.Errorf("invalid limit: %d", q.Limit)
+	}
+	conds := auditConds(q.Filter)
+	var backward bool
+	if q.After != nil {
+		backward = q.After.Backward
+		cond, args := sqlq.Keyset(auditOrders, []any{q.After.ID}, backward)
+		conds.Add(cond, args...)
+	}
+	rows, err := r.r.QueryContext(ctx, `
+SELECT `+auditColumns+`
+FROM audit_log
+`+conds.Where()+`
+ORDER BY `+sqlq.OrderBy(auditOrders, backward)+`
+LIMIT ?
+`, append(conds.Args(), q.Limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []model.AuditEntry
+	for rows.Next() {
+		e, err := scanAudit(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+func (r *AuditRepo) Count(ctx context.Context, filter repository.AuditFilter) (int, error) {
+	conds := auditConds(filter)
+	var n int
+	err := r.r.QueryRowContext(ctx, `SELECT COUNT(1) FROM audit_log `+conds.Where(), conds.Args()...).Scan(&n)
+	return n, err
+}
+
+func scanAudit(row rowScanner) (model.AuditEntry, error) {
+	var (
+		e                   model.AuditEntry
+		entityID            sql.NullInt64
+		before, after, diff sql.NullString
+	)
+	if err := row.Scan(&e.ID, &e.At, &e.Actor, &e.RequestID, &e.Entity, &entityID, &e.Action, &before, &after, &diff); err != nil {
+		return model.AuditEntry{}, err
+	}
+	e.EntityID = entityID.Int64
+	e.Before, e.After, e.Diff = rawJSON(before), rawJSON(after), rawJSON(diff)
+	return e, nil
+}
+
+// auditConds は絞り込み条件をパラメータ化した WHERE 条件に変換します。
+func auditConds(f repository.AuditFilter) *sqlq.Conds {
+	var c sqlq.Conds
+	if f.Entity != nil {
+		c.Add("entity = ?", *f.Entity)
+	}
+	if f.EntityID != nil {
+		c.Add("entity_id = ?", *f.EntityID)
+	}
+	if f.Actor != nil {
+		c.Add("actor = ?", *f.Actor)
+	}
+	for _, x := range []struct {
+		op string
+		v  *time.Time
+	}{{">", f.At.Gt}, {">=", f.At.Gte}, {"<", f.At.Lt}, {"<=", f.At.Lte}} {
+		if x.v != nil {
+			c.Add("at "+x.op+" ?", timestampText(*x.v))
+		}
+	}
+	return &c
+}
+
+// nullID は 0 を NULL として保存します。
+func nullID(id int64) sql.NullInt64 { return sql.NullInt64{Int64: id, Valid: id != 0} }
+
+// nullJSON は空の JSON を NULL として保存します。
+func nullJSON(b json.RawMessage) sql.NullString {
+	return sql.NullString{String: string(b), Valid: len(b) > 0}
+}
+
+func rawJSON(s sql.NullString) json.RawMessage {
+	if !s.Valid {
+		return nil
+	}
+	return json.RawMessage(s.String)
+}
@@ -0,0 +1,35 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+)
+
+// ChangeMark は書き込み接続のある時点での変更数です。2 つの ChangeMark が等しければ、その間に DB は変更されていません。
+//
+// 書き込みは 1 本に固定した Writer の接続に直列化されるため、その接続の total_changes() がすべての書き込みを数えます。
+// 接続が張り直されると数え直しになるため、接続そのものも比較します（張り直し後は常に「変更あり」）。
+type ChangeMark struct {
+	conn    any
+	changes int64
+}
+
+// WriterChangeMark は Writer の現在の ChangeMark を返します。
+func WriterChangeMark(ctx context.Context, w *sql.DB) (ChangeMark, error) {
+	conn, err := w.Conn(ctx)
+	if err != nil {
+		return ChangeMark{}, err
+	}
+	defer conn.Close()
+	var m ChangeMark
+	if err := conn.Raw(func(dc any) error {
+		m.conn = dc
+		return nil
+	}); err != nil {
+		return ChangeMark{}, err
+	}
+	if err := conn.QueryRowContext(ctx, `SELECT total_changes()`).Scan(&m.changes); err != nil {
+		return ChangeMark{}, err
+	}
+	return m, nil
+}
@@ -0,0 +1,60 @@
+package sqlite
+
+import (
+	"context"
+	"testing"
+)
+
+func TestWriterChangeMark(t *testing.T) {
+	ctx := context.Background()
+	for name, tc := range map[string]struct {
+		// between は 2 つの ChangeMark の間に行う操作です
+		between     func(t *testing.T, conns *Conns)
+		wantChanged bool
+	}{
+		"nothing": {between: func(t *testing.T, conns *Conns) {}},
+		"read on the writer": {
+			between: func(t *testing.T, conns *Conns) {
+				var n int
+				if err := conns.Writer.QueryRowContext(ctx, `SELECT COUNT(1) FROM singers`).Scan(&n); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		"update matching no rows": {
+			between: func(t *testing.T, conns *Conns) {
+				if _, err := conns.Writer.ExecContext(ctx, `UPDATE singers SET name = name WHERE id = -1`); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		"write": {
+			between:     func(t *testing.T, conns *Conns) { createSinger(t, conns, "Adele") },
+			wantChanged: true,
+		},
+		"writer reconnected": {
+			between: func(t *testing.T, conns *Conns) {
+				// アイドルの接続を閉じさせ、次の Conn で張り直させる
+				conns.Writer.SetMaxIdleConns(0)
+				conns.Writer.SetMaxIdleConns(1)
+			},
+			wantChanged: true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			conns, _ := openTestDB(t)
+			before, err := WriterChangeMark(ctx, conns.Writer)
+			if err != nil {
+				t.Fatalf("WriterChangeMark: %v", err)
+			}
+			tc.between(t, conns)
+			after, err := WriterChangeMark(ctx, conns.Writer)
+			if err != nil {
+				t.Fatalf("WriterChangeMark: %v", err)
+			}
+			if changed := before != after; changed != tc.wantChanged {
+				t.Fatalf("changed = %v, want %v (%+v -> %+v)", changed, tc.wantChanged, before, after)
+			}
+		})
+	}
+}
@@ -0,0 +1,341 @@
+package sqlite
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	storageif "github.com/kawabatas/mini-web-app/internal/infra/storage"
+	"github.com/kawabatas/mini-web-app/internal/util/clock"
+)
+
+// LeaseObject は書き込みリースのオブジェクト名です（バケット直下）。
+const LeaseObject = "lease.json"
+
+// HandoverObject は書き込みリースの引き継ぎ依頼のオブジェクト名です（バケット直下）。
+const HandoverObject = "handover.json"
+
+var (
+	// ErrLeaseHeld は書き込みリースを他のインスタンスが保持していることを表します。
+	ErrLeaseHeld = errors.New("write lease is held by another instance")
+	// ErrLeaseLost は保持していた書き込みリースを他のインスタンスに取られたことを表します。
+	ErrLeaseLost = errors.New("write lease was taken over by another instance")
+)
+
+// LeaseRecord は書き込みリースのオブジェクトの内容です。
+type LeaseRecord struct {
+	Holder     string    `json:"holder"`
+	AcquiredAt time.Time `json:"acquired_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	// HandoverTo は引き継ぎ先です（解放時のみ）。期限までは引き継ぎ先以外は取得できません。
+	HandoverTo string `json:"handover_to,omitempty"`
+	// Published は解放した保持者が最後に公開した current の世代番号です（解放時のみ。0 は不明）。
+	Published int64 `json:"published_generation,omitempty"`
+}
+
+// HandoverRequest は書き込みリースの引き継ぎ依頼です。
+type HandoverRequest struct {
+	Requester   string    `json:"requester"`
+	RequestedAt time.Time `json:"requested_at"`
+}
+
+// Lease はオブジェクトストレージ上の書き込みリースです。書き込みを受け付けるインスタンスを 1 つに限定します。
+//
+// リースの取得・更新・解放はいずれもオブジェクトの世代番号を前提条件にした書き込みで行うため、
+// 同時に取得しようとしても成功するのは 1 つだけです。保持者は TTL の 1/3 ごとに期限を延長し、
+// 期限を過ぎたリースは他のインスタンスが取得できます。
+//
+// デプロイ時は新しいインスタンスが RequestHandover で引き継ぎを依頼し、保持者は書き込みを止めて最後のスナップショットを
+// 公開してから HandOver でリースを渡します。引き継ぎ先は記録された世代番号（Inherited）の current を取り込んでから書き込みます。
+type Lease struct {
+	ObjectStore storageif.ObjectStore
+	Bucket      string
+	// Holder はこのインスタンスの識別子です（NewLeaseHolder）。
+	Holder string
+	// TTL はリースの有効期間です。
+	TTL time.Duration
+
+	mu        sync.Mutex
+	held      bool
+	gen       int64     // 自分が最後に書いたリースの世代番号
+	acquired  time.Time // 取得した時刻
+	valid     time.Time // 保持しているとみなす期限（期限より手前。時計のずれの余裕を取る）
+	inherited int64     // 取得時に前の保持者が記録していた Published
+}
+
+// NewLeaseHolder はリビジョン名（K_REVISION など）とランダムな値からリースの保持者の識別子を作ります。
+func NewLeaseHolder() string {
+	var b [4]byte
+	_, _ = rand.Read(b[:])
+	return appVersion() + "-" + hex.EncodeToString(b[:])
+}
+
+// RenewInterval はリースを延長する間隔です。
+func (l *Lease) RenewInterval() time.Duration { return l.TTL / 3 }
+
+// Held はリースを保持しているかを返します。延長に失敗し続けて期限が近づいた場合も false です。
+func (l *Lease) Held() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.held && clock.Now().Before(l.valid)
+}
+
+// Acquire はリースを取得します。他のインスタンスが期限内のリースを保持している
+// （または他のインスタンスへの引き継ぎ中の）場合は ErrLeaseHeld を返します。
+func (l *Lease) Acquire(ctx context.Context) error {
+	rec, gen, err := l.read(ctx)
+	if err != nil {
+		return err
+	}
+	if gen != 0 && clock.Now().Before(rec.ExpiresAt) {
+		if rec.Holder != "" && rec.Holder != l.Holder {
+			return fmt.Errorf("%w: %s until %s", ErrLeaseHeld, rec.Holder, rec.ExpiresAt.Format(time.RFC3339))
+		}
+		if rec.HandoverTo != "" && rec.HandoverTo != l.Holder {
+			return fmt.Errorf("%w: handed over to %s until %s", ErrLeaseHeld, rec.HandoverTo, rec.ExpiresAt.Format(time.RFC3339))
+		}
+	}
+	if err := l.write(ctx, gen, clock.Now()); err != nil {
+		if errors.Is(err, storageif.ErrPreconditionFailed) {
+			// 読んでから書くまでの間に他のインスタンスが取得した
+			return fmt.Errorf("%w: %v", ErrLeaseHeld, err)
+		}
+		return err
+	}
+	if gen != 0 && rec.Holder != "" && rec.Holder != l.Holder {
+		slog.WarnContext(ctx, "write lease taken over from an expired holder",
+			slog.String("previous_holder", rec.Holder), slog.Time("expired_at", rec.ExpiresAt))
+	}
+	l.mu.Lock()
+	l.inherited = 0
+	if rec.Holder == "" {
+		l.inherited = rec.Published
+	}
+	l.mu.Unlock()
+	// 自分の引き継ぎ依頼は取得した時点で不要になる（保持者が応じずに期限切れで取得した場合も）
+	l.deleteHandover(ctx, l.Holder)
+	return nil
+}
+
+// Inherited は前の保持者が解放時に記録した、最後に公開した current の世代番号を返します（期限切れで引き継いだ場合などは 0）。
+func (l *Lease) Inherited() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inherited
+}
+
+// Renew はリースの期限を延長します。他のインスタンスに取られていた場合は ErrLeaseLost を返し、以降は保持していない扱いです。
+func (l *Lease) Renew(ctx context.Context) error {
+	l.mu.Lock()
+	held, gen, acquired := l.held, l.gen, l.acquired
+	l.mu.Unlock()
+	if !held {
+		return ErrLeaseLost
+	}
+	err := l.write(ctx, gen, acquired)
+	if errors.Is(err, storageif.ErrPreconditionFailed) {
+		l.drop()
+		return fmt.Errorf("%w: %v", ErrLeaseLost, err)
+	}
+	return err
+}
+
+// Release はリースを期限切れの状態で書き戻し、他のインスタンスがすぐに取得できるようにします。
+// published は最後に公開した current の世代番号です（次の保持者がその世代を取り込む。0 は不明）。
+func (l *Lease) Release(ctx context.Context, published int64) error {
+	return l.release(ctx, LeaseRecord{Published: published})
+}
+
+// HandOver はリースを to に引き継ぎます。TTL の間は to だけが取得でき、取得されなければ再び誰でも取得できます。
+// 応じた引き継ぎ依頼は削除します。
+func (l *Lease) HandOver(ctx context.Context, to string, published int64) error {
+	if err := l.release(ctx, LeaseRecord{HandoverTo: to, Published: published, ExpiresAt: clock.Now().Add(l.TTL).UTC()}); err != nil {
+		return err
+	}
+	l.deleteHandover(ctx, to)
+	return nil
+}
+
+func (l *Lease) release(ctx context.Context, rec LeaseRecord) error {
+	l.mu.Lock()
+	held, gen := l.held, l.gen
+	l.mu.Unlock()
+	if !held {
+		return nil
+	}
+	l.drop()
+	path, err := writeLeaseRecord(rec)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(path)
+	if _, err := l.ObjectStore.UploadIfGeneration(ctx, l.Bucket, LeaseObject, path, gen); err != nil {
+		if errors.Is(err, storageif.ErrPreconditionFailed) {
+			return nil // 既に他のインスタンスが取得している
+		}
+		return err
+	}
+	return nil
+}
+
+// RequestHandover は保持者にリースの引き継ぎを依頼します（保持者は次の延長の際に応じる）。
+func (l *Lease) RequestHandover(ctx context.Context) error {
+	b, err := json.Marshal(HandoverRequest{Requester: l.Holder, RequestedAt: clock.Now().UTC()})
+	if err != nil {
+		return err
+	}
+	path, err := writeTempJSON(b)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(path)
+	return l.ObjectStore.Upload(ctx, l.Bucket, HandoverObject, path)
+}
+
+// PendingHandover は保持者として応じるべき引き継ぎ依頼があれば、依頼したインスタンスを返します。
+// リースを取得する前の依頼・自分の依頼は無視します。
+func (l *Lease) PendingHandover(ctx context.Context) (string, bool, error) {
+	l.mu.Lock()
+	acquired := l.acquired
+	l.mu.Unlock()
+	req, err := l.handoverRequest(ctx)
+	if errors.Is(err, storageif.ErrNotExist) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("read handover request: %w", err)
+	}
+	if req.Requester == "" || req.Requester == l.Holder || !req.RequestedAt.After(acquired) {
+		return "", false, nil
+	}
+	return req.Requester, true, nil
+}
+
+// deleteHandover は requester の引き継ぎ依頼があれば削除します（他のインスタンスの依頼は残す）。
+// 削除できなくても、リースを取得する前の依頼は PendingHandover が無視するため警告のみです。
+func (l *Lease) deleteHandover(ctx context.Context, requester string) {
+	req, err := l.handoverRequest(ctx)
+	if err == nil && req.Requester != requester {
+		return
+	}
+	if err == nil {
+		err = l.ObjectStore.Delete(ctx, l.Bucket, HandoverObject)
+	}
+	if err != nil && !errors.Is(err, storageif.ErrNotExist) {
+		slog.WarnContext(ctx, "delete write lease handover request failed", slog.Any("error", err))
+	}
+}
+
+// handoverRequest は引き継ぎ依頼を読みます。無い場合は storageif.ErrNotExist を返します。
+func (l *Lease) handoverRequest(ctx context.Context) (HandoverRequest, error) {
+	b, err := l.download(ctx, HandoverObject)
+	if err != nil {
+		return HandoverRequest{}, err
+	}
+	var req HandoverRequest
+	if err := json.Unmarshal(b, &req); err != nil {
+		return HandoverRequest{}, err
+	}
+	return req, nil
+}
+
+func (l *Lease) drop() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.held = false
+}
+
+// write は世代番号 gen を前提に、期限を今から TTL 後にしたリースを書き込みます。
+func (l *Lease) write(ctx context.Context, gen int64, acquiredAt time.Time) error {
+	sent := clock.Now()
+	rec := LeaseRecord{Holder: l.Holder, AcquiredAt: acquiredAt.UTC(), ExpiresAt: sent.Add(l.TTL).UTC()}
+	path, err := writeLeaseRecord(rec)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(path)
+	newGen, err := l.ObjectStore.UploadIfGeneration(ctx, l.Bucket, LeaseObject, path, gen)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// 他のインスタンスは ExpiresAt を過ぎると取得できるため、時計のずれを見込んで手前で保持をやめる
+	l.held, l.gen, l.acquired, l.valid = true, newGen, acquiredAt, sent.Add(l.TTL-l.TTL/6)
+	return nil
+}
+
+// read は現在のリースとその世代番号を返します（無ければ世代番号 0）。読めない内容のリースは期限切れとして扱います。
+func (l *Lease) read(ctx context.Context) (LeaseRecord, int64, error) {
+	f, err := os.CreateTemp("", "app-lease-*.json")
+	if err != nil {
+		return LeaseRecord{}, 0, err
+	}
+	path := f.Name()
+	_ = f.Close()
+	defer os.Remove(path)
+	gen, err := l.ObjectStore.DownloadGeneration(ctx, l.Bucket, LeaseObject, path)
+	if errors.Is(err, storageif.ErrNotExist) {
+		return LeaseRecord{}, 0, nil
+	}
+	if err != nil {
+		return LeaseRecord{}, 0, fmt.Errorf("read write lease: %w", err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return LeaseRecord{}, 0, err
+	}
+	var rec LeaseRecord
+	if err := json.Unmarshal(b, &rec); err != nil {
+		slog.WarnContext(ctx, "write lease is unreadable; treating it as expired", slog.Any("error", err))
+		return LeaseRecord{}, gen, nil
+	}
+	return rec, gen, nil
+}
+
+// download は object の内容を返します。
+func (l *Lease) download(ctx context.Context, object string) ([]byte, error) {
+	f, err := os.CreateTemp("", "app-lease-*.json")
+	if err != nil {
+		return nil, err
+	}
+	path := f.Name()
+	_ = f.Close()
+	defer os.Remove(path)
+	if err := l.ObjectStore.Download(ctx, l.Bucket, object, path); err != nil {
+		return nil, err
+	}
+	return os.ReadFile(path)
+}
+
+func writeLeaseRecord(rec LeaseRecord) (string, error) {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return "", err
+	}
+	return writeTempJSON(b)
+}
+
+func writeTempJSON(b []byte) (string, error) {
+	f, err := os.CreateTemp("", "app-lease-*.json")
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.Write(b); err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
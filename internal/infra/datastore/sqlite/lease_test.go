@@ -0,0 +1,300 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kawabatas/mini-web-app/internal/infra/storage/local"
+	"github.com/kawabatas/mini-web-app/internal/util/clock"
+)
+
+const testLeaseTTL = 30 * time.Second
+
+// testClock は Advance でのみ進む時計です。
+type testClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// setTestClock は clock.Default をテストの間 testClock に置き換えます。
+func setTestClock(t *testing.T) *testClock {
+	t.Helper()
+	c := &testClock{now: time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)}
+	t.Cleanup(clock.Set(c))
+	return c
+}
+
+func newTestLease(bucket, holder string) *Lease {
+	return &Lease{ObjectStore: local.FS{}, Bucket: bucket, Holder: holder, TTL: testLeaseTTL}
+}
+
+func TestLease_Acquire(t *testing.T) {
+	ctx := context.Background()
+	for name, tc := range map[string]struct {
+		// prepare は "b" の取得前に、他のインスタンス "a" のリースを用意します
+		prepare       func(t *testing.T, c *testClock, a *Lease)
+		wantErr       error
+		wantInherited int64
+	}{
+		"no lease": {prepare: func(t *testing.T, c *testClock, a *Lease) {}},
+		"held by another": {
+			prepare: func(t *testing.T, c *testClock, a *Lease) {
+				mustAcquire(t, a)
+				c.Advance(testLeaseTTL - time.Second)
+			},
+			wantErr: ErrLeaseHeld,
+		},
+		"expired": {
+			prepare: func(t *testing.T, c *testClock, a *Lease) {
+				mustAcquire(t, a)
+				c.Advance(testLeaseTTL)
+			},
+		},
+		"released": {
+			prepare: func(t *testing.T, c *testClock, a *Lease) {
+				mustAcquire(t, a)
+				if err := a.Release(ctx, 42); err != nil {
+					t.Fatalf("Release: %v", err)
+				}
+			},
+			wantInherited: 42,
+		},
+		"handed over to me": {
+			prepare: func(t *testing.T, c *testClock, a *Lease) {
+				mustAcquire(t, a)
+				if err := a.HandOver(ctx, "b", 42); err != nil {
+					t.Fatalf("HandOver: %v", err)
+				}
+			},
+			wantInherited: 42,
+		},
+		"handed over to another": {
+			prepare: func(t *testing.T, c *testClock, a *Lease) {
+				mustAcquire(t, a)
+				if err := a.HandOver(ctx, "c", 42); err != nil {
+					t.Fatalf("HandOver: %v", err)
+				}
+			},
+			wantErr: ErrLeaseHeld,
+		},
+		"handover to another expired": {
+			prepare: func(t *testing.T, c *testClock, a *Lease) {
+				mustAcquire(t, a)
+				if err := a.HandOver(ctx, "c", 42); err != nil {
+					t.Fatalf("HandOver: %v", err)
+				}
+				c.Advance(testLeaseTTL)
+			},
+			wantInherited: 42,
+		},
+		"own lease after a restart": {
+			prepare: func(t *testing.T, c *testClock, a *Lease) { mustAcquire(t, newTestLease(a.Bucket, "b")) },
+		},
+		"unreadable lease": {
+			prepare: func(t *testing.T, c *testClock, a *Lease) {
+				putObject(t, a.Bucket, LeaseObject, []byte("{"), time.Now())
+			},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c := setTestClock(t)
+			bucket := t.TempDir()
+			a, b := newTestLease(bucket, "a"), newTestLease(bucket, "b")
+			tc.prepare(t, c, a)
+
+			err := b.Acquire(ctx)
+			if tc.wantErr != nil {
+				if !errors.Is(err, tc.wantErr) || b.Held() {
+					t.Fatalf("Acquire = %v (held %v), want %v", err, b.Held(), tc.wantErr)
+				}
+				return
+			}
+			if err != nil || !b.Held() {
+				t.Fatalf("Acquire = %v (held %v)", err, b.Held())
+			}
+			if got := b.Inherited(); got != tc.wantInherited {
+				t.Fatalf("Inherited = %d, want %d", got, tc.wantInherited)
+			}
+			// 以降は他のインスタンスが取得できない
+			if err := newTestLease(bucket, "c").Acquire(ctx); !errors.Is(err, ErrLeaseHeld) {
+				t.Fatalf("Acquire by another instance = %v, want ErrLeaseHeld", err)
+			}
+		})
+	}
+}
+
+func mustAcquire(t *testing.T, l *Lease) {
+	t.Helper()
+	if err := l.Acquire(context.Background()); err != nil {
+		t.Fatalf("Acquire(%s): %v", l.Holder, err)
+	}
+}
+
+func TestLease_RenewAndExpiry(t *testing.T) {
+	ctx := context.Background()
+	c := setTestClock(t)
+	bucket := t.TempDir()
+	a, b := newTestLease(bucket, "a"), newTestLease(bucket, "b")
+	mustAcquire(t, a)
+
+	// 延長し続ける限り保持する
+	for i := 0; i < 5; i++ {
+		c.Advance(a.RenewInterval())
+		if err := a.Renew(ctx); err != nil || !a.Held() {
+			t.Fatalf("Renew #%d = %v (held %v)", i, err, a.Held())
+		}
+	}
+	if err := b.Acquire(ctx); !errors.Is(err, ErrLeaseHeld) {
+		t.Fatalf("Acquire while renewed = %v, want ErrLeaseHeld", err)
+	}
+
+	// 延長が止まると、他のインスタンスが取得できる期限より手前で保持をやめる
+	c.Advance(testLeaseTTL - testLeaseTTL/6)
+	if a.Held() {
+		t.Fatal("lease is held past its margin")
+	}
+	c.Advance(testLeaseTTL / 6)
+	mustAcquire(t, b)
+
+	// 取られた後の延長・解放は失敗し、新しい保持者のリースを上書きしない
+	if err := a.Renew(ctx); !errors.Is(err, ErrLeaseLost) {
+		t.Fatalf("Renew after takeover = %v, want ErrLeaseLost", err)
+	}
+	if err := a.Renew(ctx); !errors.Is(err, ErrLeaseLost) {
+		t.Fatalf("second Renew after takeover = %v, want ErrLeaseLost", err)
+	}
+	if err := a.Release(ctx, 1); err != nil {
+		t.Fatalf("Release after takeover: %v", err)
+	}
+	if err := b.Renew(ctx); err != nil || !b.Held() {
+		t.Fatalf("Renew by the new holder = %v (held %v)", err, b.Held())
+	}
+}
+
+func TestLease_ReleaseInheritsPublishedGeneration(t *testing.T) {
+	ctx := context.Background()
+	setTestClock(t)
+	bucket := t.TempDir()
+	a, b := newTestLease(bucket, "a"), newTestLease(bucket, "b")
+	mustAcquire(t, a)
+	if err := a.Release(ctx, 42); err != nil || a.Held() {
+		t.Fatalf("Release = %v (held %v)", err, a.Held())
+	}
+	// 解放済みのリースを再び解放しても何もしない
+	if err := a.Release(ctx, 7); err != nil {
+		t.Fatalf("second Release: %v", err)
+	}
+	mustAcquire(t, b)
+	if got := b.Inherited(); got != 42 {
+		t.Fatalf("Inherited = %d, want 42", got)
+	}
+	// 再取得では前の保持者の世代番号を引き継がない
+	mustAcquire(t, b)
+	if got := b.Inherited(); got != 0 {
+		t.Fatalf("Inherited after reacquiring = %d, want 0", got)
+	}
+}
+
+func TestLease_Handover(t *testing.T) {
+	ctx := context.Background()
+	requestHandover := func(t *testing.T, c *testClock, l *Lease) {
+		t.Helper()
+		c.Advance(time.Second)
+		if err := l.RequestHandover(ctx); err != nil {
+			t.Fatalf("RequestHandover(%s): %v", l.Holder, err)
+		}
+	}
+	pending := func(t *testing.T, l *Lease) string {
+		t.Helper()
+		to, ok, err := l.PendingHandover(ctx)
+		if err != nil || ok != (to != "") {
+			t.Fatalf("PendingHandover = %q, %v, %v", to, ok, err)
+		}
+		return to
+	}
+	for name, tc := range map[string]struct {
+		// run は "a" が保持するリースに対して引き継ぎを進めます
+		run         func(t *testing.T, c *testClock, a, b *Lease)
+		wantRequest bool // 最後に引き継ぎ依頼が残っている
+	}{
+		"answered and taken": {
+			run: func(t *testing.T, c *testClock, a, b *Lease) {
+				requestHandover(t, c, b)
+				if to := pending(t, b); to != "" {
+					t.Fatalf("requester sees its own request as pending: %q", to)
+				}
+				if to := pending(t, a); to != "b" {
+					t.Fatalf("PendingHandover = %q, want b", to)
+				}
+				if err := a.HandOver(ctx, "b", 42); err != nil || a.Held() {
+					t.Fatalf("HandOver = %v (held %v)", err, a.Held())
+				}
+				mustAcquire(t, b)
+				if got := b.Inherited(); got != 42 {
+					t.Fatalf("Inherited = %d, want 42", got)
+				}
+			},
+		},
+		"taken after the holder stopped answering": {
+			run: func(t *testing.T, c *testClock, a, b *Lease) {
+				requestHandover(t, c, b)
+				c.Advance(testLeaseTTL)
+				mustAcquire(t, b)
+			},
+		},
+		"request before acquiring is ignored": {
+			run: func(t *testing.T, c *testClock, a, b *Lease) {
+				// a の引き継ぎに応じずに期限切れで取得したインスタンスにとって、c の依頼は取得前のもの
+				requestHandover(t, c, newTestLease(a.Bucket, "c"))
+				c.Advance(testLeaseTTL)
+				mustAcquire(t, b)
+				if to := pending(t, b); to != "" {
+					t.Fatalf("PendingHandover = %q, want none", to)
+				}
+			},
+			wantRequest: true,
+		},
+		"request of another instance is kept": {
+			run: func(t *testing.T, c *testClock, a, b *Lease) {
+				requestHandover(t, c, b)
+				// 引き継ぎ先が取得する前に、別のインスタンスが依頼を置き換えた
+				requestHandover(t, c, newTestLease(a.Bucket, "c"))
+				if err := a.HandOver(ctx, "b", 42); err != nil {
+					t.Fatalf("HandOver: %v", err)
+				}
+				mustAcquire(t, b)
+				if req, err := b.handoverRequest(ctx); err != nil || req.Requester != "c" {
+					t.Fatalf("handover request = %+v, %v; want c's", req, err)
+				}
+			},
+			wantRequest: true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c := setTestClock(t)
+			bucket := t.TempDir()
+			a, b := newTestLease(bucket, "a"), newTestLease(bucket, "b")
+			mustAcquire(t, a)
+			tc.run(t, c, a, b)
+			objs := listObjects(t, bucket, HandoverObject)
+			if got := len(objs) > 0; got != tc.wantRequest {
+				t.Fatalf("handover request remains = %v, want %v", got, tc.wantRequest)
+			}
+		})
+	}
+}
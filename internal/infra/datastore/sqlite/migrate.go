@@ -0,0 +1,60 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+
+	"github.com/kawabatas/mini-web-app/internal/infra/datastore/sqlrun"
+)
+
+// migrations/ 配下の SQL ファイルをバイナリに埋め込みます。
+// ファイル名は <version>_<name>.up.sql / <version>_<name>.down.sql 形式（version は 1 始まりの連番）。
+//
+//go:embed migrations/*.sql
+var migrationFS embed.FS
+
+// 適用は単一の書き込み接続で行うため排他は不要です。
+var migrator = sqlrun.Migrator{FS: migrationFS, TimestampType: "TIMESTAMP"}
+
+// seedSQL は新しい DB にのみ投入する初期データです。
+const seedSQL = `INSERT INTO singers(name, genre, debut_year) VALUES
+	('Taylor Swift','Pop',2006),
+	('Ed Sheeran','Pop',2011),
+	('Adele','Soul',2008)`
+
+// ErrSchemaTooNew は DB のスキーマがバイナリの知っているバージョンより新しい場合のエラーです。
+// 新しいリビジョンで作られたスナップショットを古いバイナリで開こうとした場合に発生します。
+var ErrSchemaTooNew = sqlrun.ErrSchemaTooNew
+
+// ErrChecksumMismatch は適用済みマイグレーションの内容が変更されている場合のエラーです。
+var ErrChecksumMismatch = sqlrun.ErrChecksumMismatch
+
+// Migration は 1 ステップ分のスキーマ変更です。
+type Migration = sqlrun.Migration
+
+// Migrations は埋め込まれたマイグレーションを version 昇順で返します。
+func Migrations() ([]Migration, error) { return migrator.Migrations() }
+
+// LatestSchemaVersion はバイナリが知っている最新のスキーマバージョンです。
+func LatestSchemaVersion() int { return migrator.LatestSchemaVersion() }
+
+// SchemaVersion は DB に適用済みの最新バージョンを返します（未管理の DB は 0）。
+func SchemaVersion(ctx context.Context, db *sql.DB) (int, error) {
+	return migrator.SchemaVersion(ctx, db)
+}
+
+// Migrate は未適用のマイグレーションを 1 トランザクションで最新まで適用します。
+func Migrate(ctx context.Context, db *sql.DB) error { return migrator.Migrate(ctx, db) }
+
+// MigrateTo は target バージョンまで up / down を 1 トランザクションで適用します（sqlrun.Migrator.MigrateTo）。
+func MigrateTo(ctx context.Context, db *sql.DB, target int) error {
+	return migrator.MigrateTo(ctx, db, target)
+}
+
+// migrateAndSeed は Migrate と同様に最新まで適用し、初期マイグレーションを適用した（新しい）DB にのみ同じトランザクションで初期データを投入します。
+func migrateAndSeed(ctx context.Context, db *sql.DB) error {
+	m := migrator
+	m.Seed = seedSQL
+	return m.Migrate(ctx, db)
+}
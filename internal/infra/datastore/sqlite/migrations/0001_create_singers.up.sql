@@ -0,0 +1,8 @@
+-- 既存スナップショット（schema_migrations 導入前）との互換のため IF NOT EXISTS を付与
+CREATE TABLE IF NOT EXISTS singers (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  name TEXT NOT NULL,
+  genre TEXT NOT NULL,
+  debut_year INTEGER NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
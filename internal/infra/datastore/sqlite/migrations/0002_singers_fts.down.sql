@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS singers_fts_au;
+DROP TRIGGER IF EXISTS singers_fts_ad;
+DROP TRIGGER IF EXISTS singers_fts_ai;
+DROP TABLE IF EXISTS singers_fts;
@@ -0,0 +1,25 @@
+-- 部分一致検索用の FTS5 インデックス（singers を外部コンテンツとして参照）
+-- trigram トークナイザにより 3 文字以上の部分文字列で検索できる（日本語も可）
+CREATE VIRTUAL TABLE singers_fts USING fts5(
+  name,
+  genre,
+  content='singers',
+  content_rowid='id',
+  tokenize='trigram'
+);
+
+CREATE TRIGGER singers_fts_ai AFTER INSERT ON singers BEGIN
+  INSERT INTO singers_fts(rowid, name, genre) VALUES (new.id, new.name, new.genre);
+END;
+
+CREATE TRIGGER singers_fts_ad AFTER DELETE ON singers BEGIN
+  INSERT INTO singers_fts(singers_fts, rowid, name, genre) VALUES ('delete', old.id, old.name, old.genre);
+END;
+
+CREATE TRIGGER singers_fts_au AFTER UPDATE OF name, genre ON singers BEGIN
+  INSERT INTO singers_fts(singers_fts, rowid, name, genre) VALUES ('delete', old.id, old.name, old.genre);
+  INSERT INTO singers_fts(rowid, name, genre) VALUES (new.id, new.name, new.genre);
+END;
+
+-- 既存データを索引化
+INSERT INTO singers_fts(singers_fts) VALUES ('rebuild');
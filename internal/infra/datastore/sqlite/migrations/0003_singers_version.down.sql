@@ -0,0 +1 @@
+ALTER TABLE singers DROP COLUMN version;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS singers_deleted_at_idx;
+-- 論理削除済みの行は列と共に失われるため物理削除する
+DELETE FROM singers WHERE deleted_at IS NOT NULL;
+ALTER TABLE singers DROP COLUMN deleted_at;
@@ -0,0 +1,16 @@
+-- データ変更の監査ログ（変更と同じトランザクションで追記する）
+CREATE TABLE audit_log (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  at TIMESTAMP NOT NULL,
+  actor TEXT NOT NULL,
+  request_id TEXT NOT NULL DEFAULT '',
+  entity TEXT NOT NULL,
+  entity_id INTEGER,
+  action TEXT NOT NULL,
+  before_json TEXT,
+  after_json TEXT,
+  diff_json TEXT
+);
+CREATE INDEX audit_log_entity_idx ON audit_log(entity, entity_id);
+CREATE INDEX audit_log_actor_idx ON audit_log(actor);
+CREATE INDEX audit_log_at_idx ON audit_log(at);
@@ -0,0 +1,13 @@
+-- ドメインイベントの送信待ちキュー（変更と同じトランザクションで追記し、ディスパッチャが配信する）
+CREATE TABLE outbox (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  event_type TEXT NOT NULL,
+  payload TEXT NOT NULL,
+  created_at TIMESTAMP NOT NULL,
+  attempts INTEGER NOT NULL DEFAULT 0,
+  next_attempt_at TIMESTAMP NOT NULL,
+  last_error TEXT NOT NULL DEFAULT '',
+  done_at TIMESTAMP
+);
+CREATE INDEX outbox_pending_idx ON outbox(next_attempt_at, id) WHERE done_at IS NULL;
+CREATE INDEX outbox_done_idx ON outbox(done_at) WHERE done_at IS NOT NULL;
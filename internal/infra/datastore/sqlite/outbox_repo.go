@@ -0,0 +1,71 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/kawabatas/mini-web-app/internal/domain/model"
+)
+
+// OutboxRepo は outbox テーブルのリポジトリです。参照系を r、更新系を w に振り分けます。
+type OutboxRepo struct{ r, w dbtx }
+
+func NewOutboxRepo(c *Conns) *OutboxRepo { return &OutboxRepo{r: c.Reader, w: c.Writer} }
+
+// NewOutboxRepoTx はトランザクションに束縛された OutboxRepo を返します。
+func NewOutboxRepoTx(tx *sql.Tx) *OutboxRepo { return &OutboxRepo{r: tx, w: tx} }
+
+func (r *OutboxRepo) Append(ctx context.Context, e model.OutboxEvent) error {
+	at := timestampText(e.CreatedAt)
+	_, err := r.w.ExecContext(ctx, `
+INSERT INTO outbox(event_type, payload, created_at, next_attempt_at) VALUES (?, ?, ?, ?)`,
+		e.Type, string(e.Payload), at, at)
+	return err
+}
+
+func (r *OutboxRepo) Pending(ctx context.Context, now time.Time, limit int) ([]model.OutboxEvent, error) {
+	rows, err := r.r.QueryContext(ctx, `
+SELECT id, event_type, payload, created_at, attempts
+FROM outbox
+WHERE done_at IS NULL AND next_attempt_at <= ?
+ORDER BY id ASC
+LIMIT ?`, timestampText(now), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []model.OutboxEvent
+	for rows.Next() {
+		var (
+			e       model.OutboxEvent
+			payload string
+		)
+		if err := rows.Scan(&e.ID, &e.Type, &payload, &e.CreatedAt, &e.Attempts); err != nil {
+			return nil, err
+		}
+		e.Payload = []byte(payload)
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+func (r *OutboxRepo) MarkDone(ctx context.Context, id int64, at time.Time) error {
+	_, err := r.w.ExecContext(ctx, `UPDATE outbox SET done_at = ?, attempts = attempts + 1, last_error = '' WHERE id = ?`, timestampText(at), id)
+	return err
+}
+
+func (r *OutboxRepo) MarkFailed(ctx context.Context, id int64, errMsg string, next time.Time) error {
+	_, err := r.w.ExecContext(ctx, `
+UPDATE outbox SET attempts = attempts + 1, last_error = ?, next_attempt_at = ?
+WHERE id = ?`, errMsg, timestampText(next), id)
+	return err
+}
+
+func (r *OutboxRepo) DeleteDone(ctx context.Context, before time.Time) (int64, error) {
+	res, err := r.w.ExecContext(ctx, `DELETE FROM outbox WHERE done_at IS NOT NULL AND done_at < ?`, timestampText(before))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
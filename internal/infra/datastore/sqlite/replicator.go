@@ -0,0 +1,623 @@
+package sqlite
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	storageif "github.com/kawabatas/mini-web-app/internal/infra/storage"
+	"github.com/kawabatas/mini-web-app/internal/infra/storage/envelope"
+	"github.com/kawabatas/mini-web-app/internal/util/clock"
+)
+
+// generationsPrefix は WAL 配送のオブジェクトを置くプレフィックスです。
+//
+//	generations/<gen>/snapshots/<index:08d>.sqlite        … WAL index <index> を適用する前の DB ファイル
+//	generations/<gen>/wal/<index:08d>-<offset:012d>.wal    … WAL index <index> の offset 以降のコミット済みフレーム
+//
+// index は WAL がチェックポイントで空になる（または作り直される）たびに 1 増えます。
+// 世代（gen）は連続性が途切れたとき（起動時・アップロード失敗時）に新しく始めます。
+const generationsPrefix = "generations/"
+
+// Replicator は SQLite の WAL を一定間隔でオブジェクトストレージに配送します（Litestream 方式）。
+//
+// 書き込み接続（1 本）を保持している間に WAL を読み取り、コミット済みのフレームだけを送ってから
+// チェックポイントします。自動チェックポイントは無効化し、未配送のフレームが DB ファイルに
+// 取り込まれて失われないようにします。
+// 復元は最新世代の最新スナップショットに、以降の WAL セグメントを順に適用して行います。
+type Replicator struct {
+	Store            storageif.ObjectStore
+	Bucket           string
+	Interval         time.Duration     // WAL の配送間隔（既定 5 秒）
+	SnapshotInterval time.Duration     // 世代内でスナップショットを取り直す間隔（既定 1 時間）
+	Keyring          *envelope.Keyring // nil なら暗号化しない（オブジェクトのキーを追加認証データにする）
+
+	mu           sync.Mutex
+	db           *sql.DB // 書き込みプール
+	dbPath       string
+	gen          string // 空なら次回の Sync で新しい世代を始める
+	index        int
+	offset       int
+	hdr          []byte // 配送中の WAL のヘッダ（WAL の作り直しの検知用）
+	lastSnapshot time.Time
+
+	stop context.CancelFunc
+	done chan struct{}
+}
+
+// NewReplicator は既定の間隔の Replicator を返します。
+func NewReplicator(store storageif.ObjectStore, bucket string) *Replicator {
+	return &Replicator{
+		Store:            store,
+		Bucket:           bucket,
+		Interval:         5 * time.Second,
+		SnapshotInterval: time.Hour,
+	}
+}
+
+// Start は書き込みプールに接続し、新しい世代を始めて定期配送を開始します。
+// 初回の世代の開始に失敗しても配送ループは開始し、次回の Sync で再試行します。
+func (r *Replicator) Start(ctx context.Context, conns *Conns, dbPath string) error {
+	r.mu.Lock()
+	r.db = conns.Writer
+	r.dbPath = dbPath
+	r.gen = ""
+	r.mu.Unlock()
+	if _, err := conns.Writer.ExecContext(ctx, `PRAGMA wal_autocheckpoint=0`); err != nil {
+		return err
+	}
+	err := r.Sync(ctx)
+
+	ctxRun, stop := context.WithCancel(context.Background())
+	r.stop = stop
+	r.done = make(chan struct{})
+	go r.run(ctxRun)
+	return err
+}
+
+func (r *Replicator) run(ctx context.Context) {
+	defer close(r.done)
+	interval := r.Interval
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		ctxSync, cancel := context.WithTimeout(ctx, time.Minute)
+		if err := r.Sync(ctxSync); err != nil {
+			slog.ErrorContext(ctxSync, "wal replication failed", slog.Any("error", err))
+		}
+		cancel()
+	}
+}
+
+// Stop は配送ループを止め、最後に未配送の WAL を送ります。
+func (r *Replicator) Stop(ctx context.Context) error {
+	if r.stop == nil {
+		return nil
+	}
+	r.stop()
+	<-r.done
+	r.stop = nil
+	return r.Sync(ctx)
+}
+
+// Sync は未配送のコミット済みフレームを配送します（世代が無ければ新しく始めます）。
+func (r *Replicator) Sync(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.db == nil {
+		return errors.New("replicator is not started")
+	}
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	pending, err := r.collect(ctx, conn)
+	_ = conn.Close()
+	if err != nil {
+		return err
+	}
+	return r.uploadAll(ctx, pending)
+}
+
+// SnapshotTo は配送を済ませたうえで、同じ書き込み接続上で VACUUM INTO によるスナップショットを作成します。
+// 別接続でチェックポイントすると未配送のフレームが DB ファイルに取り込まれるため、
+// Replicator の稼働中は SnapshotTo（パッケージ関数）ではなくこちらを使います。
+func (r *Replicator) SnapshotTo(ctx context.Context, outPath string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.db == nil {
+		return errors.New("replicator is not started")
+	}
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	pending, err := r.collect(ctx, conn)
+	if err != nil {
+		slog.WarnContext(ctx, "wal replication before snapshot failed", slog.Any("error", err))
+	}
+	// outPath は信頼できるパスのみを渡すこと（VACUUM INTO はパラメータ化できない）
+	_, err = conn.ExecContext(ctx, fmt.Sprintf(`VACUUM INTO '%s';`, outPath))
+	_ = conn.Close()
+	if uErr := r.uploadAll(ctx, pending); uErr != nil {
+		slog.WarnContext(ctx, "wal replication before snapshot failed", slog.Any("error", uErr))
+	}
+	return err
+}
+
+// replicaObject はアップロード待ちのオブジェクトです。
+type replicaObject struct {
+	key  string
+	data []byte
+}
+
+// collect は書き込み接続 conn を保持した状態で、送るべき WAL セグメント・スナップショットを読み取り、
+// 配送済みのフレームをチェックポイントします。r.mu を保持して呼び出すこと。
+// 書き込みを止める時間を短くするため、アップロードは接続を返してから uploadAll で行います。
+func (r *Replicator) collect(ctx context.Context, conn *sql.Conn) ([]replicaObject, error) {
+	if _, err := conn.ExecContext(ctx, `PRAGMA wal_autocheckpoint=0`); err != nil {
+		return nil, err
+	}
+	if r.gen == "" {
+		return r.newGeneration(ctx, conn)
+	}
+
+	var pending []replicaObject
+	wal, err := os.ReadFile(r.dbPath + "-wal")
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if len(wal) >= walHeaderSize {
+		if r.hdr != nil && !bytes.Equal(wal[:walHeaderSize], r.hdr) {
+			// チェックポイント後に WAL が先頭から書き直された
+			r.index++
+			r.offset = 0
+		}
+		r.hdr = bytes.Clone(wal[:walHeaderSize])
+		end, err := walCommittedEnd(wal, r.offset)
+		if err != nil {
+			r.gen = ""
+			return nil, err
+		}
+		if end > r.offset {
+			pending = append(pending, replicaObject{key: r.walKey(r.index, r.offset), data: wal[r.offset:end]})
+			r.offset = end
+		}
+	}
+	if r.offset == 0 {
+		return pending, nil
+	}
+
+	if err := r.checkpoint(ctx, conn); err != nil {
+		// 読み取り中の接続があるなどで WAL を空にできなければ、次回は続きから配送する
+		slog.DebugContext(ctx, "wal checkpoint skipped", slog.Any("error", err))
+		return pending, nil
+	}
+	r.index++
+	r.offset = 0
+	r.hdr = nil
+	if clock.Now().Sub(r.lastSnapshot) >= r.snapshotInterval() {
+		snap, err := r.readSnapshot()
+		if err != nil {
+			r.gen = ""
+			return nil, err
+		}
+		pending = append(pending, snap)
+	}
+	return pending, nil
+}
+
+// newGeneration は WAL を空にして新しい世代を始め、DB ファイルをそのまま最初のスナップショットとします。
+// VACUUM INTO ではページ番号が変わり WAL のフレームと対応しなくなるため、ファイルをバイト単位で複製します。
+func (r *Replicator) newGeneration(ctx context.Context, conn *sql.Conn) ([]replicaObject, error) {
+	if err := r.checkpoint(ctx, conn); err != nil {
+		return nil, fmt.Errorf("start generation: %w", err)
+	}
+	var b [4]byte
+	_, _ = rand.Read(b[:])
+	r.gen = clock.NowUTCFormatted("20060102T150405Z") + "-" + hex.EncodeToString(b[:])
+	r.index, r.offset, r.hdr = 0, 0, nil
+	snap, err := r.readSnapshot()
+	if err != nil {
+		r.gen = ""
+		return nil, fmt.Errorf("start generation: %w", err)
+	}
+	slog.InfoContext(ctx, "wal replication generation started", slog.String("generation", r.gen))
+	return []replicaObject{snap}, nil
+}
+
+// uploadAll は collect で集めたオブジェクトを順にアップロードします。
+// 失敗すると配送済みの位置が不明になるため、次回の Sync で新しい世代から始めます。
+func (r *Replicator) uploadAll(ctx context.Context, pending []replicaObject) error {
+	for _, o := range pending {
+		if err := r.upload(ctx, o.key, o.data); err != nil {
+			r.gen = ""
+			return fmt.Errorf("upload %s: %w", o.key, err)
+		}
+		if strings.HasSuffix(o.key, ".sqlite") {
+			r.lastSnapshot = clock.Now()
+		}
+	}
+	return nil
+}
+
+// checkpoint は WAL をすべて DB ファイルに取り込み、WAL を空にします。
+func (r *Replicator) checkpoint(ctx context.Context, conn *sql.Conn) error {
+	var busy, logFrames, ckpt int
+	if err := conn.QueryRowContext(ctx, `PRAGMA wal_checkpoint(TRUNCATE)`).Scan(&busy, &logFrames, &ckpt); err != nil {
+		return err
+	}
+	if busy != 0 {
+		return errors.New("wal checkpoint is busy")
+	}
+	if fi, err := os.Stat(r.dbPath + "-wal"); err == nil && fi.Size() > 0 {
+		return fmt.Errorf("wal is not truncated: %d bytes", fi.Size())
+	}
+	return nil
+}
+
+// readSnapshot は現在の index のスナップショットとして DB ファイルを読み取ります（WAL が空の状態で呼び出すこと）。
+func (r *Replicator) readSnapshot() (replicaObject, error) {
+	data, err := os.ReadFile(r.dbPath)
+	if err != nil {
+		return replicaObject{}, err
+	}
+	return replicaObject{key: r.snapshotKey(r.index), data: data}, nil
+}
+
+func (r *Replicator) upload(ctx context.Context, object string, data []byte) error {
+	if r.Keyring != nil {
+		enc, err := r.Keyring.Encrypt(data, []byte(object))
+		if err != nil {
+			return err
+		}
+		data = enc
+	}
+	f, err := os.CreateTemp("", "app-replica-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return r.Store.Upload(ctx, r.Bucket, object, f.Name())
+}
+
+func (r *Replicator) snapshotInterval() time.Duration {
+	if r.SnapshotInterval <= 0 {
+		return time.Hour
+	}
+	return r.SnapshotInterval
+}
+
+func (r *Replicator) snapshotKey(index int) string {
+	return generationSnapshotKey(r.gen, index)
+}
+
+func generationSnapshotKey(gen string, index int) string {
+	return fmt.Sprintf("%s%s/snapshots/%08d.sqlite", generationsPrefix, gen, index)
+}
+
+func (r *Replicator) walKey(index, offset int) string {
+	return fmt.Sprintf("%s%s/wal/%08d-%012d.wal", generationsPrefix, r.gen, index, offset)
+}
+
+// LastShipped は最新世代に最後に配送したオブジェクトの更新時刻を返します（世代が無ければゼロ値）。
+func (r *Replicator) LastShipped(ctx context.Context) (time.Time, error) {
+	objs, err := r.Store.List(ctx, r.Bucket, generationsPrefix)
+	if err != nil {
+		return time.Time{}, err
+	}
+	gen, _, _ := latestGeneration(objs)
+	if gen == "" {
+		return time.Time{}, nil
+	}
+	var last time.Time
+	for _, o := range objs {
+		if strings.HasPrefix(o.Name, generationsPrefix+gen+"/") && o.Updated.After(last) {
+			last = o.Updated
+		}
+	}
+	return last, nil
+}
+
+// Prune は不要になった WAL のレプリカを削除し、削除した数を返します。
+//   - 配送中の世代以外で、最後のオブジェクトが before より前の世代（before 以降に取ったスナップショットを公開済みであること）
+//   - 配送中の世代の、最新のスナップショットより前の index のスナップショットと WAL セグメント（復元には使わない）
+//
+// 削除に失敗したオブジェクトは残し、次回の Prune で再試行します。
+func (r *Replicator) Prune(ctx context.Context, before time.Time) (int, error) {
+	r.mu.Lock()
+	current := r.gen
+	r.mu.Unlock()
+	objs, err := r.Store.List(ctx, r.Bucket, generationsPrefix)
+	if err != nil {
+		return 0, err
+	}
+	byGen := map[string][]storageif.ObjectAttrs{}
+	for _, o := range objs {
+		rest, _ := strings.CutPrefix(o.Name, generationsPrefix)
+		if gen, _, ok := strings.Cut(rest, "/"); ok {
+			byGen[gen] = append(byGen[gen], o)
+		}
+	}
+	var doomed []string
+	for gen, objs := range byGen {
+		if gen == current {
+			doomed = append(doomed, supersededReplicas(gen, objs)...)
+			continue
+		}
+		var last time.Time
+		for _, o := range objs {
+			if o.Updated.After(last) {
+				last = o.Updated
+			}
+		}
+		if last.Before(before) {
+			for _, o := range objs {
+				doomed = append(doomed, o.Name)
+			}
+		}
+	}
+	sort.Strings(doomed)
+	deleted := 0
+	var errs []error
+	for _, name := range doomed {
+		if err := r.Store.Delete(ctx, r.Bucket, name); err != nil && !errors.Is(err, storageif.ErrNotExist) {
+			errs = append(errs, fmt.Errorf("delete %s: %w", name, err))
+			continue
+		}
+		deleted++
+	}
+	if deleted > 0 {
+		slog.InfoContext(ctx, "wal replicas pruned", slog.Int("deleted", deleted), slog.String("generation", current))
+	}
+	return deleted, errors.Join(errs...)
+}
+
+// supersededReplicas は世代 gen のオブジェクト objs のうち、最新のスナップショットより前の index のものを返します。
+func supersededReplicas(gen string, objs []storageif.ObjectAttrs) []string {
+	_, snapshots, segments := latestGeneration(objs)
+	if len(snapshots) == 0 {
+		return nil
+	}
+	base := snapshots[len(snapshots)-1]
+	var names []string
+	for _, index := range snapshots[:len(snapshots)-1] {
+		names = append(names, generationSnapshotKey(gen, index))
+	}
+	for _, seg := range segments {
+		if seg.index < base {
+			names = append(names, seg.key)
+		}
+	}
+	return names
+}
+
+// walSegment は配送された WAL セグメントのオブジェクトです。
+type walSegment struct {
+	key    string
+	index  int
+	offset int64
+}
+
+// Restore は最新世代の最新スナップショットを dbPath に復元し、以降の WAL セグメントを適用します。
+// 世代が 1 つも無ければ (false, nil) を返します。
+// セグメント（または index）に欠落があれば、その手前までを適用した状態で警告を出して終了します。
+func (r *Replicator) Restore(ctx context.Context, dbPath string) (bool, error) {
+	objs, err := r.Store.List(ctx, r.Bucket, generationsPrefix)
+	if err != nil {
+		return false, err
+	}
+	gen, snapshots, segments := latestGeneration(objs)
+	if gen == "" {
+		return false, nil
+	}
+	base := snapshots[len(snapshots)-1]
+
+	for _, p := range []string{dbPath, dbPath + "-wal", dbPath + "-shm"} {
+		if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return false, err
+		}
+	}
+	snapKey := generationSnapshotKey(gen, base)
+	snap, err := r.fetch(ctx, snapKey)
+	if err != nil {
+		return false, err
+	}
+	if err := os.WriteFile(dbPath, snap, 0644); err != nil {
+		return false, err
+	}
+
+	applied, next := 0, base
+	for i := 0; i < len(segments); {
+		index := segments[i].index
+		j := i
+		for j < len(segments) && segments[j].index == index {
+			j++
+		}
+		group := segments[i:j]
+		i = j
+		if index < base {
+			continue
+		}
+		if index != next {
+			slog.WarnContext(ctx, "wal restore stopped at gap", slog.String("generation", gen), slog.Int("index", next))
+			break
+		}
+		next++
+		n, gapErr, err := r.applyWAL(ctx, dbPath, group)
+		if err != nil {
+			return false, fmt.Errorf("apply wal index %d: %w", index, err)
+		}
+		applied += n
+		if gapErr != nil {
+			slog.WarnContext(ctx, "wal restore stopped at gap", slog.String("generation", gen), slog.Int("index", index), slog.Any("error", gapErr))
+			break
+		}
+	}
+	slog.InfoContext(ctx, "restored from wal replica",
+		slog.String("generation", gen), slog.Int("snapshot", base), slog.Int("segments", applied))
+	return true, nil
+}
+
+// applyWAL は同じ index のセグメントを offset 0 から連結して dbPath-wal とし、チェックポイントで DB ファイルに取り込みます。
+// セグメントはコミットの境界で区切られているため、途中に欠落があれば手前までを適用し、欠落を gapErr で返します。
+func (r *Replicator) applyWAL(ctx context.Context, dbPath string, group []walSegment) (applied int, gapErr, err error) {
+	walPath := dbPath + "-wal"
+	out, err := os.Create(walPath)
+	if err != nil {
+		return 0, nil, err
+	}
+	var next int64
+	for _, seg := range group {
+		if seg.offset != next {
+			gapErr = fmt.Errorf("segment %s starts at %d, want %d", seg.key, seg.offset, next)
+			break
+		}
+		data, err := r.fetch(ctx, seg.key)
+		if err == nil {
+			_, err = out.Write(data)
+		}
+		if err != nil {
+			_ = out.Close()
+			return 0, nil, err
+		}
+		next += int64(len(data))
+		applied++
+	}
+	if err := out.Close(); err != nil {
+		return 0, nil, err
+	}
+	db, err := sql.Open("sqlite", dsnWithPragma(dbPath))
+	if err != nil {
+		return 0, nil, err
+	}
+	var busy, logFrames, ckpt int
+	err = db.QueryRowContext(ctx, `PRAGMA wal_checkpoint(TRUNCATE)`).Scan(&busy, &logFrames, &ckpt)
+	err = errors.Join(err, db.Close())
+	if err != nil {
+		return 0, nil, err
+	}
+	if busy != 0 {
+		return 0, nil, errors.New("wal checkpoint is busy")
+	}
+	for _, p := range []string{walPath, dbPath + "-shm"} {
+		if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return 0, nil, err
+		}
+	}
+	return applied, gapErr, nil
+}
+
+// fetch はオブジェクトをダウンロードし、暗号化されていれば復号して返します。
+func (r *Replicator) fetch(ctx context.Context, object string) ([]byte, error) {
+	f, err := os.CreateTemp("", "app-replica-*")
+	if err != nil {
+		return nil, err
+	}
+	tmp := f.Name()
+	_ = f.Close()
+	defer os.Remove(tmp)
+	if err := r.Store.Download(ctx, r.Bucket, object, tmp); err != nil {
+		return nil, fmt.Errorf("download %s: %w", object, err)
+	}
+	data, err := os.ReadFile(tmp)
+	if err != nil {
+		return nil, err
+	}
+	if !envelope.IsEncrypted(data) {
+		return data, nil
+	}
+	if r.Keyring == nil {
+		return nil, fmt.Errorf("%s is encrypted but no keys are configured", object)
+	}
+	data, err = r.Keyring.Decrypt(data, []byte(object))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", object, err)
+	}
+	return data, nil
+}
+
+// latestGeneration はスナップショットを持つ最新の世代と、そのスナップショットの index（昇順）、
+// WAL セグメント（index, offset の昇順）を返します。世代名は開始時刻で始まるため名前順が新しさの順です。
+func latestGeneration(objs []storageif.ObjectAttrs) (string, []int, []walSegment) {
+	snapshots := map[string][]int{}
+	segments := map[string][]walSegment{}
+	for _, o := range objs {
+		rest, ok := strings.CutPrefix(o.Name, generationsPrefix)
+		if !ok {
+			continue
+		}
+		gen, rest, ok := strings.Cut(rest, "/")
+		if !ok {
+			continue
+		}
+		switch dir, file := path.Split(rest); dir {
+		case "snapshots/":
+			if n, ok := strings.CutSuffix(file, ".sqlite"); ok {
+				if index, err := strconv.Atoi(n); err == nil {
+					snapshots[gen] = append(snapshots[gen], index)
+				}
+			}
+		case "wal/":
+			n, ok := strings.CutSuffix(file, ".wal")
+			if !ok {
+				continue
+			}
+			idx, off, ok := strings.Cut(n, "-")
+			if !ok {
+				continue
+			}
+			index, err1 := strconv.Atoi(idx)
+			offset, err2 := strconv.ParseInt(off, 10, 64)
+			if err1 != nil || err2 != nil {
+				continue
+			}
+			segments[gen] = append(segments[gen], walSegment{key: o.Name, index: index, offset: offset})
+		}
+	}
+	var latest string
+	for gen := range snapshots {
+		if gen > latest {
+			latest = gen
+		}
+	}
+	if latest == "" {
+		return "", nil, nil
+	}
+	sort.Ints(snapshots[latest])
+	segs := segments[latest]
+	sort.Slice(segs, func(i, j int) bool {
+		if segs[i].index != segs[j].index {
+			return segs[i].index < segs[j].index
+		}
+		return segs[i].offset < segs[j].offset
+	})
+	return latest, snapshots[latest], segs
+}
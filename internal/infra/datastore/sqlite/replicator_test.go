@@ -0,0 +1,332 @@
+package sqlite
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kawabatas/mini-web-app/internal/infra/storage/envelope"
+	"github.com/kawabatas/mini-web-app/internal/infra/storage/local"
+)
+
+// putObject はバケット（ディレクトリ）に更新時刻 at のオブジェクトを置きます。
+func putObject(t *testing.T, bucket, name string, data []byte, at time.Time) {
+	t.Helper()
+	p := filepath.Join(bucket, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(p, at, at); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// listObjects はバケットのオブジェクト名を名前順に返します。
+func listObjects(t *testing.T, bucket, prefix string) []string {
+	t.Helper()
+	objs, err := local.FS{}.List(context.Background(), bucket, prefix)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	var names []string
+	for _, o := range objs {
+		names = append(names, o.Name)
+	}
+	return names
+}
+
+func TestReplicator_Prune(t *testing.T) {
+	published := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	before, after := published.Add(-time.Hour), published.Add(time.Hour)
+	for name, tc := range map[string]struct {
+		objects map[string]time.Time
+		current string
+		want    []string // 残るオブジェクト
+	}{
+		"ended generation before the published snapshot": {
+			objects: map[string]time.Time{
+				"generations/g1/snapshots/00000000.sqlite":     before,
+				"generations/g1/wal/00000000-000000000000.wal": before,
+				"generations/g2/snapshots/00000000.sqlite":     after,
+			},
+			current: "g2",
+			want:    []string{"generations/g2/snapshots/00000000.sqlite"},
+		},
+		"generation still shipping after the published snapshot": {
+			objects: map[string]time.Time{
+				"generations/g1/snapshots/00000000.sqlite":     before,
+				"generations/g1/wal/00000000-000000000000.wal": after,
+			},
+			current: "g2",
+			want: []string{
+				"generations/g1/snapshots/00000000.sqlite",
+				"generations/g1/wal/00000000-000000000000.wal",
+			},
+		},
+		"current generation keeps the latest snapshot and later wal": {
+			objects: map[string]time.Time{
+				"generations/g1/snapshots/00000000.sqlite":     before,
+				"generations/g1/wal/00000000-000000000000.wal": before,
+				"generations/g1/wal/00000001-000000000000.wal": before,
+				"generations/g1/snapshots/00000002.sqlite":     before,
+				"generations/g1/wal/00000002-000000000000.wal": before,
+				"generations/g1/wal/00000002-000000004152.wal": after,
+			},
+			current: "g1",
+			want: []string{
+				"generations/g1/snapshots/00000002.sqlite",
+				"generations/g1/wal/00000002-000000000000.wal",
+				"generations/g1/wal/00000002-000000004152.wal",
+			},
+		},
+		"current generation without a snapshot": {
+			objects: map[string]time.Time{
+				"generations/g1/wal/00000000-000000000000.wal": before,
+			},
+			current: "g1",
+			want:    []string{"generations/g1/wal/00000000-000000000000.wal"},
+		},
+		"not shipping": {
+			objects: map[string]time.Time{
+				"generations/g1/snapshots/00000000.sqlite": before,
+				"backups/app-20261001-110000.sqlite":       before,
+			},
+			want: []string{"backups/app-20261001-110000.sqlite"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			bucket := t.TempDir()
+			for name, at := range tc.objects {
+				putObject(t, bucket, name, []byte(name), at)
+			}
+			r := NewReplicator(local.FS{}, bucket)
+			r.gen = tc.current
+			n, err := r.Prune(context.Background(), published)
+			if err != nil {
+				t.Fatalf("Prune: %v", err)
+			}
+			if got := listObjects(t, bucket, ""); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("remaining = %v, want %v", got, tc.want)
+			}
+			if want := len(tc.objects) - len(tc.want); n != want {
+				t.Errorf("Prune = %d, want %d", n, want)
+			}
+		})
+	}
+}
+
+// shipWrites は writes の歌手を 1 件ずつ追加して配送します。hold なら読み取りトランザクションを開いたままにして
+// チェックポイントを止め、同じ WAL index に複数のセグメントを配送します。
+func shipWrites(t *testing.T, r *Replicator, conns *Conns, hold bool, writes ...string) {
+	t.Helper()
+	ctx := context.Background()
+	if hold {
+		tx, err := conns.Reader.BeginTx(ctx, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var n int
+		if err := tx.QueryRow(`SELECT COUNT(1) FROM singers`).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		defer tx.Rollback()
+		// 止めたチェックポイントの待ち時間を短くする（書き込み接続は 1 本）
+		var timeout int
+		if err := conns.Writer.QueryRow(`PRAGMA busy_timeout`).Scan(&timeout); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := conns.Writer.Exec(`PRAGMA busy_timeout=10`); err != nil {
+			t.Fatal(err)
+		}
+		defer conns.Writer.Exec(fmt.Sprintf(`PRAGMA busy_timeout=%d`, timeout))
+	}
+	for _, name := range writes {
+		createSinger(t, conns, name)
+		if err := r.Sync(ctx); err != nil {
+			t.Fatalf("Sync: %v", err)
+		}
+	}
+}
+
+// testKey は id から決まる 32 バイトの鍵です。
+func testKey(id string) []byte { return []byte(strings.Repeat(id, 32)[:32]) }
+
+// testKeyring は鍵 id だけの Keyring を返します。
+func testKeyring(t *testing.T, id string) *envelope.Keyring {
+	t.Helper()
+	kr, err := envelope.NewKeyring(map[string][]byte{id: testKey(id)}, []string{id}, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kr
+}
+
+// replicaSegments はバケットの WAL セグメントのキーを名前順（index, offset 順）に返します。
+func replicaSegments(t *testing.T, bucket string) []string {
+	t.Helper()
+	var segs []string
+	for _, name := range listObjects(t, bucket, generationsPrefix) {
+		if strings.HasSuffix(name, ".wal") {
+			segs = append(segs, name)
+		}
+	}
+	return segs
+}
+
+func TestReplicator_Restore(t *testing.T) {
+	ctx := context.Background()
+	for name, tc := range map[string]struct {
+		// drop はバケットから消すセグメントを選びます（segs は index, offset 順）
+		drop     func(segs []string) []string
+		keyring  string // 配送時の鍵（空は暗号化しない）
+		restorer string // 復元時の鍵（空は鍵無し）
+		wantRows int
+		wantErr  bool
+	}{
+		// 初期データ 3 件 + index 0 に A〜D（4 セグメント）、index 1 に E、index 2 に F
+		"all segments": {wantRows: 9},
+		"gap within an index stops before it": {
+			drop:     func(segs []string) []string { return segs[1:2] },
+			wantRows: 4,
+		},
+		"missing index stops before it": {
+			drop:     func(segs []string) []string { return segs[4:5] },
+			wantRows: 7,
+		},
+		"missing last segment": {
+			drop:     func(segs []string) []string { return segs[len(segs)-1:] },
+			wantRows: 8,
+		},
+		"encrypted": {keyring: "k1", restorer: "k1", wantRows: 9},
+		"encrypted without keys": {
+			keyring: "k1",
+			wantErr: true,
+		},
+		"encrypted with another key": {
+			keyring:  "k1",
+			restorer: "k2",
+			wantErr:  true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			s := newTestStrategy(t)
+			conns, path := openTestDB(t)
+			r := NewReplicator(s.ObjectStore, s.Bucket)
+			r.Interval = time.Hour
+			if tc.keyring != "" {
+				r.Keyring = testKeyring(t, tc.keyring)
+			}
+			if err := r.Start(ctx, conns, path); err != nil {
+				t.Fatalf("Start: %v", err)
+			}
+			t.Cleanup(func() { _ = r.Stop(context.Background()) })
+			shipWrites(t, r, conns, true, "A", "B", "C")
+			shipWrites(t, r, conns, false, "D", "E", "F")
+
+			segs := replicaSegments(t, s.Bucket)
+			if len(segs) != 6 {
+				t.Fatalf("segments = %v, want 6", segs)
+			}
+			if tc.drop != nil {
+				for _, name := range tc.drop(segs) {
+					if err := (local.FS{}).Delete(ctx, s.Bucket, name); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			restorer := NewReplicator(s.ObjectStore, s.Bucket)
+			if tc.restorer != "" {
+				restorer.Keyring = testKeyring(t, tc.restorer)
+			}
+			dest := filepath.Join(t.TempDir(), FileName)
+			restored, err := restorer.Restore(ctx, dest)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("Restore succeeded, want an error")
+				}
+				return
+			}
+			if err != nil || !restored {
+				t.Fatalf("Restore = %v, %v", restored, err)
+			}
+			if n := countSingers(t, dest); n != tc.wantRows {
+				t.Fatalf("singers = %d, want %d", n, tc.wantRows)
+			}
+		})
+	}
+}
+
+func TestReplicator_RestoreWithoutGenerations(t *testing.T) {
+	r := NewReplicator(local.FS{}, t.TempDir())
+	restored, err := r.Restore(context.Background(), filepath.Join(t.TempDir(), FileName))
+	if err != nil || restored {
+		t.Fatalf("Restore = %v, %v; want false, nil", restored, err)
+	}
+}
+
+// testWAL は page size 512 の WAL を作ります。frames は各フレームがコミットか（'c'）否か（'-'）、前回の WAL の残骸か（'s'）です。
+func testWAL(frames string) []byte {
+	const pageSize = 512
+	wal := make([]byte, walHeaderSize)
+	binary.BigEndian.PutUint32(wal[0:4], 0x377f0682)
+	binary.BigEndian.PutUint32(wal[8:12], pageSize)
+	copy(wal[16:24], "saltsalt")
+	for i, f := range frames {
+		fh := make([]byte, walFrameHeaderSize+pageSize)
+		binary.BigEndian.PutUint32(fh[0:4], uint32(i+1))
+		if f == 'c' || f == 's' {
+			binary.BigEndian.PutUint32(fh[4:8], uint32(i+1))
+		}
+		copy(fh[8:16], "saltsalt")
+		if f == 's' {
+			copy(fh[8:16], "oldsalts")
+		}
+		wal = append(wal, fh...)
+	}
+	return wal
+}
+
+func TestWALCommittedEnd(t *testing.T) {
+	const frame = walFrameHeaderSize + 512
+	for name, tc := range map[string]struct {
+		wal     []byte
+		from    int
+		want    int
+		wantErr bool
+	}{
+		"single commit":                {wal: testWAL("c"), want: walHeaderSize + frame},
+		"uncommitted tail is excluded": {wal: testWAL("c-"), want: walHeaderSize + frame},
+		"frames up to the last commit": {wal: testWAL("-c-c"), want: walHeaderSize + 4*frame},
+		"no commit returns from":       {wal: testWAL("--"), want: 0},
+		"stops at a stale salt":        {wal: testWAL("cs"), want: walHeaderSize + frame},
+		"resumes from an offset":       {wal: testWAL("cc"), from: walHeaderSize + frame, want: walHeaderSize + 2*frame},
+		"nothing new after the offset": {wal: testWAL("c-"), from: walHeaderSize + frame, want: walHeaderSize + frame},
+		"truncated frame is ignored":   {wal: testWAL("cc")[:walHeaderSize+frame+100], want: walHeaderSize + frame},
+		"offset off a frame boundary":  {wal: testWAL("cc"), from: walHeaderSize + 10, wantErr: true},
+		"invalid magic":                {wal: make([]byte, walHeaderSize), wantErr: true},
+		"header too short":             {wal: make([]byte, 10), wantErr: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			got, err := walCommittedEnd(tc.wal, tc.from)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("walCommittedEnd = %d, want an error", got)
+				}
+				return
+			}
+			if err != nil || got != tc.want {
+				t.Fatalf("walCommittedEnd = %d, %v; want %d", got, err, tc.want)
+			}
+		})
+	}
+}
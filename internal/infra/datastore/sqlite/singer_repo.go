@@ -3,36 +3,271 @@ package sqlite
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"strconv"
+	"time"
 
 	"github.com/kawabatas/mini-web-app/internal/domain/model"
+	"github.com/kawabatas/mini-web-app/internal/domain/repository"
+	"github.com/kawabatas/mini-web-app/internal/infra/datastore/sqlq"
+	"github.com/kawabatas/mini-web-app/internal/util/clock"
 )
 
-type SingerRepo struct{ db *sql.DB }
+// dbtx は *sql.DB / *sql.Tx の共通部分です。
+type dbtx interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// SingerRepo は参照系を r（読み取りプール）、更新系を w（単一の書き込み接続）に振り分けます。
+type SingerRepo struct{ r, w dbtx }
+
+func NewSingerRepo(c *Conns) *SingerRepo { return &SingerRepo{r: c.Reader, w: c.Writer} }
 
-func NewSingerRepo(db *sql.DB) *SingerRepo { return &SingerRepo{db: db} }
+// NewSingerRepoTx はトランザクションに束縛された SingerRepo を返します（参照・更新とも tx を使用）。
+func NewSingerRepoTx(tx *sql.Tx) *SingerRepo { return &SingerRepo{r: tx, w: tx} }
 
-func (r *SingerRepo) List(ctx context.Context, offset, limit int) ([]model.Singer, error) {
-	if offset < 0 || limit <= 0 {
-		return nil, fmt.Errorf("invalid offset/limit: %d/%d", offset, limit)
+const singerColumns = `id, name, genre, debut_year, created_at, version, deleted_at`
+
+func (r *SingerRepo) List(ctx context.Context, q repository.SingerListQuery) ([]model.Singer, error) {
+	if q.Limit <= 0 {
+		return nil, fmt.Errorf("invalid limit: %d", q.Limit)
+	}
+	orders, err := singerOrders(q.Sort)
+	if err != nil {
+		return nil, err
+	}
+	conds := singerConds(q.Filter)
+	var backward bool
+	if q.After != nil {
+		vals, err := singerKeyValues(q.Sort, q.After)
+		if err != nil {
+			return nil, err
+		}
+		backward = q.After.Backward
+		cond, args := sqlq.Keyset(orders, vals, backward)
+		conds.Add(cond, args...)
 	}
-	rows, err := r.db.QueryContext(ctx, `
-SELECT id, name, genre, debut_year, created_at
+	rows, err := r.r.QueryContext(ctx, `
+SELECT `+singerColumns+`
 FROM singers
-ORDER BY id ASC
-LIMIT ? OFFSET ?
-`, limit, offset)
+`+conds.Where()+`
+ORDER BY `+sqlq.OrderBy(orders, backward)+`
+LIMIT ?
+`, append(conds.Args(), q.Limit)...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	var out []model.Singer
 	for rows.Next() {
-		var s model.Singer
-		if err := rows.Scan(&s.ID, &s.Name, &s.Genre, &s.DebutYear, &s.CreatedAt); err != nil {
+		s, err := scanSinger(rows)
+		if err != nil {
 			return nil, err
 		}
 		out = append(out, s)
 	}
 	return out, rows.Err()
 }
+
+func (r *SingerRepo) Count(ctx context.Context, filter repository.SingerFilter) (int, error) {
+	conds := singerConds(filter)
+	var n int
+	err := r.r.QueryRowContext(ctx, `SELECT COUNT(1) FROM singers `+conds.Where(), conds.Args()...).Scan(&n)
+	return n, err
+}
+
+func (r *SingerRepo) Get(ctx context.Context, id int64) (model.Singer, error) {
+	row := r.r.QueryRowContext(ctx, `SELECT `+singerColumns+` FROM singers WHERE id = ? AND deleted_at IS NULL`, id)
+	return scanSingerRow(row)
+}
+
+func (r *SingerRepo) Create(ctx context.Context, s model.Singer) (model.Singer, error) {
+	row := r.w.QueryRowContext(ctx, `
+INSERT INTO singers(name, genre, debut_year) VALUES (?, ?, ?)
+RETURNING `+singerColumns,
+		s.Name, s.Genre, s.DebutYear)
+	return scanSingerRow(row)
+}
+
+func (r *SingerRepo) Update(ctx context.Context, s model.Singer) (model.Singer, error) {
+	row := r.w.QueryRowContext(ctx, `
+UPDATE singers SET name = ?, genre = ?, debut_year = ?, version = version + 1
+WHERE id = ? AND version = ? AND deleted_at IS NULL
+RETURNING `+singerColumns,
+		s.Name, s.Genre, s.DebutYear, s.ID, s.Version)
+	out, err := scanSingerRow(row)
+	if errors.Is(err, repository.ErrNotFound) {
+		return model.Singer{}, r.missReason(ctx, s.ID)
+	}
+	return out, err
+}
+
+// Delete は deleted_at を設定して論理削除します（バージョンも +1）。
+func (r *SingerRepo) Delete(ctx context.Context, id, version int64) error {
+	res, err := r.w.ExecContext(ctx, `
+UPDATE singers SET deleted_at = ?, version = version + 1
+WHERE id = ? AND version = ? AND deleted_at IS NULL`,
+		timestampText(clock.Now()), id, version)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return r.missReason(ctx, id)
+	}
+	return nil
+}
+
+func (r *SingerRepo) Restore(ctx context.Context, id int64) (model.Singer, error) {
+	row := r.w.QueryRowContext(ctx, `
+UPDATE singers SET deleted_at = NULL, version = version + 1
+WHERE id = ? AND deleted_at IS NOT NULL
+RETURNING `+singerColumns, id)
+	return scanSingerRow(row)
+}
+
+func (r *SingerRepo) Purge(ctx context.Context, before time.Time) (int64, error) {
+	res, err := r.w.ExecContext(ctx, `DELETE FROM singers WHERE deleted_at IS NOT NULL AND deleted_at < ?`, timestampText(before))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// missReason はバージョン付きの更新・削除が 0 件だった理由を判定します。
+// 未削除のレコードが存在すればバージョン不一致（ErrVersionConflict）、無ければ ErrNotFound。
+// 書き込み接続（またはトランザクション）で確認し、直前の書き込みと同じスナップショットを参照します。
+func (r *SingerRepo) missReason(ctx context.Context, id int64) error {
+	var one int
+	err := r.w.QueryRowContext(ctx, `SELECT 1 FROM singers WHERE id = ? AND deleted_at IS NULL`, id).Scan(&one)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return repository.ErrNotFound
+	case err != nil:
+		return err
+	}
+	return repository.ErrVersionConflict
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSinger(row rowScanner) (model.Singer, error) {
+	var (
+		s         model.Singer
+		deletedAt sql.NullTime
+	)
+	err := row.Scan(&s.ID, &s.Name, &s.Genre, &s.DebutYear, &s.CreatedAt, &s.Version, &deletedAt)
+	if deletedAt.Valid {
+		s.DeletedAt = &deletedAt.Time
+	}
+	return s, err
+}
+
+// scanSingerRow は単一行の結果を読み取り、SQLite のエラーをリポジトリのエラーに変換します。
+func scanSingerRow(row *sql.Row) (model.Singer, error) {
+	s, err := scanSinger(row)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return model.Singer{}, repository.ErrNotFound
+	case isUniqueErr(err):
+		return model.Singer{}, fmt.Errorf("%w: %v", repository.ErrConflict, err)
+	case err != nil:
+		return model.Singer{}, err
+	}
+	return s, nil
+}
+
+// singerConds は絞り込み条件をパラメータ化した WHERE 条件に変換します。
+func singerConds(f repository.SingerFilter) *sqlq.Conds {
+	var c sqlq.Conds
+	if !f.IncludeDeleted {
+		c.Add("deleted_at IS NULL")
+	}
+	if f.Genre != nil {
+		c.Add("genre = ?", *f.Genre)
+	}
+	for _, x := range []struct {
+		op string
+		v  *int
+	}{{"=", f.DebutYear.Eq}, {">", f.DebutYear.Gt}, {">=", f.DebutYear.Gte}, {"<", f.DebutYear.Lt}, {"<=", f.DebutYear.Lte}} {
+		if x.v != nil {
+			c.Add("debut_year "+x.op+" ?", *x.v)
+		}
+	}
+	for _, x := range []struct {
+		op string
+		v  *time.Time
+	}{{">", f.CreatedAt.Gt}, {">=", f.CreatedAt.Gte}, {"<", f.CreatedAt.Lt}, {"<=", f.CreatedAt.Lte}} {
+		if x.v != nil {
+			c.Add("created_at "+x.op+" ?", timestampText(*x.v))
+		}
+	}
+	return &c
+}
+
+// singerSortColumns はソート可能なフィールドと列の対応です（ORDER BY に埋め込むためのホワイトリスト）。
+var singerSortColumns = map[string]string{
+	repository.SingerFieldName:      "name",
+	repository.SingerFieldGenre:     "genre",
+	repository.SingerFieldDebutYear: "debut_year",
+	repository.SingerFieldCreatedAt: "created_at",
+}
+
+// singerOrders はソート指定を列の並びに変換し、末尾に id 昇順を付けます。
+func singerOrders(sort []repository.SortField) ([]sqlq.Order, error) {
+	orders := make([]sqlq.Order, 0, len(sort)+1)
+	for _, f := range sort {
+		col, ok := singerSortColumns[f.Field]
+		if !ok {
+			return nil, fmt.Errorf("unsupported sort field: %q", f.Field)
+		}
+		orders = append(orders, sqlq.Order{Column: col, Desc: f.Desc})
+	}
+	return append(orders, sqlq.Order{Column: "id"}), nil
+}
+
+// singerKeyValues はキーセットの文字列表現を列の型の値に変換します（末尾は id）。
+func singerKeyValues(sort []repository.SortField, k *repository.Keyset) ([]any, error) {
+	if len(k.Values) != len(sort) {
+		return nil, fmt.Errorf("keyset has %d values for %d sort fields", len(k.Values), len(sort))
+	}
+	vals := make([]any, 0, len(sort)+1)
+	for i, f := range sort {
+		v, err := singerFieldValue(f.Field, k.Values[i])
+		if err != nil {
+			return nil, err
+		}
+		vals = append(vals, v)
+	}
+	return append(vals, k.ID), nil
+}
+
+// singerFieldValue はフィールド値の文字列表現を SQLite にバインドする値に変換します。
+func singerFieldValue(field, v string) (any, error) {
+	switch field {
+	case repository.SingerFieldDebutYear:
+		return strconv.Atoi(v)
+	case repository.SingerFieldCreatedAt:
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return nil, err
+		}
+		return timestampText(t), nil
+	default:
+		return v, nil
+	}
+}
+
+// timestampText は CURRENT_TIMESTAMP と同じ形式（UTC, 秒精度）の文字列に変換します。
+// TIMESTAMP 列は文字列として比較されるため、比較対象の値は保存形式に揃える必要があります。
+func timestampText(t time.Time) string {
+	return t.UTC().Format(time.DateTime)
+}
@@ -0,0 +1,116 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/kawabatas/mini-web-app/internal/domain/model"
+	"github.com/kawabatas/mini-web-app/internal/domain/repository"
+	"github.com/kawabatas/mini-web-app/internal/infra/datastore/sqlq"
+)
+
+// trigramMinLen は trigram トークナイザで MATCH できる語の最小文字数です。
+const trigramMinLen = 3
+
+// searchOrders は検索結果の並び順です（関連度の高い順、同点は id 昇順）。
+var searchOrders = []sqlq.Order{{Column: "score", Desc: true}, {Column: "id"}}
+
+// Search は singers_fts（FTS5 / trigram）で部分一致検索し、bm25 の順に返します。
+//
+// 3 文字未満の語は trigram で索引されないため、LIKE による絞り込みに切り替えます。
+// すべての語が 3 文字未満の場合は関連度を計算できないため、id 順で返します（Score は 0）。
+func (r *SingerRepo) Search(ctx context.Context, q repository.SingerSearchQuery) ([]model.SingerHit, error) {
+	if q.Limit <= 0 {
+		return nil, fmt.Errorf("invalid limit: %d", q.Limit)
+	}
+	var (
+		match []string
+		conds []string
+		args  []any
+	)
+	for _, term := range strings.Fields(q.Query) {
+		if utf8.RuneCountInString(term) >= trigramMinLen {
+			// 語をフレーズとして扱い、FTS5 の演算子（AND / OR / * など）を無効化する
+			match = append(match, `"`+strings.ReplaceAll(term, `"`, `""`)+`"`)
+			continue
+		}
+		like := "%" + escapeLike(term) + "%"
+		conds = append(conds, `(s.name LIKE ? ESCAPE '\' OR s.genre LIKE ? ESCAPE '\')`)
+		args = append(args, like, like)
+	}
+	if len(match) == 0 && len(conds) == 0 {
+		return nil, nil
+	}
+	conds = append(conds, `s.deleted_at IS NULL`)
+
+	var hits string
+	if len(match) > 0 {
+		// bm25 は小さいほど関連度が高い。name の一致を genre より重視する
+		hits = `
+SELECT s.id, s.name, s.genre, s.debut_year, s.created_at, s.version, -bm25(singers_fts, 10.0, 1.0) AS score
+FROM singers_fts
+JOIN singers s ON s.id = singers_fts.rowid
+WHERE singers_fts MATCH ?`
+		args = append([]any{strings.Join(match, " ")}, args...)
+		for _, c := range conds {
+			hits += "\n  AND " + c
+		}
+	} else {
+		hits = `
+SELECT s.id, s.name, s.genre, s.debut_year, s.created_at, s.version, 0.0 AS score
+FROM singers s
+WHERE ` + strings.Join(conds, "\n  AND ")
+	}
+
+	// score は bm25 の計算結果のため、キーセットの比較は副問い合わせの外側で行う
+	var (
+		outer    sqlq.Conds
+		backward bool
+	)
+	if q.After != nil {
+		score, err := searchScore(q.After)
+		if err != nil {
+			return nil, err
+		}
+		backward = q.After.Backward
+		cond, kargs := sqlq.Keyset(searchOrders, []any{score, q.After.ID}, backward)
+		outer.Add(cond, kargs...)
+	}
+	rows, err := r.r.QueryContext(ctx, `
+SELECT id, name, genre, debut_year, created_at, version, score
+FROM (`+hits+`
+) AS hits
+`+outer.Where()+`
+ORDER BY `+sqlq.OrderBy(searchOrders, backward)+`
+LIMIT ?
+`, append(append(args, outer.Args()...), q.Limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []model.SingerHit
+	for rows.Next() {
+		var h model.SingerHit
+		if err := rows.Scan(&h.ID, &h.Name, &h.Genre, &h.DebutYear, &h.CreatedAt, &h.Version, &h.Score); err != nil {
+			return nil, err
+		}
+		out = append(out, h)
+	}
+	return out, rows.Err()
+}
+
+// searchScore はキーセットの Score の文字列表現を float64 に変換します。
+func searchScore(k *repository.Keyset) (float64, error) {
+	if len(k.Values) != 1 {
+		return 0, fmt.Errorf("keyset has %d values for the search score", len(k.Values))
+	}
+	return strconv.ParseFloat(k.Values[0], 64)
+}
+
+// escapeLike は LIKE のワイルドカードをエスケープします（ESCAPE '\' と組み合わせて使用）。
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
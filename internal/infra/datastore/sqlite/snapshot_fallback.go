@@ -0,0 +1,159 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	storageif "github.com/kawabatas/mini-web-app/internal/infra/storage"
+)
+
+// 起動時の DB の復元元（backups/ から復元した場合はそのキー）
+const (
+	StartupSourceEmpty   = "empty"
+	StartupSourceCurrent = "current"
+	StartupSourceReplica = "wal-replica"
+)
+
+// StartupReport は起動時にどこから DB を復元したかの記録です。
+type StartupReport struct {
+	Source string `json:"source"`
+	// Degraded は current が無い・壊れているため backups/ の過去のスナップショットから復元したことを表します
+	// （そのスナップショット以降の書き込みは失われています）。
+	Degraded bool   `json:"degraded"`
+	Reason   string `json:"reason,omitempty"` // current を使えなかった理由
+}
+
+// Startup は OnStartup と同じく DB を復元し、その復元元を返します。
+// current は展開・チェックサムに加えて integrity_check も行い、無い・壊れている場合は backups/ を新しい順に遡って
+// 最初に検査を通ったスナップショットを使います（degraded）。バケットが空の初回起動のみ空の DB で始め、
+// 使えるスナップショットが 1 つも無い場合はエラーを返します（空の DB で黙って起動しない）。
+// Replicator があれば、WAL のレプリカが current より新しい場合にレプリカから復元します（replicaIsNewer）。
+// Hold があれば、current より新しいスナップショットが quarantine/ に残っている場合に公開を止めます（holdIfQuarantineIsNewer）。
+func (s GCSSnapshotStrategy) Startup(ctx context.Context, dbPath string) (StartupReport, error) {
+	rep, err := s.startup(ctx, dbPath)
+	if err == nil && s.Hold != nil && rep.Source != StartupSourceEmpty {
+		if err := s.holdIfQuarantineIsNewer(ctx); err != nil {
+			slog.ErrorContext(ctx, "check quarantined snapshots failed", slog.Any("error", err))
+		}
+	}
+	return rep, err
+}
+
+func (s GCSSnapshotStrategy) startup(ctx context.Context, dbPath string) (StartupReport, error) {
+	if s.ObjectStore == nil || s.Bucket == "" {
+		return StartupReport{Source: StartupSourceEmpty}, nil
+	}
+	// 以降の公開の前提となる current の世代番号（current から復元した場合はダウンロードした世代番号で置き換える）
+	if err := s.observeCurrent(ctx); err != nil {
+		return StartupReport{}, err
+	}
+	if s.Replicator != nil && s.replicaIsNewer(ctx) {
+		restored, err := s.Replicator.Restore(ctx, dbPath)
+		if err == nil && restored {
+			err = verifyStartupFile(ctx, dbPath)
+			if err == nil {
+				return StartupReport{Source: StartupSourceReplica}, nil
+			}
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "restore from wal replica failed; falling back to current snapshot", slog.Any("error", err))
+		}
+	}
+
+	gen, currentErr := s.restoreVerified(ctx, FileName, dbPath)
+	if currentErr == nil {
+		if s.Fence != nil {
+			s.Fence.Observe(gen)
+		}
+		return StartupReport{Source: StartupSourceCurrent}, nil
+	}
+	if ctx.Err() != nil {
+		return StartupReport{}, ctx.Err()
+	}
+	missing := errors.Is(currentErr, storageif.ErrNotExist)
+	snaps, err := s.ListSnapshots(ctx)
+	if err != nil {
+		return StartupReport{}, fmt.Errorf("list backups: %w (current: %v)", err, currentErr)
+	}
+	if len(snaps) == 0 {
+		if missing {
+			// バケットが空（初回起動）
+			slog.WarnContext(ctx, "no snapshot found in bucket; starting with an empty database", slog.String("bucket", s.Bucket))
+			f, err := os.Create(dbPath)
+			if err != nil {
+				return StartupReport{}, err
+			}
+			return StartupReport{Source: StartupSourceEmpty}, f.Close()
+		}
+		return StartupReport{}, fmt.Errorf("current snapshot is unusable and no backups exist: %w", currentErr)
+	}
+
+	reason := "current snapshot not found"
+	if !missing {
+		reason = currentErr.Error()
+	}
+	slog.ErrorContext(ctx, "current snapshot is unusable; falling back to backups", slog.String("reason", reason))
+	for i := len(snaps) - 1; i >= 0; i-- {
+		key := snaps[i].Key
+		if _, err := s.restoreVerified(ctx, key, dbPath); err != nil {
+			if ctx.Err() != nil {
+				return StartupReport{}, ctx.Err()
+			}
+			slog.ErrorContext(ctx, "backup snapshot is unusable", slog.String("object", key), slog.Any("error", err))
+			continue
+		}
+		slog.ErrorContext(ctx, "DEGRADED START: restored from an older backup; writes after it are lost",
+			slog.String("object", key), slog.Time("snapshot_at", snaps[i].At), slog.String("reason", reason))
+		return StartupReport{Source: key, Degraded: true, Reason: reason}, nil
+	}
+	return StartupReport{}, fmt.Errorf("no healthy snapshot found in current or backups/: %w", currentErr)
+}
+
+// replicaIsNewer は WAL のレプリカが current 以降の書き込みを含むか（current より新しいか）を返します。
+// 最新世代に最後に配送した時刻が current のスナップショットを取り始めた時刻（マニフェストの CreatedAt）より前なら、
+// 配送が止まっていた間に current が公開されているため current を使います。比べられない場合はレプリカを使います。
+func (s GCSSnapshotStrategy) replicaIsNewer(ctx context.Context) bool {
+	last, err := s.Replicator.LastShipped(ctx)
+	if err != nil {
+		slog.WarnContext(ctx, "list wal replica failed", slog.Any("error", err))
+		return true
+	}
+	if last.IsZero() {
+		return false
+	}
+	m, err := s.currentManifest(ctx)
+	if err != nil {
+		slog.WarnContext(ctx, "read current manifest failed; restoring from wal replica", slog.Any("error", err))
+		return true
+	}
+	if m == nil || !last.Before(m.CreatedAt) {
+		return true
+	}
+	slog.WarnContext(ctx, "wal replica is older than current snapshot; restoring from current",
+		slog.Time("replica_shipped_at", last), slog.Time("current_created_at", m.CreatedAt))
+	return false
+}
+
+// restoreVerified は object をダウンロード・展開して dbPath に配置し、integrity_check まで行います（object の世代番号を返す）。
+func (s GCSSnapshotStrategy) restoreVerified(ctx context.Context, object, dbPath string) (int64, error) {
+	_, gen, err := s.downloadSnapshot(ctx, object, dbPath)
+	if err != nil {
+		return 0, err
+	}
+	return gen, verifyStartupFile(ctx, dbPath)
+}
+
+func verifyStartupFile(ctx context.Context, dbPath string) error {
+	problems, err := VerifySnapshotFile(ctx, dbPath, VerifyPolicy{})
+	if err != nil {
+		return err
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s: %s", dbPath, strings.Join(problems, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kawabatas/mini-web-app/internal/domain/model"
+)
+
+// countSingers は DB ファイル path の歌手の行数を返します。
+func countSingers(t *testing.T, path string) int {
+	t.Helper()
+	db, err := sql.Open("sqlite", dsnWithPragma(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(1) FROM singers`).Scan(&n); err != nil {
+		t.Fatalf("count singers: %v", err)
+	}
+	return n
+}
+
+func createSinger(t *testing.T, conns *Conns, name string) {
+	t.Helper()
+	if _, err := NewSingerRepo(conns).Create(context.Background(), model.Singer{Name: name, Genre: "Pop", DebutYear: 2000}); err != nil {
+		t.Fatalf("Create(%s): %v", name, err)
+	}
+}
+
+// startTestReplicator は s のバケットに WAL を配送する Replicator を開始します（配送は Sync を呼んだときのみ）。
+func startTestReplicator(t *testing.T, s GCSSnapshotStrategy, conns *Conns, path string) *Replicator {
+	t.Helper()
+	r := NewReplicator(s.ObjectStore, s.Bucket)
+	r.Interval = time.Hour
+	if err := r.Start(context.Background(), conns, path); err != nil {
+		t.Fatalf("Replicator.Start: %v", err)
+	}
+	t.Cleanup(func() { _ = r.Stop(context.Background()) })
+	return r
+}
+
+func TestStartup_PrefersNewerOfReplicaAndCurrent(t *testing.T) {
+	ctx := context.Background()
+	for name, tc := range map[string]struct {
+		// prepare は初期データ（3 件）の DB から、レプリカと current を作ります
+		prepare    func(t *testing.T, s GCSSnapshotStrategy, conns *Conns, path string)
+		wantSource string
+		wantRows   int
+	}{
+		"replica has writes after current": {
+			prepare: func(t *testing.T, s GCSSnapshotStrategy, conns *Conns, path string) {
+				if err := s.upload(ctx, path); err != nil {
+					t.Fatalf("upload: %v", err)
+				}
+				r := startTestReplicator(t, s, conns, path)
+				createSinger(t, conns, "Adele")
+				if err := r.Sync(ctx); err != nil {
+					t.Fatalf("Sync: %v", err)
+				}
+			},
+			wantSource: StartupSourceReplica,
+			wantRows:   4,
+		},
+		"replica stopped before current was published": {
+			prepare: func(t *testing.T, s GCSSnapshotStrategy, conns *Conns, path string) {
+				r := startTestReplicator(t, s, conns, path)
+				createSinger(t, conns, "Adele")
+				if err := r.Stop(ctx); err != nil {
+					t.Fatalf("Stop: %v", err)
+				}
+				// 配送を止めた後の書き込みは current にだけある
+				createSinger(t, conns, "Beyonce")
+				if err := s.upload(ctx, path); err != nil {
+					t.Fatalf("upload: %v", err)
+				}
+			},
+			wantSource: StartupSourceCurrent,
+			wantRows:   5,
+		},
+		"replica without current": {
+			prepare: func(t *testing.T, s GCSSnapshotStrategy, conns *Conns, path string) {
+				r := startTestReplicator(t, s, conns, path)
+				createSinger(t, conns, "Adele")
+				if err := r.Sync(ctx); err != nil {
+					t.Fatalf("Sync: %v", err)
+				}
+			},
+			wantSource: StartupSourceReplica,
+			wantRows:   4,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			s := newTestStrategy(t)
+			conns, path := openTestDB(t)
+			tc.prepare(t, s, conns, path)
+
+			next := s
+			next.Fence, next.Hold = &PublishFence{}, &PublishHold{}
+			next.Replicator = NewReplicator(s.ObjectStore, s.Bucket)
+			dest := filepath.Join(t.TempDir(), FileName)
+			rep, err := next.Startup(ctx, dest)
+			if err != nil || rep.Source != tc.wantSource {
+				t.Fatalf("Startup = %+v, %v; want source %q", rep, err, tc.wantSource)
+			}
+			if n := countSingers(t, dest); n != tc.wantRows {
+				t.Fatalf("singers = %d, want %d", n, tc.wantRows)
+			}
+		})
+	}
+}
+
+// putSnapshot は snap を圧縮してマニフェストとともにバケットの key に置きます。
+// corrupt ならマニフェストと食い違う（チェックサムの合わない）データを置きます。
+func putSnapshot(t *testing.T, bucket, key, snap string, corrupt bool) {
+	t.Helper()
+	packed, m := packTestSnapshot(t, snap, CompressionZstd)
+	data, err := os.ReadFile(packed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if corrupt {
+		data[len(data)/2] ^= 0xff
+	}
+	mp, err := WriteManifest(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(mp)
+	mb, err := os.ReadFile(mp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Now()
+	putObject(t, bucket, key, data, at)
+	putObject(t, bucket, ManifestKey(key), mb, at)
+}
+
+func TestStartup_FallsBackToBackups(t *testing.T) {
+	ctx := context.Background()
+	// 初期データ（3 件）のスナップショットと、1 件追加した（4 件の）スナップショット
+	conns, path := openTestDB(t)
+	older := filepath.Join(t.TempDir(), "older.sqlite")
+	if err := SnapshotTo(ctx, path, older); err != nil {
+		t.Fatalf("SnapshotTo: %v", err)
+	}
+	createSinger(t, conns, "Adele")
+	newer := filepath.Join(t.TempDir(), "newer.sqlite")
+	if err := SnapshotTo(ctx, path, newer); err != nil {
+		t.Fatalf("SnapshotTo: %v", err)
+	}
+	base := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+	olderKey, newerKey := backupKeyAt(base), backupKeyAt(base.Add(time.Hour))
+
+	type object struct {
+		snap    string
+		corrupt bool
+	}
+	for name, tc := range map[string]struct {
+		objects      map[string]object
+		wantSource   string
+		wantDegraded bool
+		wantRows     int
+		wantErr      bool
+	}{
+		"empty bucket starts empty": {
+			wantSource: StartupSourceEmpty,
+		},
+		"healthy current": {
+			objects:    map[string]object{FileName: {snap: newer}, olderKey: {snap: older}},
+			wantSource: StartupSourceCurrent,
+			wantRows:   4,
+		},
+		"missing current uses the newest backup": {
+			objects:      map[string]object{olderKey: {snap: older}, newerKey: {snap: newer}},
+			wantSource:   newerKey,
+			wantDegraded: true,
+			wantRows:     4,
+		},
+		"corrupted current uses the newest backup": {
+			objects:      map[string]object{FileName: {snap: newer, corrupt: true}, olderKey: {snap: older}, newerKey: {snap: newer}},
+			wantSource:   newerKey,
+			wantDegraded: true,
+			wantRows:     4,
+		},
+		"corrupted backups are skipped": {
+			objects:      map[string]object{FileName: {snap: newer, corrupt: true}, olderKey: {snap: older}, newerKey: {snap: newer, corrupt: true}},
+			wantSource:   olderKey,
+			wantDegraded: true,
+			wantRows:     3,
+		},
+		"corrupted current without backups": {
+			objects: map[string]object{FileName: {snap: newer, corrupt: true}},
+			wantErr: true,
+		},
+		"no healthy snapshot": {
+			objects: map[string]object{FileName: {snap: newer, corrupt: true}, olderKey: {snap: older, corrupt: true}},
+			wantErr: true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel() // 壊れたオブジェクトは再試行のため 1 秒待つ
+			s := newTestStrategy(t)
+			for key, o := range tc.objects {
+				putSnapshot(t, s.Bucket, key, o.snap, o.corrupt)
+			}
+			dest := filepath.Join(t.TempDir(), FileName)
+			rep, err := s.Startup(ctx, dest)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("Startup = %+v, want an error", rep)
+				}
+				return
+			}
+			if err != nil || rep.Source != tc.wantSource || rep.Degraded != tc.wantDegraded || (rep.Reason != "") != tc.wantDegraded {
+				t.Fatalf("Startup = %+v, %v; want source %q (degraded %v)", rep, err, tc.wantSource, tc.wantDegraded)
+			}
+			if tc.wantRows == 0 {
+				if fi, err := os.Stat(dest); err != nil || fi.Size() != 0 {
+					t.Fatalf("empty database = %v, %v", fi, err)
+				}
+				return
+			}
+			if n := countSingers(t, dest); n != tc.wantRows {
+				t.Fatalf("singers = %d, want %d", n, tc.wantRows)
+			}
+		})
+	}
+}
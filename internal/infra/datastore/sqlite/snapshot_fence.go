@@ -0,0 +1,163 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	storageif "github.com/kawabatas/mini-web-app/internal/infra/storage"
+)
+
+// conflictsPrefix は他のインスタンスが先に current を置き換えていたため公開できなかったスナップショットのプレフィックスです。
+const conflictsPrefix = "conflicts/"
+
+// ErrPublishConflict は、起動時（または前回の公開時）に読んだ後で他のインスタンスが current を置き換えていたため、
+// スナップショットを公開しなかったことを表します（デプロイ中の 2 インスタンスの重複など）。
+var ErrPublishConflict = errors.New("current snapshot was published by another instance")
+
+// PublishFence は current を最後に読み書きした時点の世代番号を保持し、他のインスタンスによる置き換えの上書きを防ぎます。
+// current の公開はこの世代番号を前提条件にして行い、一致しなければ公開しません（以降の公開も失敗し続ける）。
+type PublishFence struct {
+	mu    sync.Mutex
+	gen   int64
+	known bool
+}
+
+// Generation は前提とする current の世代番号（0 は current が存在しないこと）を返します。
+// まだ記録していなければ ok は false です。
+func (f *PublishFence) Generation() (gen int64, ok bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.gen, f.known
+}
+
+// Observe は current の世代番号 gen を読んだ・書いたことを記録します。
+func (f *PublishFence) Observe(gen int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.gen, f.known = gen, true
+}
+
+// observeCurrent は現在の current の世代番号を記録します（存在しなければ 0）。
+func (s GCSSnapshotStrategy) observeCurrent(ctx context.Context) error {
+	if s.Fence == nil {
+		return nil
+	}
+	attrs, err := s.ObjectStore.Stat(ctx, s.Bucket, FileName)
+	if errors.Is(err, storageif.ErrNotExist) {
+		s.Fence.Observe(0)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("stat current snapshot: %w", err)
+	}
+	s.Fence.Observe(attrs.Generation)
+	return nil
+}
+
+// publish は packed を current と backupKey に二相アップロードし、公開した current の世代番号を返します（Fence が無ければ 0）。
+// Fence があれば current の世代番号を前提条件とし、他者が先に置き換えていた場合は conflicts/ に保管して ErrPublishConflict を返します。
+func (s GCSSnapshotStrategy) publish(ctx context.Context, backupKey, snap, packed, manifestPath string, at time.Time) (int64, error) {
+	gen, known := int64(0), false
+	if s.Fence != nil {
+		gen, known = s.Fence.Generation()
+	}
+	if !known {
+		return 0, s.ObjectStore.UploadTwoPhaseWithBackup(ctx, s.Bucket, FileName, backupKey, packed)
+	}
+	newGen, err := s.ObjectStore.UploadTwoPhaseIfGeneration(ctx, s.Bucket, FileName, backupKey, packed, gen)
+	if errors.Is(err, storageif.ErrPreconditionFailed) {
+		key, aErr := s.saveAside(ctx, conflictsPrefix, snap, packed, manifestPath, at)
+		if aErr != nil {
+			slog.ErrorContext(ctx, "save conflicting snapshot failed", slog.Any("error", aErr))
+		}
+		slog.ErrorContext(ctx, "SPLIT BRAIN: current was replaced by another instance; this snapshot is not published",
+			slog.Int64("expected_generation", gen), slog.String("saved_as", key))
+		return 0, fmt.Errorf("%w: %v", ErrPublishConflict, err)
+	}
+	if newGen != 0 {
+		// backup へのコピーに失敗しても current は置き換わっている
+		s.Fence.Observe(newGen)
+	}
+	return newGen, err
+}
+
+// publishManifest は current のマニフェストを置き換えます。
+// gen（publish が返した世代番号）が 0 でなければマニフェストに記録し、current がまだその世代の場合のみ書き込みます。
+// 公開後に他者が current を置き換えていた場合は、その公開のマニフェストを上書きしないよう ErrPublishConflict を返します。
+func (s GCSSnapshotStrategy) publishManifest(ctx context.Context, backupKey string, m SnapshotManifest, gen int64) error {
+	if gen != 0 {
+		m.Generation = gen
+		attrs, err := s.ObjectStore.Stat(ctx, s.Bucket, FileName)
+		if err != nil {
+			return fmt.Errorf("stat current snapshot: %w", err)
+		}
+		if attrs.Generation != gen {
+			slog.ErrorContext(ctx, "SPLIT BRAIN: current was replaced by another instance after publishing; manifest is not written",
+				slog.Int64("published_generation", gen), slog.Int64("current_generation", attrs.Generation))
+			return fmt.Errorf("%w: current generation %d, published %d", ErrPublishConflict, attrs.Generation, gen)
+		}
+	}
+	manifestPath, err := WriteManifest(m)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(manifestPath)
+	return s.ObjectStore.UploadTwoPhaseWithBackup(ctx, s.Bucket, ManifestKey(FileName), ManifestKey(backupKey), manifestPath)
+}
+
+// PublishedGeneration はこのインスタンスが最後に読んだ・公開した current の世代番号を返します（不明なら 0）。
+func (s GCSSnapshotStrategy) PublishedGeneration() int64 {
+	if s.Fence == nil {
+		return 0
+	}
+	gen, _ := s.Fence.Generation()
+	return gen
+}
+
+// SyncCurrent は、起動時（または前回の公開時）に読んだ後で他のインスタンスが current を置き換えていれば、
+// その内容を dest にダウンロード・検査して apply に渡し、成功すればその世代番号を以降の公開の前提にします。
+// current が変わっていなければ何もせず false を返します（書き込みリースを後から取得した際に使う）。
+// want が 0 でなければ、前の保持者が最後に公開した世代番号として current がその世代であることも確認します。
+func (s GCSSnapshotStrategy) SyncCurrent(ctx context.Context, dest string, want int64, apply func(path string) error) (bool, error) {
+	if s.Fence == nil || s.ObjectStore == nil || s.Bucket == "" {
+		return false, nil
+	}
+	known, ok := s.Fence.Generation()
+	attrs, err := s.ObjectStore.Stat(ctx, s.Bucket, FileName)
+	if errors.Is(err, storageif.ErrNotExist) {
+		// 公開されたものが無い（手元の DB がそのまま最新）
+		s.Fence.Observe(0)
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("stat current snapshot: %w", err)
+	}
+	if want != 0 && attrs.Generation != want {
+		return false, fmt.Errorf("current generation %d does not match the handed over generation %d", attrs.Generation, want)
+	}
+	if ok && attrs.Generation == known {
+		return false, nil
+	}
+	_, gen, err := s.downloadSnapshot(ctx, FileName, dest)
+	if err != nil {
+		return false, err
+	}
+	if want != 0 && gen != want {
+		return false, fmt.Errorf("downloaded generation %d does not match the handed over generation %d", gen, want)
+	}
+	if err := verifyStartupFile(ctx, dest); err != nil {
+		return false, err
+	}
+	if err := apply(dest); err != nil {
+		return false, err
+	}
+	s.Fence.Observe(gen)
+	slog.InfoContext(ctx, "caught up with current published by another instance",
+		slog.Int64("generation", gen), slog.Int64("previous_generation", known))
+	return true, nil
+}
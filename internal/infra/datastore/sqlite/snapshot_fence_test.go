@@ -0,0 +1,243 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// otherInstance は s と同じバケットに公開する別のインスタンスの GCSSnapshotStrategy と、歌手 4 件の DB を返します。
+func otherInstance(t *testing.T, s GCSSnapshotStrategy) (GCSSnapshotStrategy, string) {
+	t.Helper()
+	other := s
+	other.Fence, other.Hold = &PublishFence{}, &PublishHold{}
+	conns, path := openTestDB(t)
+	createSinger(t, conns, "Adele")
+	return other, path
+}
+
+// currentGeneration は current の世代番号を返します。
+func currentGeneration(t *testing.T, s GCSSnapshotStrategy) int64 {
+	t.Helper()
+	attrs, err := s.ObjectStore.Stat(context.Background(), s.Bucket, FileName)
+	if err != nil {
+		t.Fatalf("Stat current: %v", err)
+	}
+	return attrs.Generation
+}
+
+func TestUpload_Fence(t *testing.T) {
+	ctx := context.Background()
+	for name, tc := range map[string]struct {
+		publishFirst   bool // s が先に一度公開しておく
+		observe        bool // 起動時と同様に current の世代番号を記録する（しなければ無条件に公開する）
+		otherPublishes bool // その後、別のインスタンスが current を置き換える
+		wantConflict   bool
+	}{
+		"unknown generation publishes unconditionally": {otherPublishes: true},
+		"empty bucket":                         {observe: true},
+		"fence matches current":                {publishFirst: true, observe: true},
+		"current created by another instance":  {observe: true, otherPublishes: true, wantConflict: true},
+		"current replaced by another instance": {publishFirst: true, observe: true, otherPublishes: true, wantConflict: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			s := newTestStrategy(t)
+			s.Fence = &PublishFence{}
+			_, path := openTestDB(t)
+			if tc.publishFirst {
+				if err := s.upload(ctx, path); err != nil {
+					t.Fatalf("first upload: %v", err)
+				}
+			}
+			if tc.observe {
+				if err := s.observeCurrent(ctx); err != nil {
+					t.Fatalf("observeCurrent: %v", err)
+				}
+			}
+			if tc.otherPublishes {
+				other, otherPath := otherInstance(t, s)
+				if err := other.upload(ctx, otherPath); err != nil {
+					t.Fatalf("upload by another instance: %v", err)
+				}
+			}
+			var before int64
+			if tc.otherPublishes {
+				before = currentGeneration(t, s)
+			}
+
+			err := s.upload(ctx, path)
+			if !tc.wantConflict {
+				if err != nil {
+					t.Fatalf("upload: %v", err)
+				}
+				// 公開した世代番号を次の公開の前提にする
+				if gen := currentGeneration(t, s); tc.observe && s.PublishedGeneration() != gen {
+					t.Fatalf("PublishedGeneration = %d, want %d", s.PublishedGeneration(), gen)
+				}
+				if n := singerRowCount(t, s); n != 3 {
+					t.Fatalf("singers in current = %d, want 3", n)
+				}
+				return
+			}
+			if !errors.Is(err, ErrPublishConflict) {
+				t.Fatalf("upload = %v, want ErrPublishConflict", err)
+			}
+			// 他者の公開を上書きせず、自分のスナップショットは conflicts/ に保管する
+			if gen := currentGeneration(t, s); gen != before {
+				t.Fatalf("current generation = %d, want %d (not replaced)", gen, before)
+			}
+			if n := singerRowCount(t, s); n != 4 {
+				t.Fatalf("singers in current = %d, want 4 (published by the other instance)", n)
+			}
+			saved := listObjects(t, s.Bucket, conflictsPrefix)
+			if len(saved) != 2 || saved[1] != ManifestKey(saved[0]) {
+				t.Fatalf("conflicts/ = %v, want the snapshot and its manifest", saved)
+			}
+			// 以降の公開も失敗し続ける
+			if err := s.upload(ctx, path); !errors.Is(err, ErrPublishConflict) {
+				t.Fatalf("second upload = %v, want ErrPublishConflict", err)
+			}
+		})
+	}
+}
+
+func TestPublishManifest_CurrentReplacedAfterPublish(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStrategy(t)
+	_, path := openTestDB(t)
+	if err := s.observeCurrent(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.upload(ctx, path); err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	gen := s.PublishedGeneration()
+	m, err := s.currentManifest(ctx)
+	if err != nil || m == nil || gen == 0 || m.Generation != gen {
+		t.Fatalf("current manifest = %+v, %v; want generation %d", m, err, gen)
+	}
+
+	// 公開とマニフェストの書き込みの間に別のインスタンスが current を置き換えた
+	other, otherPath := otherInstance(t, s)
+	if err := other.upload(ctx, otherPath); err != nil {
+		t.Fatalf("upload by another instance: %v", err)
+	}
+	if err := s.publishManifest(ctx, backupKeyAt(time.Now()), *m, gen); !errors.Is(err, ErrPublishConflict) {
+		t.Fatalf("publishManifest = %v, want ErrPublishConflict", err)
+	}
+	if got, err := s.currentManifest(ctx); err != nil || got.Generation != other.PublishedGeneration() {
+		t.Fatalf("current manifest = %+v, %v; want the other instance's generation %d", got, err, other.PublishedGeneration())
+	}
+}
+
+func TestDownloadSnapshot_ManifestOfAnotherGeneration(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStrategy(t)
+	_, path := openTestDB(t)
+	if err := s.observeCurrent(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.upload(ctx, path); err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	// マニフェストを書く前の current（世代番号の食い違い）に当たった場合は展開しない
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(filepath.Join(s.Bucket, FileName), later, later); err != nil {
+		t.Fatal(err)
+	}
+	dest := filepath.Join(t.TempDir(), FileName)
+	if _, _, err := s.tryDownloadSnapshot(ctx, FileName, dest); err == nil || !strings.Contains(err.Error(), "manifest is for generation") {
+		t.Fatalf("tryDownloadSnapshot = %v, want a generation mismatch", err)
+	}
+	if _, err := os.Stat(dest); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("dest exists after a failed download: %v", err)
+	}
+}
+
+func TestSyncCurrent(t *testing.T) {
+	ctx := context.Background()
+	for name, tc := range map[string]struct {
+		publish        bool // s が公開しておく
+		otherPublishes bool // その後、別のインスタンスが current を置き換える
+		want           func(s, other GCSSnapshotStrategy) int64
+		wantSynced     bool
+		wantErr        bool
+	}{
+		"no current":    {},
+		"unchanged":     {publish: true},
+		"replaced":      {publish: true, otherPublishes: true, wantSynced: true},
+		"first publish": {otherPublishes: true, wantSynced: true},
+		"handed over generation": {
+			publish: true, otherPublishes: true,
+			want:       func(s, other GCSSnapshotStrategy) int64 { return other.PublishedGeneration() },
+			wantSynced: true,
+		},
+		"another generation than handed over": {
+			publish: true, otherPublishes: true,
+			want:    func(s, other GCSSnapshotStrategy) int64 { return s.PublishedGeneration() },
+			wantErr: true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			s := newTestStrategy(t)
+			_, path := openTestDB(t)
+			if err := s.observeCurrent(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if tc.publish {
+				if err := s.upload(ctx, path); err != nil {
+					t.Fatalf("upload: %v", err)
+				}
+			}
+			other, otherPath := otherInstance(t, s)
+			if tc.otherPublishes {
+				if err := other.observeCurrent(ctx); err != nil {
+					t.Fatal(err)
+				}
+				if err := other.upload(ctx, otherPath); err != nil {
+					t.Fatalf("upload by another instance: %v", err)
+				}
+			}
+			var want int64
+			if tc.want != nil {
+				want = tc.want(s, other)
+			}
+			before := s.PublishedGeneration()
+
+			applied := 0
+			synced, err := s.SyncCurrent(ctx, filepath.Join(t.TempDir(), FileName), want, func(p string) error {
+				applied = countSingers(t, p)
+				return nil
+			})
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("SyncCurrent succeeded, want an error")
+				}
+				if applied != 0 || s.PublishedGeneration() != before {
+					t.Fatalf("SyncCurrent applied a snapshot on error (singers %d, generation %d)", applied, s.PublishedGeneration())
+				}
+				return
+			}
+			if err != nil || synced != tc.wantSynced {
+				t.Fatalf("SyncCurrent = %v, %v; want %v", synced, err, tc.wantSynced)
+			}
+			if !synced {
+				if applied != 0 || s.PublishedGeneration() != before {
+					t.Fatalf("SyncCurrent applied a snapshot without changes (singers %d, generation %d)", applied, s.PublishedGeneration())
+				}
+				return
+			}
+			// 他者の公開を取り込み、その世代番号を以降の公開の前提にする
+			if applied != 4 || s.PublishedGeneration() != other.PublishedGeneration() {
+				t.Fatalf("applied singers = %d, generation = %d; want 4, %d", applied, s.PublishedGeneration(), other.PublishedGeneration())
+			}
+			if err := s.upload(ctx, path); err != nil {
+				t.Fatalf("upload after catching up: %v", err)
+			}
+		})
+	}
+}
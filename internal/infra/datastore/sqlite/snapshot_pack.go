@@ -0,0 +1,342 @@
+package sqlite
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/kawabatas/mini-web-app/internal/infra/storage/envelope"
+	"github.com/kawabatas/mini-web-app/internal/util/clock"
+)
+
+// スナップショットの圧縮方式
+const (
+	CompressionZstd = "zstd"
+	CompressionGzip = "gzip"
+	CompressionNone = "none"
+)
+
+// manifestSuffix はスナップショットのオブジェクトの隣に置くマニフェストの接尾辞です。
+const manifestSuffix = ".manifest.json"
+
+// ManifestKey は object のマニフェストのキーを返します。
+func ManifestKey(object string) string { return object + manifestSuffix }
+
+// SnapshotManifest はアップロードしたスナップショットの内容を記述します。
+// マニフェストが無いオブジェクトは、圧縮されていない従来形式の SQLite ファイルとして扱います。
+type SnapshotManifest struct {
+	Format        int              `json:"format"`
+	Compression   string           `json:"compression"`
+	SHA256        string           `json:"sha256"`      // 展開後の DB ファイルの SHA-256（16 進）
+	Size          int64            `json:"size"`        // 展開後の DB ファイルのサイズ
+	StoredSize    int64            `json:"stored_size"` // アップロードしたオブジェクトのサイズ
+	SchemaVersion int              `json:"schema_version"`
+	RowCounts     map[string]int64 `json:"row_counts"`
+	AppVersion    string           `json:"app_version"`
+	// CreatedAt はスナップショットを取り始めた時刻です（GCS への公開では、これより前に配送した WAL をすべて含む）。
+	CreatedAt  time.Time           `json:"created_at"`
+	Encryption *SnapshotEncryption `json:"encryption,omitempty"` // nil なら暗号化していない
+	// Generation は公開した current の世代番号です（世代番号を前提に公開した場合のみ。current の読み込み時に照合する）。
+	Generation int64 `json:"generation,omitempty"`
+	// AuditMaxID はスナップショット時点の監査ログの最大 ID です（次の公開で行数の減少を監査ログと突き合わせる起点）。
+	AuditMaxID int64 `json:"audit_max_id,omitempty"`
+}
+
+// SnapshotEncryption はスナップショットの暗号化方式と、データ鍵を包んだ KEK の ID です。
+// 鍵のローテーション後も、この ID の KEK を残しておけば復元できます。
+type SnapshotEncryption struct {
+	Algorithm string `json:"algorithm"`
+	KEKID     string `json:"kek_id"`
+}
+
+const manifestFormat = 1
+
+// PackSnapshot はスナップショット snapPath を圧縮（kr があれば続けて暗号化）した一時ファイルと、そのマニフェストを作成します。
+// 一時ファイルは呼び出し側で削除すること。
+func PackSnapshot(ctx context.Context, snapPath, compression string, kr *envelope.Keyring) (string, SnapshotManifest, error) {
+	if compression == "" {
+		compression = CompressionZstd
+	}
+	m := SnapshotManifest{
+		Format:      manifestFormat,
+		Compression: compression,
+		AppVersion:  appVersion(),
+		CreatedAt:   clock.Now().UTC(),
+	}
+	var err error
+	if m.SchemaVersion, m.RowCounts, m.AuditMaxID, err = inspectSnapshot(ctx, snapPath); err != nil {
+		return "", SnapshotManifest{}, fmt.Errorf("inspect snapshot: %w", err)
+	}
+
+	in, err := os.Open(snapPath)
+	if err != nil {
+		return "", SnapshotManifest{}, err
+	}
+	defer in.Close()
+	out, err := os.CreateTemp("", "app-snapshot-*.pack")
+	if err != nil {
+		return "", SnapshotManifest{}, err
+	}
+	fail := func(err error) (string, SnapshotManifest, error) {
+		_ = out.Close()
+		_ = os.Remove(out.Name())
+		return "", SnapshotManifest{}, err
+	}
+	cw, err := compressWriter(out, compression)
+	if err != nil {
+		return fail(err)
+	}
+	h := sha256.New()
+	if m.Size, err = io.Copy(io.MultiWriter(cw, h), in); err != nil {
+		return fail(err)
+	}
+	if err := cw.Close(); err != nil {
+		return fail(err)
+	}
+	if err := out.Close(); err != nil {
+		return fail(err)
+	}
+	m.SHA256 = hex.EncodeToString(h.Sum(nil))
+	if kr != nil {
+		if err := encryptFile(out.Name(), kr, m.SHA256); err != nil {
+			return fail(err)
+		}
+		m.Encryption = &SnapshotEncryption{Algorithm: envelope.Algorithm, KEKID: kr.ActiveID()}
+	}
+	fi, err := os.Stat(out.Name())
+	if err != nil {
+		return fail(err)
+	}
+	m.StoredSize = fi.Size()
+	return out.Name(), m, nil
+}
+
+// encryptFile は path の内容を暗号化して置き換えます。
+// 追加認証データにチェックサムを使い、暗号文が別のマニフェストと組み合わされていないことも検証できるようにします。
+func encryptFile(path string, kr *envelope.Keyring, sum string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	enc, err := kr.Encrypt(b, []byte(sum))
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, enc, 0600)
+}
+
+// UnpackSnapshot は packedPath を（暗号化されていれば kr で復号して）展開し、
+// マニフェストのサイズ・チェックサムと一致した場合のみ dest に配置します。
+func UnpackSnapshot(packedPath string, m SnapshotManifest, dest string, kr *envelope.Keyring) error {
+	if m.Format != manifestFormat {
+		return fmt.Errorf("unsupported snapshot manifest format: %d", m.Format)
+	}
+	var in io.Reader
+	if m.Encryption != nil {
+		if kr == nil {
+			return fmt.Errorf("snapshot is encrypted with key %q but no keys are configured", m.Encryption.KEKID)
+		}
+		b, err := os.ReadFile(packedPath)
+		if err != nil {
+			return err
+		}
+		pt, err := kr.Decrypt(b, []byte(m.SHA256))
+		if err != nil {
+			return err
+		}
+		in = bytes.NewReader(pt)
+	} else {
+		f, err := os.Open(packedPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	dr, err := decompressReader(in, m.Compression)
+	if err != nil {
+		return err
+	}
+	defer dr.Close()
+
+	tmp := dest + ".unpack"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(out, h), dr)
+	if cErr := out.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		return fmt.Errorf("decompress snapshot: %w", err)
+	}
+	if n != m.Size {
+		return fmt.Errorf("snapshot size mismatch: got %d, want %d", n, m.Size)
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != m.SHA256 {
+		return fmt.Errorf("snapshot checksum mismatch: got %s, want %s", sum, m.SHA256)
+	}
+	return os.Rename(tmp, dest)
+}
+
+// WriteManifest は m を JSON で一時ファイルに書き出し、そのパスを返します（呼び出し側で削除すること）。
+func WriteManifest(m SnapshotManifest) (string, error) {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	f, err := os.CreateTemp("", "app-snapshot-*.manifest.json")
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.Write(b); err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// ReadManifest は path の JSON マニフェストを読み取ります。
+func ReadManifest(path string) (SnapshotManifest, error) {
+	var m SnapshotManifest
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return m, err
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return m, fmt.Errorf("parse snapshot manifest: %w", err)
+	}
+	return m, nil
+}
+
+func compressWriter(w io.Writer, compression string) (io.WriteCloser, error) {
+	switch compression {
+	case CompressionZstd:
+		return zstd.NewWriter(w)
+	case CompressionGzip:
+		return gzip.NewWriter(w), nil
+	case CompressionNone:
+		return nopWriteCloser{w}, nil
+	default:
+		return nil, fmt.Errorf("unsupported snapshot compression: %q", compression)
+	}
+}
+
+func decompressReader(r io.Reader, compression string) (io.ReadCloser, error) {
+	switch compression {
+	case CompressionZstd:
+		d, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	case CompressionGzip:
+		return gzip.NewReader(r)
+	case CompressionNone:
+		return io.NopCloser(r), nil
+	default:
+		return nil, fmt.Errorf("unsupported snapshot compression: %q", compression)
+	}
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+// inspectSnapshot はスナップショットのスキーマバージョンとテーブルごとの行数、監査ログの最大 ID を返します。
+// FTS5 などの仮想テーブルとその内部テーブルは対象外です。
+func inspectSnapshot(ctx context.Context, path string) (int, map[string]int64, int64, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?mode=ro")
+	if err != nil {
+		return 0, nil, 0, err
+	}
+	defer db.Close()
+
+	var version int
+	if err := db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version); err != nil {
+		return 0, nil, 0, err
+	}
+	rows, err := db.QueryContext(ctx, `SELECT name, sql FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name`)
+	if err != nil {
+		return 0, nil, 0, err
+	}
+	var tables, virtual []string
+	for rows.Next() {
+		var name string
+		var ddl sql.NullString
+		if err := rows.Scan(&name, &ddl); err != nil {
+			rows.Close()
+			return 0, nil, 0, err
+		}
+		if strings.HasPrefix(strings.ToUpper(ddl.String), "CREATE VIRTUAL") {
+			virtual = append(virtual, name)
+			continue
+		}
+		tables = append(tables, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, nil, 0, err
+	}
+
+	counts := map[string]int64{}
+next:
+	for _, t := range tables {
+		for _, v := range virtual {
+			if strings.HasPrefix(t, v+"_") {
+				continue next
+			}
+		}
+		var n int64
+		// t は sqlite_master から得た名前のみ（識別子として引用符で囲む）
+		if err := db.QueryRowContext(ctx, `SELECT COUNT(1) FROM "`+strings.ReplaceAll(t, `"`, `""`)+`"`).Scan(&n); err != nil {
+			return 0, nil, 0, err
+		}
+		counts[t] = n
+	}
+	var auditMaxID int64
+	if _, ok := counts["audit_log"]; ok {
+		if err := db.QueryRowContext(ctx, `SELECT COALESCE(MAX(id), 0) FROM audit_log`).Scan(&auditMaxID); err != nil {
+			return 0, nil, 0, err
+		}
+	}
+	return version, counts, auditMaxID, nil
+}
+
+// appVersion はスナップショットを作成したアプリのバージョンです。
+// Cloud Run のリビジョン名（K_REVISION）、無ければビルド情報の VCS リビジョンを使います。
+func appVersion() string {
+	if rev := os.Getenv("K_REVISION"); rev != "" {
+		return rev
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	for _, s := range info.Settings {
+		if s.Key == "vcs.revision" {
+			return s.Value
+		}
+	}
+	return info.Main.Version
+}
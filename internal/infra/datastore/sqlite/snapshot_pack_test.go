@@ -0,0 +1,211 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kawabatas/mini-web-app/internal/infra/storage/envelope"
+)
+
+// testSnapshot は初期データ入りの DB のスナップショットを作成し、そのパスを返します。
+func testSnapshot(t *testing.T) string {
+	t.Helper()
+	_, path := openTestDB(t)
+	snap := filepath.Join(t.TempDir(), "snap.sqlite")
+	if err := SnapshotTo(context.Background(), path, snap); err != nil {
+		t.Fatalf("SnapshotTo: %v", err)
+	}
+	return snap
+}
+
+// packTestSnapshot は snap を圧縮し、後で削除するよう登録します。
+func packTestSnapshot(t *testing.T, snap, compression string) (string, SnapshotManifest) {
+	t.Helper()
+	packed, m, err := PackSnapshot(context.Background(), snap, compression, nil)
+	if err != nil {
+		t.Fatalf("PackSnapshot(%q): %v", compression, err)
+	}
+	t.Cleanup(func() { _ = os.Remove(packed) })
+	return packed, m
+}
+
+func TestPackSnapshot_RoundTrip(t *testing.T) {
+	snap := testSnapshot(t)
+	want, err := os.ReadFile(snap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, compression := range []string{"", CompressionZstd, CompressionGzip, CompressionNone} {
+		t.Run("compression="+compression, func(t *testing.T) {
+			packed, m := packTestSnapshot(t, snap, compression)
+			if m.Size != int64(len(want)) || m.SchemaVersion == 0 || m.RowCounts["singers"] != 3 || m.Encryption != nil {
+				t.Fatalf("manifest = %+v", m)
+			}
+			if compression == "" && m.Compression != CompressionZstd {
+				t.Fatalf("default compression = %q, want zstd", m.Compression)
+			}
+
+			// マニフェストはファイル経由でも同じ内容で読める
+			mp, err := WriteManifest(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(mp)
+			got, err := ReadManifest(mp)
+			if err != nil || got.SHA256 != m.SHA256 || got.Size != m.Size {
+				t.Fatalf("ReadManifest = %+v, %v", got, err)
+			}
+
+			dest := filepath.Join(t.TempDir(), FileName)
+			if err := UnpackSnapshot(packed, got, dest, nil); err != nil {
+				t.Fatalf("UnpackSnapshot: %v", err)
+			}
+			if b, _ := os.ReadFile(dest); string(b) != string(want) {
+				t.Fatal("unpacked snapshot differs from the original")
+			}
+		})
+	}
+}
+
+func TestUnpackSnapshot_RejectsMismatch(t *testing.T) {
+	snap := testSnapshot(t)
+	for name, tc := range map[string]struct {
+		compression string
+		tamper      func(t *testing.T, packed string, m *SnapshotManifest)
+		wantErr     string
+	}{
+		"checksum": {
+			compression: CompressionZstd,
+			tamper: func(t *testing.T, packed string, m *SnapshotManifest) {
+				m.SHA256 = strings.Repeat("0", 64)
+			},
+			wantErr: "checksum mismatch",
+		},
+		"size": {
+			compression: CompressionGzip,
+			tamper:      func(t *testing.T, packed string, m *SnapshotManifest) { m.Size++ },
+			wantErr:     "size mismatch",
+		},
+		"corrupted object": {
+			compression: CompressionNone,
+			tamper: func(t *testing.T, packed string, m *SnapshotManifest) {
+				b, err := os.ReadFile(packed)
+				if err != nil {
+					t.Fatal(err)
+				}
+				b[len(b)/2] ^= 0xff
+				if err := os.WriteFile(packed, b, 0600); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr: "checksum mismatch",
+		},
+		"truncated object": {
+			compression: CompressionZstd,
+			tamper: func(t *testing.T, packed string, m *SnapshotManifest) {
+				fi, err := os.Stat(packed)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Truncate(packed, fi.Size()/2); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr: "decompress snapshot",
+		},
+		"compression of another object": {
+			compression: CompressionGzip,
+			tamper:      func(t *testing.T, packed string, m *SnapshotManifest) { m.Compression = CompressionZstd },
+			wantErr:     "", // 展開できない（エラーの内容は展開の実装による）
+		},
+		"unknown format": {
+			compression: CompressionZstd,
+			tamper:      func(t *testing.T, packed string, m *SnapshotManifest) { m.Format = 99 },
+			wantErr:     "unsupported snapshot manifest format",
+		},
+		"unknown compression": {
+			compression: CompressionZstd,
+			tamper:      func(t *testing.T, packed string, m *SnapshotManifest) { m.Compression = "lz4" },
+			wantErr:     "unsupported snapshot compression",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			packed, m := packTestSnapshot(t, snap, tc.compression)
+			tc.tamper(t, packed, &m)
+			dest := filepath.Join(t.TempDir(), FileName)
+			err := UnpackSnapshot(packed, m, dest, nil)
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("UnpackSnapshot = %v, want an error containing %q", err, tc.wantErr)
+			}
+			// 検証に失敗したスナップショットは配置しない
+			if _, err := os.Stat(dest); !errors.Is(err, os.ErrNotExist) {
+				t.Fatalf("dest exists after a failed unpack: %v", err)
+			}
+		})
+	}
+}
+
+func TestPackSnapshot_UnknownCompression(t *testing.T) {
+	if _, _, err := PackSnapshot(context.Background(), testSnapshot(t), "lz4", nil); err == nil {
+		t.Fatal("PackSnapshot succeeded with an unknown compression")
+	}
+}
+
+func TestUnpackSnapshot_Encrypted(t *testing.T) {
+	ctx := context.Background()
+	snap := testSnapshot(t)
+	kr := testKeyring(t, "k1")
+	packed, m, err := PackSnapshot(ctx, snap, CompressionZstd, kr)
+	if err != nil {
+		t.Fatalf("PackSnapshot: %v", err)
+	}
+	t.Cleanup(func() { _ = os.Remove(packed) })
+	if m.Encryption == nil || m.Encryption.KEKID != "k1" {
+		t.Fatalf("manifest encryption = %+v, want kek k1", m.Encryption)
+	}
+	rotated, err := envelope.NewKeyring(map[string][]byte{"k1": testKey("k1"), "k2": testKey("k2")}, []string{"k2", "k1"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, tc := range map[string]struct {
+		keyring *envelope.Keyring
+		tamper  func(m *SnapshotManifest)
+		wantErr string // 空なら成功
+	}{
+		"same key":        {keyring: kr},
+		"rotated keyring": {keyring: rotated},
+		"no keys":         {wantErr: "no keys are configured"},
+		"unknown key":     {keyring: testKeyring(t, "k2"), wantErr: "unknown key"},
+		"manifest of another snapshot": {
+			keyring: kr,
+			// 暗号文は別のマニフェスト（チェックサム）と組み合わせると復号できない
+			tamper:  func(m *SnapshotManifest) { m.SHA256 = strings.Repeat("0", 64) },
+			wantErr: "decrypt",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			m := m
+			if tc.tamper != nil {
+				tc.tamper(&m)
+			}
+			dest := filepath.Join(t.TempDir(), FileName)
+			err := UnpackSnapshot(packed, m, dest, tc.keyring)
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("UnpackSnapshot: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("UnpackSnapshot = %v, want an error containing %q", err, tc.wantErr)
+			}
+			if _, err := os.Stat(dest); !errors.Is(err, os.ErrNotExist) {
+				t.Fatalf("dest exists after a failed unpack: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// backupsPrefix は世代保管したスナップショットのプレフィックスです（backups/<yyyy-mm-dd>/<HHMMSS>-app.sqlite）。
+const backupsPrefix = "backups/"
+
+// backupKeyAt は t（UTC）に作成したスナップショットの保管キーです。
+func backupKeyAt(t time.Time) string { return snapshotKeyAt(backupsPrefix, t) }
+
+// snapshotKeyAt は t（UTC）に作成したスナップショットを prefix 以下に置くキー（<prefix><yyyy-mm-dd>/<HHMMSS>-app.sqlite）です。
+func snapshotKeyAt(prefix string, t time.Time) string {
+	t = t.UTC()
+	return prefix + t.Format("2006-01-02") + "/" + t.Format("150405") + "-" + FileName
+}
+
+// parseBackupKey は保管キーから作成時刻を読み取ります（マニフェストや一時オブジェクトは対象外）。
+func parseBackupKey(key string) (time.Time, bool) { return parseSnapshotKey(backupsPrefix, key) }
+
+// parseSnapshotKey は prefix 以下に置いたスナップショットのキー（snapshotKeyAt）から作成時刻を読み取ります。
+func parseSnapshotKey(prefix, key string) (time.Time, bool) {
+	rest, ok := strings.CutPrefix(key, prefix)
+	if !ok {
+		return time.Time{}, false
+	}
+	day, file, ok := strings.Cut(rest, "/")
+	if !ok {
+		return time.Time{}, false
+	}
+	hms, ok := strings.CutSuffix(file, "-"+FileName)
+	if !ok {
+		return time.Time{}, false
+	}
+	t, err := time.Parse("2006-01-02 150405", day+" "+hms)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// SnapshotInfo は backups/ に保管されたスナップショットです。
+type SnapshotInfo struct {
+	Key  string    `json:"key"`
+	At   time.Time `json:"at"`   // キーから読み取った作成時刻（UTC・秒単位）
+	Size int64     `json:"size"` // 保存サイズ（圧縮・暗号化後）
+	// Manifest は検証のためにダウンロードした場合のみ設定されます（従来形式のオブジェクトでは nil）。
+	Manifest *SnapshotManifest `json:"manifest,omitempty"`
+}
+
+// ListSnapshots は backups/ のスナップショットを古い順に返します。
+func (s GCSSnapshotStrategy) ListSnapshots(ctx context.Context) ([]SnapshotInfo, error) {
+	if s.ObjectStore == nil || s.Bucket == "" {
+		return nil, nil
+	}
+	objs, err := s.ObjectStore.List(ctx, s.Bucket, backupsPrefix)
+	if err != nil {
+		return nil, err
+	}
+	var out []SnapshotInfo
+	for _, o := range objs {
+		if at, ok := parseBackupKey(o.Name); ok {
+			out = append(out, SnapshotInfo{Key: o.Name, At: at, Size: o.Size})
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].At.Before(out[j].At) })
+	return out, nil
+}
+
+// FetchSnapshot は保管キー key（backups/ または quarantine/）のスナップショットをダウンロード・展開・検証して dest に配置します。
+func (s GCSSnapshotStrategy) FetchSnapshot(ctx context.Context, key, dest string) (*SnapshotManifest, error) {
+	if s.ObjectStore == nil || s.Bucket == "" {
+		return nil, errors.New("object store is not configured")
+	}
+	_, backup := parseBackupKey(key)
+	_, quarantined := parseSnapshotKey(quarantinePrefix, key)
+	if !backup && !quarantined {
+		return nil, fmt.Errorf("not a backup snapshot key: %q", key)
+	}
+	m, _, err := s.downloadSnapshot(ctx, key, dest)
+	return m, err
+}
+
+// PrepareSnapshot は復元に使うスナップショットファイルの整合性を検査し、スキーマを最新まで進めます。
+// スキーマがバイナリより新しい場合は ErrSchemaTooNew を返します。
+func PrepareSnapshot(ctx context.Context, path string) error {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	var res string
+	if err := db.QueryRowContext(ctx, `PRAGMA quick_check`).Scan(&res); err != nil {
+		return err
+	}
+	if res != "ok" {
+		return fmt.Errorf("snapshot integrity check failed: %s", res)
+	}
+	return Migrate(ctx, db)
+}
+
+// RestoreTables は書き込みプール w 上で、src の tables の内容で現在の DB の同名テーブルを置き換えます。
+// 置き換えと fn は 1 トランザクションで実行されます（fn がエラーを返せば置き換えも取り消されます）。
+// 通常の書き込みとして行うため、索引（FTS のトリガ）や WAL の配送もそのまま追従します。
+func RestoreTables(ctx context.Context, w *sql.DB, src string, tables []string, fn func(tx *sql.Tx) error) error {
+	conn, err := w.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	// ATTACH はトランザクション内では実行できないため、接続を保持して先に行う
+	if _, err := conn.ExecContext(ctx, `ATTACH DATABASE ? AS restore_src`, src); err != nil {
+		return err
+	}
+	defer func() { _, _ = conn.ExecContext(context.WithoutCancel(ctx), `DETACH DATABASE restore_src`) }()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	for _, t := range tables {
+		cols, err := tableColumns(ctx, tx, t)
+		if err != nil {
+			return err
+		}
+		// t は呼び出し側の固定のテーブル名のみ
+		if _, err := tx.ExecContext(ctx, `DELETE FROM main.`+t); err != nil {
+			return fmt.Errorf("restore %s: %w", t, err)
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO main.`+t+`(`+cols+`) SELECT `+cols+` FROM restore_src.`+t); err != nil {
+			return fmt.Errorf("restore %s: %w", t, err)
+		}
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// tableColumns は main.table の列名をカンマ区切りで返します（列の並びの違いに依存しないため）。
+func tableColumns(ctx context.Context, tx *sql.Tx, table string) (string, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT name FROM pragma_table_info(?, 'main')`, table)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	var cols []string
+	for rows.Next() {
+		var c string
+		if err := rows.Scan(&c); err != nil {
+			return "", err
+		}
+		cols = append(cols, `"`+c+`"`)
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	if len(cols) == 0 {
+		return "", fmt.Errorf("table not found: %s", table)
+	}
+	return strings.Join(cols, ", "), nil
+}
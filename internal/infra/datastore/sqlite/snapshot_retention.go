@@ -0,0 +1,170 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	storageif "github.com/kawabatas/mini-web-app/internal/infra/storage"
+)
+
+// RetentionPolicy は backups/ の世代保管ポリシー（grandfather-father-son）です。
+// 各期間内では、All はすべて、Hourly・Daily・Monthly はそれぞれ 1 時間・1 日・1 か月（UTC）ごとに最も新しいものを残します。
+// 0 の期間はその規則を使いません。最も新しいスナップショットは常に残します。
+type RetentionPolicy struct {
+	All     time.Duration
+	Hourly  time.Duration
+	Daily   time.Duration
+	Monthly time.Duration
+}
+
+// DefaultRetentionPolicy は 24 時間はすべて、7 日間は 1 時間ごと、30 日間は 1 日ごと、1 年間は 1 か月ごとに残すポリシーです。
+var DefaultRetentionPolicy = RetentionPolicy{
+	All:     24 * time.Hour,
+	Hourly:  7 * 24 * time.Hour,
+	Daily:   30 * 24 * time.Hour,
+	Monthly: 365 * 24 * time.Hour,
+}
+
+// ParseRetentionPolicy は "all=24h,hourly=7d,daily=30d,monthly=365d" 形式のポリシーを読み取ります。
+// 省略した規則は DefaultRetentionPolicy の値、空文字列は DefaultRetentionPolicy です。期間には h・m・s のほか d（日）が使えます。
+func ParseRetentionPolicy(spec string) (RetentionPolicy, error) {
+	p := DefaultRetentionPolicy
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, val, ok := strings.Cut(entry, "=")
+		if !ok {
+			return p, fmt.Errorf("invalid retention entry %q (want name=duration)", entry)
+		}
+		d, err := parseRetentionDuration(strings.TrimSpace(val))
+		if err != nil {
+			return p, fmt.Errorf("retention %s: %w", name, err)
+		}
+		switch strings.TrimSpace(name) {
+		case "all":
+			p.All = d
+		case "hourly":
+			p.Hourly = d
+		case "daily":
+			p.Daily = d
+		case "monthly":
+			p.Monthly = d
+		default:
+			return p, fmt.Errorf("unknown retention rule %q", name)
+		}
+	}
+	return p, nil
+}
+
+func parseRetentionDuration(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	return d, nil
+}
+
+// RetentionDecision はスナップショットごとの保持・削除の判定です。
+type RetentionDecision struct {
+	Snapshot SnapshotInfo `json:"snapshot"`
+	Keep     bool         `json:"keep"`
+	// Reason は残す場合は該当した規則（latest / all / hourly / daily / monthly）、削除する場合は "expired" です。
+	Reason string `json:"reason"`
+}
+
+// PlanRetention は now 時点で snaps（古い順）のそれぞれを残すか判定します（結果も古い順）。
+func PlanRetention(snaps []SnapshotInfo, p RetentionPolicy, now time.Time) []RetentionDecision {
+	out := make([]RetentionDecision, len(snaps))
+	for i, s := range snaps {
+		out[i] = RetentionDecision{Snapshot: s, Reason: "expired"}
+	}
+	keep := func(i int, reason string) {
+		if !out[i].Keep {
+			out[i].Keep = true
+			out[i].Reason = reason
+		}
+	}
+	if len(snaps) > 0 {
+		keep(len(snaps)-1, "latest")
+	}
+	rules := []struct {
+		name   string
+		window time.Duration
+		bucket func(time.Time) string // "" はすべて残す
+	}{
+		{"all", p.All, func(time.Time) string { return "" }},
+		{"hourly", p.Hourly, func(t time.Time) string { return t.Format("2006-01-02T15") }},
+		{"daily", p.Daily, func(t time.Time) string { return t.Format("2006-01-02") }},
+		{"monthly", p.Monthly, func(t time.Time) string { return t.Format("2006-01") }},
+	}
+	for _, r := range rules {
+		if r.window <= 0 {
+			continue
+		}
+		seen := map[string]bool{}
+		// 新しい順に見て、期間内の各区間で最初（最も新しい）のものを残す
+		for i := len(snaps) - 1; i >= 0; i-- {
+			at := snaps[i].At.UTC()
+			if now.Sub(at) > r.window {
+				break
+			}
+			b := r.bucket(at)
+			if b != "" && seen[b] {
+				continue
+			}
+			seen[b] = true
+			keep(i, r.name)
+		}
+	}
+	return out
+}
+
+// PruneSnapshots は p に従って backups/ の不要なスナップショット（とマニフェスト）を削除し、判定結果を返します。
+// dryRun の場合は判定とログ出力のみ行います。
+func (s GCSSnapshotStrategy) PruneSnapshots(ctx context.Context, p RetentionPolicy, now time.Time, dryRun bool) ([]RetentionDecision, error) {
+	snaps, err := s.ListSnapshots(ctx)
+	if err != nil {
+		return nil, err
+	}
+	decisions := PlanRetention(snaps, p, now)
+	var errs []error
+	for _, d := range decisions {
+		attrs := []any{
+			slog.String("object", d.Snapshot.Key),
+			slog.Time("at", d.Snapshot.At),
+			slog.String("reason", d.Reason),
+			slog.Bool("dry_run", dryRun),
+		}
+		if d.Keep {
+			slog.DebugContext(ctx, "backup retained", attrs...)
+			continue
+		}
+		slog.InfoContext(ctx, "backup pruned", attrs...)
+		if dryRun {
+			continue
+		}
+		// マニフェストを先に消すと従来形式（非圧縮）と誤認されうるため、データを先に消す
+		if err := s.ObjectStore.Delete(ctx, s.Bucket, d.Snapshot.Key); err != nil && !errors.Is(err, storageif.ErrNotExist) {
+			errs = append(errs, fmt.Errorf("delete %s: %w", d.Snapshot.Key, err))
+			continue
+		}
+		if err := s.ObjectStore.Delete(ctx, s.Bucket, ManifestKey(d.Snapshot.Key)); err != nil && !errors.Is(err, storageif.ErrNotExist) {
+			errs = append(errs, fmt.Errorf("delete %s: %w", ManifestKey(d.Snapshot.Key), err))
+		}
+	}
+	return decisions, errors.Join(errs...)
+}
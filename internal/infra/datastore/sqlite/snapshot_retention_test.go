@@ -0,0 +1,161 @@
+package sqlite
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseRetentionPolicy(t *testing.T) {
+	for name, tc := range map[string]struct {
+		spec    string
+		want    RetentionPolicy
+		wantErr bool
+	}{
+		"empty is the default": {spec: "", want: DefaultRetentionPolicy},
+		"omitted rules keep the default": {
+			spec: "hourly=48h, monthly=0",
+			want: RetentionPolicy{All: 24 * time.Hour, Hourly: 48 * time.Hour, Daily: 30 * 24 * time.Hour},
+		},
+		"days": {
+			spec: "all=1d,hourly=2d,daily=3d,monthly=4d",
+			want: RetentionPolicy{All: 24 * time.Hour, Hourly: 48 * time.Hour, Daily: 72 * time.Hour, Monthly: 96 * time.Hour},
+		},
+		"missing value":     {spec: "all", wantErr: true},
+		"unknown rule":      {spec: "weekly=7d", wantErr: true},
+		"negative duration": {spec: "all=-1h", wantErr: true},
+		"negative days":     {spec: "daily=-1d", wantErr: true},
+		"invalid duration":  {spec: "daily=one", wantErr: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			got, err := ParseRetentionPolicy(tc.spec)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("ParseRetentionPolicy(%q) = %+v, want an error", tc.spec, got)
+				}
+				return
+			}
+			if err != nil || got != tc.want {
+				t.Fatalf("ParseRetentionPolicy(%q) = %+v, %v; want %+v", tc.spec, got, err, tc.want)
+			}
+		})
+	}
+}
+
+func TestPlanRetention(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	ago := func(d time.Duration) time.Time { return now.Add(-d) }
+	const day = 24 * time.Hour
+	for name, tc := range map[string]struct {
+		at     []time.Time // 古い順
+		policy RetentionPolicy
+		want   []string // 各スナップショットの Reason（expired は削除）
+	}{
+		"no snapshots": {policy: DefaultRetentionPolicy},
+		"latest is kept beyond every window": {
+			at:     []time.Time{ago(1000 * day)},
+			policy: DefaultRetentionPolicy,
+			want:   []string{"latest"},
+		},
+		"zero windows keep only the latest": {
+			at:   []time.Time{ago(2 * time.Hour), ago(time.Hour)},
+			want: []string{"expired", "latest"},
+		},
+		"all keeps every snapshot in its window": {
+			at:     []time.Time{ago(25 * time.Hour), ago(3 * time.Hour), ago(2 * time.Hour), ago(time.Hour)},
+			policy: RetentionPolicy{All: 24 * time.Hour},
+			want:   []string{"expired", "all", "all", "latest"},
+		},
+		"window boundary is inclusive": {
+			at:     []time.Time{ago(24*time.Hour + time.Second), ago(24 * time.Hour), ago(time.Hour)},
+			policy: RetentionPolicy{All: 24 * time.Hour},
+			want:   []string{"expired", "all", "latest"},
+		},
+		"hourly keeps the newest in each hour": {
+			at: []time.Time{
+				ago(3*time.Hour + 40*time.Minute), ago(3*time.Hour + 10*time.Minute), // 08 時台
+				ago(2*time.Hour + 50*time.Minute), ago(2*time.Hour + 20*time.Minute), // 09 時台
+				ago(10 * time.Minute), // 11 時台
+			},
+			policy: RetentionPolicy{Hourly: 7 * day},
+			want:   []string{"expired", "hourly", "expired", "hourly", "latest"},
+		},
+		"daily and monthly thin out older snapshots": {
+			at: []time.Time{
+				time.Date(2026, 8, 3, 0, 0, 0, 0, time.UTC), time.Date(2026, 8, 20, 0, 0, 0, 0, time.UTC), // 8 月
+				time.Date(2026, 9, 30, 1, 0, 0, 0, time.UTC), time.Date(2026, 9, 30, 23, 0, 0, 0, time.UTC), // 9/30
+				time.Date(2026, 10, 15, 6, 0, 0, 0, time.UTC), time.Date(2026, 10, 15, 18, 0, 0, 0, time.UTC), // 10/15
+				ago(time.Hour),
+			},
+			policy: RetentionPolicy{Daily: 30 * day, Monthly: 365 * day},
+			want:   []string{"expired", "monthly", "expired", "daily", "expired", "daily", "latest"},
+		},
+		"earlier rules take precedence in the reason": {
+			at:     []time.Time{ago(2 * time.Hour), ago(time.Hour)},
+			policy: DefaultRetentionPolicy,
+			want:   []string{"all", "latest"},
+		},
+		"buckets are in UTC": {
+			// JST では同じ日だが、UTC では 10/15 と 10/16 に分かれる
+			at: []time.Time{
+				time.Date(2026, 10, 16, 8, 0, 0, 0, time.FixedZone("JST", 9*3600)),
+				time.Date(2026, 10, 16, 10, 0, 0, 0, time.FixedZone("JST", 9*3600)),
+				ago(time.Hour),
+			},
+			policy: RetentionPolicy{Daily: 30 * day},
+			want:   []string{"daily", "expired", "latest"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			snaps := make([]SnapshotInfo, len(tc.at))
+			for i, at := range tc.at {
+				snaps[i] = SnapshotInfo{Key: backupKeyAt(at), At: at}
+			}
+			decisions := PlanRetention(snaps, tc.policy, now)
+			var got []string
+			for i, d := range decisions {
+				if d.Keep != (d.Reason != "expired") || d.Snapshot != snaps[i] {
+					t.Fatalf("decision %d = %+v", i, d)
+				}
+				got = append(got, d.Reason)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("reasons = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestPruneSnapshots(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStrategy(t)
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	var keys []string
+	for _, at := range []time.Time{now.Add(-48 * time.Hour), now.Add(-30 * time.Hour), now.Add(-time.Hour)} {
+		key := backupKeyAt(at)
+		keys = append(keys, key)
+		putObject(t, s.Bucket, key, []byte("snapshot"), at)
+		putObject(t, s.Bucket, ManifestKey(key), []byte("{}"), at)
+	}
+	policy := RetentionPolicy{All: 24 * time.Hour, Daily: 7 * 24 * time.Hour}
+
+	// dry-run は判定のみ
+	decisions, err := s.PruneSnapshots(ctx, policy, now, true)
+	if err != nil || len(decisions) != 3 {
+		t.Fatalf("PruneSnapshots(dry-run) = %+v, %v", decisions, err)
+	}
+	if got := listObjects(t, s.Bucket, backupsPrefix); len(got) != 6 {
+		t.Fatalf("objects after dry-run = %v, want all 6", got)
+	}
+
+	// daily を外すと 24 時間より古い 2 件はデータとマニフェストの両方が消える
+	policy.Daily = 0
+	if _, err := s.PruneSnapshots(ctx, policy, now, false); err != nil {
+		t.Fatalf("PruneSnapshots: %v", err)
+	}
+	want := []string{keys[2], ManifestKey(keys[2])}
+	if got := listObjects(t, s.Bucket, backupsPrefix); !reflect.DeepEqual(got, want) {
+		t.Fatalf("objects after pruning = %v, want %v", got, want)
+	}
+}
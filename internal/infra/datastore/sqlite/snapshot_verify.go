@@ -0,0 +1,342 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	storageif "github.com/kawabatas/mini-web-app/internal/infra/storage"
+)
+
+// quarantinePrefix は検査に失敗したスナップショットを保管するプレフィックスです（current には昇格しない）。
+const quarantinePrefix = "quarantine/"
+
+// ErrSnapshotRejected はスナップショットが公開前の検査に失敗し、current に昇格しなかったことを表します。
+var ErrSnapshotRejected = errors.New("snapshot rejected by verification")
+
+// VerifyPolicy は公開前にスナップショットへ行う検査の設定です。
+// integrity_check と foreign_key_check は常に行います。
+type VerifyPolicy struct {
+	// MaxRowDropPercent は current と比べてテーブルの行数が減ってよい割合（%）です。0 なら比較しません。
+	MaxRowDropPercent int
+	// Queries は行を返さなければ合格とする SQL です（例: 名前が空の歌手を探す SELECT）。
+	Queries []string
+}
+
+// rowDropExempt は定期的に削除されるため行数の比較から除くテーブルです。
+var rowDropExempt = map[string]bool{"outbox": true}
+
+// 行数の減少を説明する監査ログの操作（usecase が変更と同じトランザクションで記録する）
+const (
+	auditActionPurge           = "purge"            // after_json の rows 件を物理削除した
+	auditActionRestoreSnapshot = "restore_snapshot" // 業務データをスナップショットの内容で置き換えた
+)
+
+// purgeAuditTables は物理削除を記録する監査ログの entity と、その行を持つテーブルです。
+var purgeAuditTables = map[string]string{"singer": "singers"}
+
+// ParseSanityQueries は ";" 区切りの SQL を読み取ります。
+func ParseSanityQueries(spec string) []string {
+	var out []string
+	for _, q := range strings.Split(spec, ";") {
+		if q = strings.TrimSpace(q); q != "" {
+			out = append(out, q)
+		}
+	}
+	return out
+}
+
+type skipRowDropKey struct{}
+
+// WithoutRowDropCheck は、意図して行数が減るスナップショット（過去の時点への復元など）の公開で行数の比較を省きます。
+// 公開の停止（PublishHold）も無視し、公開できれば解除します（明示的な受け入れ）。
+func WithoutRowDropCheck(ctx context.Context) context.Context {
+	return context.WithValue(ctx, skipRowDropKey{}, true)
+}
+
+// VerifySnapshotFile はスナップショット path の整合性と Queries を検査し、不合格の理由を返します（合格なら空）。
+func VerifySnapshotFile(ctx context.Context, path string, p VerifyPolicy) ([]string, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var problems []string
+	rows, err := db.QueryContext(ctx, `PRAGMA integrity_check`)
+	if err != nil {
+		// ファイルとして開けない（壊れている）場合もここに来る
+		return []string{fmt.Sprintf("integrity_check: %v", err)}, nil
+	}
+	for rows.Next() {
+		var res string
+		if err := rows.Scan(&res); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if res != "ok" {
+			problems = append(problems, "integrity_check: "+res)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(problems) > 0 {
+		// 壊れた DB に対する以降の検査は意味が無い
+		return problems, nil
+	}
+
+	n, err := countRows(ctx, db, `PRAGMA foreign_key_check`)
+	if err != nil {
+		return nil, err
+	}
+	if n > 0 {
+		problems = append(problems, fmt.Sprintf("foreign_key_check: %d violation(s)", n))
+	}
+	for _, q := range p.Queries {
+		n, err := countRows(ctx, db, q)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("sanity query %q: %v", q, err))
+			continue
+		}
+		if n > 0 {
+			problems = append(problems, fmt.Sprintf("sanity query %q: returned %d row(s)", q, n))
+		}
+	}
+	return problems, nil
+}
+
+func countRows(ctx context.Context, db *sql.DB, query string) (int, error) {
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	n := 0
+	for rows.Next() {
+		n++
+	}
+	return n, rows.Err()
+}
+
+// CompareRowCounts は base（current のマニフェスト）と比べて maxDropPercent を超えて行数が減ったテーブルを返します。
+// explained はテーブルごとに監査ログで説明できる減少（ExplainedRowDrops）で、base から差し引いた行数と比べます。
+func CompareRowCounts(base, next, explained map[string]int64, maxDropPercent int) []string {
+	if maxDropPercent <= 0 {
+		return nil
+	}
+	var problems []string
+	for t, before := range base {
+		if rowDropExempt[t] {
+			continue
+		}
+		expected := max(before-explained[t], 0)
+		if expected == 0 {
+			continue
+		}
+		after := next[t]
+		if (expected-after)*100 > expected*int64(maxDropPercent) {
+			msg := fmt.Sprintf("row count of %s dropped from %d to %d (max %d%%)", t, before, after, maxDropPercent)
+			if explained[t] > 0 {
+				msg += fmt.Sprintf("; %d row(s) explained by the audit log", explained[t])
+			}
+			problems = append(problems, msg)
+		}
+	}
+	return problems
+}
+
+// ExplainedRowDrops は base の公開以降にスナップショット path の監査ログに記録された、行数の減少を説明できる操作を集計します。
+// 物理削除（purge）は削除した行数を、スナップショットからの復元（restore_snapshot）は業務データのテーブルの全行を説明できる減少とします。
+// base 以降の監査ログは base.AuditMaxID より後の行です（記録の無い従来のマニフェストでは base の作成時刻以降）。
+func ExplainedRowDrops(ctx context.Context, path string, base SnapshotManifest) (map[string]int64, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	cond, arg := "id > ?", any(base.AuditMaxID)
+	if base.AuditMaxID == 0 {
+		cond, arg = "at >= ?", timestampText(base.CreatedAt.Truncate(time.Second))
+	}
+	rows, err := db.QueryContext(ctx, `
+SELECT entity, action, CAST(COALESCE(json_extract(after_json, '$.rows'), 0) AS INTEGER)
+FROM audit_log
+WHERE `+cond+` AND action IN (?, ?)`, arg, auditActionPurge, auditActionRestoreSnapshot)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[string]int64{}
+	for rows.Next() {
+		var (
+			entity, action string
+			n              int64
+		)
+		if err := rows.Scan(&entity, &action, &n); err != nil {
+			return nil, err
+		}
+		switch action {
+		case auditActionPurge:
+			if t, ok := purgeAuditTables[entity]; ok {
+				out[t] += n
+			}
+		case auditActionRestoreSnapshot:
+			for _, t := range purgeAuditTables {
+				out[t] = max(out[t], base.RowCounts[t])
+			}
+		}
+	}
+	return out, rows.Err()
+}
+
+// currentManifest は公開中の current のマニフェストを返します（無い・従来形式なら nil）。
+func (s GCSSnapshotStrategy) currentManifest(ctx context.Context) (*SnapshotManifest, error) {
+	return s.remoteManifest(ctx, FileName)
+}
+
+// remoteManifest は object のマニフェストを返します（無い・従来形式なら nil）。
+func (s GCSSnapshotStrategy) remoteManifest(ctx context.Context, object string) (*SnapshotManifest, error) {
+	f, err := os.CreateTemp("", "app-current-*.manifest.json")
+	if err != nil {
+		return nil, err
+	}
+	path := f.Name()
+	_ = f.Close()
+	defer os.Remove(path)
+	if err := s.ObjectStore.Download(ctx, s.Bucket, ManifestKey(object), path); err != nil {
+		if errors.Is(err, storageif.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	m, err := ReadManifest(path)
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// saveAside は current に昇格しないスナップショットを prefix（quarantine/ など）以下に保管します。
+// packed が空（マニフェストを作れないほど壊れている）の場合は snap をそのまま置きますが、暗号化が有効なら平文を置かないため保管しません。
+func (s GCSSnapshotStrategy) saveAside(ctx context.Context, prefix, snap, packed, manifestPath string, at time.Time) (string, error) {
+	key := snapshotKeyAt(prefix, at)
+	if packed == "" {
+		if s.Keyring != nil {
+			return "", errors.New("snapshot is not kept: cannot encrypt a snapshot that failed to pack")
+		}
+		return key, s.ObjectStore.Upload(ctx, s.Bucket, key, snap)
+	}
+	if err := s.ObjectStore.Upload(ctx, s.Bucket, key, packed); err != nil {
+		return "", err
+	}
+	return key, s.ObjectStore.Upload(ctx, s.Bucket, ManifestKey(key), manifestPath)
+}
+
+// reject は検査に失敗したスナップショットを quarantine/ に保管し、ErrSnapshotRejected を返します。
+// Hold があれば以降の公開を止めます（明示的に受け入れるまで、以降のスナップショットも quarantine/ に保管する）。
+func (s GCSSnapshotStrategy) reject(ctx context.Context, problems []string, snap, packed, manifestPath string, at time.Time) error {
+	key, err := s.saveAside(ctx, quarantinePrefix, snap, packed, manifestPath, at)
+	if err != nil {
+		slog.ErrorContext(ctx, "quarantine snapshot failed", slog.Any("error", err))
+	}
+	slog.ErrorContext(ctx, "snapshot rejected; current is not updated",
+		slog.Any("problems", problems), slog.String("quarantine", key))
+	if s.Hold != nil {
+		s.Hold.hold(HeldSnapshot{Key: key, At: at.UTC(), Problems: problems})
+	}
+	return fmt.Errorf("%w: %s", ErrSnapshotRejected, strings.Join(problems, "; "))
+}
+
+// PublishHold は公開前の検査に失敗したスナップショットを記録し、明示的に受け入れる（行数の比較を省いて公開する）まで
+// current への公開を止めます。止めている間のスナップショットも quarantine/ に保管するため、書き込みは失われません。
+type PublishHold struct {
+	mu   sync.Mutex
+	held *HeldSnapshot
+}
+
+// HeldSnapshot は current への公開を止める原因となったスナップショットです。
+type HeldSnapshot struct {
+	Key      string    `json:"key"` // quarantine/ に保管したキー（保管できなかった場合は空）
+	At       time.Time `json:"at"`
+	Problems []string  `json:"problems"`
+}
+
+// hold は公開を止めます（既に止めていれば最初の原因を残す）。
+func (h *PublishHold) hold(hs HeldSnapshot) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.held == nil {
+		h.held = &hs
+	}
+}
+
+// Held は公開を止めていればその原因を返します。
+func (h *PublishHold) Held() (HeldSnapshot, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.held == nil {
+		return HeldSnapshot{}, false
+	}
+	return *h.held, true
+}
+
+// release は公開の停止を解除します。
+func (h *PublishHold) release() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.held = nil
+}
+
+// PublishHeld は current への公開を止めていればその原因を返します（Hold が無ければ常に false）。
+func (s GCSSnapshotStrategy) PublishHeld() (HeldSnapshot, bool) {
+	if s.Hold == nil {
+		return HeldSnapshot{}, false
+	}
+	return s.Hold.Held()
+}
+
+// holdIfQuarantineIsNewer は current より新しいスナップショットが quarantine/ にあれば公開を止めます。
+// 前のインスタンスが公開を止めたまま終了した場合で、その書き込みは quarantine/ にしか残っていません。
+func (s GCSSnapshotStrategy) holdIfQuarantineIsNewer(ctx context.Context) error {
+	objs, err := s.ObjectStore.List(ctx, s.Bucket, quarantinePrefix)
+	if err != nil {
+		return err
+	}
+	var (
+		newest string
+		at     time.Time
+	)
+	for _, o := range objs {
+		if t, ok := parseSnapshotKey(quarantinePrefix, o.Name); ok && !t.Before(at) {
+			newest, at = o.Name, t
+		}
+	}
+	if newest == "" {
+		return nil
+	}
+	if qm, err := s.remoteManifest(ctx, newest); err != nil {
+		return err
+	} else if qm != nil {
+		at = qm.CreatedAt
+	}
+	base, err := s.currentManifest(ctx)
+	if err != nil {
+		return err
+	}
+	if base != nil && !at.After(base.CreatedAt) {
+		return nil
+	}
+	slog.ErrorContext(ctx, "SNAPSHOT HELD: a quarantined snapshot is newer than current; publishing is held until accepted",
+		slog.String("quarantine", newest), slog.Time("quarantined_at", at))
+	s.Hold.hold(HeldSnapshot{Key: newest, At: at.UTC(), Problems: []string{"quarantined snapshot is newer than current"}})
+	return nil
+}
@@ -0,0 +1,240 @@
+package sqlite
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kawabatas/mini-web-app/internal/domain/model"
+	"github.com/kawabatas/mini-web-app/internal/infra/storage/local"
+)
+
+// newTestStrategy はローカルディレクトリをバケットにした GCSSnapshotStrategy を返します。
+func newTestStrategy(t *testing.T) GCSSnapshotStrategy {
+	t.Helper()
+	return GCSSnapshotStrategy{
+		ObjectStore: local.FS{},
+		Bucket:      t.TempDir(),
+		Verify:      VerifyPolicy{MaxRowDropPercent: 50},
+		Fence:       &PublishFence{},
+		Hold:        &PublishHold{},
+	}
+}
+
+// openTestDB は一時ディレクトリに初期データ（歌手 3 件）入りの DB を開きます。
+func openTestDB(t *testing.T) (*Conns, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), FileName)
+	conns, err := OpenAndInit(context.Background(), path)
+	if err != nil {
+		t.Fatalf("OpenAndInit: %v", err)
+	}
+	t.Cleanup(func() { _ = conns.Close() })
+	return conns, path
+}
+
+// purgeSingers は id の歌手を論理削除してから物理削除します。audit なら usecase と同様にパージを監査ログに記録します。
+func purgeSingers(t *testing.T, conns *Conns, audit bool, ids ...int64) {
+	t.Helper()
+	ctx := context.Background()
+	repo := NewSingerRepo(conns)
+	for _, id := range ids {
+		if err := repo.Delete(ctx, id, 1); err != nil {
+			t.Fatalf("Delete(%d): %v", id, err)
+		}
+	}
+	n, err := repo.Purge(ctx, time.Now().Add(time.Hour))
+	if err != nil || n != int64(len(ids)) {
+		t.Fatalf("Purge = %d, %v; want %d", n, err, len(ids))
+	}
+	if !audit {
+		return
+	}
+	after, _ := json.Marshal(map[string]any{"rows": n})
+	e := model.AuditEntry{At: time.Now(), Actor: "system:purge", Entity: "singer", Action: auditActionPurge, After: after}
+	if _, err := NewAuditRepo(conns).Append(ctx, e); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+}
+
+func singerRowCount(t *testing.T, s GCSSnapshotStrategy) int64 {
+	t.Helper()
+	m, err := s.currentManifest(context.Background())
+	if err != nil || m == nil {
+		t.Fatalf("currentManifest = %v, %v", m, err)
+	}
+	return m.RowCounts["singers"]
+}
+
+func TestCompareRowCounts(t *testing.T) {
+	base := map[string]int64{"singers": 10, "audit_log": 4, "outbox": 100, "empty": 0}
+	for name, tc := range map[string]struct {
+		next, explained map[string]int64
+		maxDrop         int
+		want            []string // 失敗するテーブル
+	}{
+		"unchanged":             {next: base, maxDrop: 50},
+		"drop at the limit":     {next: map[string]int64{"singers": 5, "audit_log": 4}, maxDrop: 50},
+		"drop over the limit":   {next: map[string]int64{"singers": 4, "audit_log": 4}, maxDrop: 50, want: []string{"singers"}},
+		"table removed":         {next: map[string]int64{"singers": 10}, maxDrop: 50, want: []string{"audit_log"}},
+		"growth":                {next: map[string]int64{"singers": 20, "audit_log": 8}, maxDrop: 50},
+		"outbox is exempt":      {next: map[string]int64{"singers": 10, "audit_log": 4, "outbox": 0}, maxDrop: 50},
+		"check disabled":        {next: map[string]int64{}, maxDrop: 0},
+		"one percent tolerance": {next: map[string]int64{"singers": 9, "audit_log": 4}, maxDrop: 1, want: []string{"singers"}},
+		"explained by purge":    {next: map[string]int64{"singers": 2, "audit_log": 5}, explained: map[string]int64{"singers": 8}, maxDrop: 50},
+		"partly explained":      {next: map[string]int64{"singers": 1, "audit_log": 5}, explained: map[string]int64{"singers": 6}, maxDrop: 50, want: []string{"singers"}},
+		"explained beyond base": {next: map[string]int64{"singers": 0, "audit_log": 5}, explained: map[string]int64{"singers": 12}, maxDrop: 50},
+	} {
+		t.Run(name, func(t *testing.T) {
+			got := CompareRowCounts(base, tc.next, tc.explained, tc.maxDrop)
+			if len(got) != len(tc.want) {
+				t.Fatalf("problems = %q, want failures for %v", got, tc.want)
+			}
+			for i, table := range tc.want {
+				if !strings.Contains(got[i], "row count of "+table+" ") {
+					t.Fatalf("problems = %q, want failures for %v", got, tc.want)
+				}
+			}
+		})
+	}
+}
+
+func TestUpload_PurgeExplainedByAuditIsPublished(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStrategy(t)
+	conns, path := openTestDB(t)
+	if err := s.upload(ctx, path); err != nil {
+		t.Fatalf("first upload: %v", err)
+	}
+	if n := singerRowCount(t, s); n != 3 {
+		t.Fatalf("singers in current = %d, want 3", n)
+	}
+
+	// 3 → 1: 監査ログに記録したパージによる減少は検査を通る
+	purgeSingers(t, conns, true, 1, 2)
+	if err := s.upload(ctx, path); err != nil {
+		t.Fatalf("upload after purge: %v", err)
+	}
+	if n := singerRowCount(t, s); n != 1 {
+		t.Fatalf("singers in current = %d, want 1", n)
+	}
+	if _, held := s.PublishHeld(); held {
+		t.Fatal("publishing is held after an explained purge")
+	}
+}
+
+func TestUpload_UnexplainedDropHoldsUntilAccepted(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStrategy(t)
+	conns, path := openTestDB(t)
+	if err := s.upload(ctx, path); err != nil {
+		t.Fatalf("first upload: %v", err)
+	}
+
+	// 監査ログに無い 3 → 1 の減少は quarantine/ に保管し、公開を止める
+	purgeSingers(t, conns, false, 1, 2)
+	if err := s.upload(ctx, path); !errors.Is(err, ErrSnapshotRejected) {
+		t.Fatalf("upload = %v, want ErrSnapshotRejected", err)
+	}
+	h, held := s.PublishHeld()
+	if !held || !strings.HasPrefix(h.Key, quarantinePrefix) || len(h.Problems) == 0 {
+		t.Fatalf("PublishHeld = %+v, %v; want the quarantined snapshot", h, held)
+	}
+	if n := singerRowCount(t, s); n != 3 {
+		t.Fatalf("singers in current = %d, want 3 (not published)", n)
+	}
+
+	// 止めている間は検査を通るスナップショットも公開しない
+	if _, err := NewSingerRepo(conns).Create(ctx, model.Singer{Name: "Beyonce", Genre: "R&B", DebutYear: 1997}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := s.upload(ctx, path); !errors.Is(err, ErrSnapshotRejected) {
+		t.Fatalf("upload while held = %v, want ErrSnapshotRejected", err)
+	}
+	if h2, _ := s.PublishHeld(); h2.Key != h.Key {
+		t.Fatalf("held key = %q, want the first rejected %q", h2.Key, h.Key)
+	}
+
+	// 明示的に受け入れると公開し、停止を解除する
+	if err := s.upload(WithoutRowDropCheck(ctx), path); err != nil {
+		t.Fatalf("accepting upload: %v", err)
+	}
+	if _, held := s.PublishHeld(); held {
+		t.Fatal("publishing is still held after accepting")
+	}
+	if n := singerRowCount(t, s); n != 2 {
+		t.Fatalf("singers in current = %d, want 2", n)
+	}
+}
+
+func TestStartup_HoldsWhenQuarantineIsNewer(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStrategy(t)
+	conns, path := openTestDB(t)
+	if err := s.upload(ctx, path); err != nil {
+		t.Fatalf("first upload: %v", err)
+	}
+	purgeSingers(t, conns, false, 1, 2)
+	if err := s.upload(ctx, path); !errors.Is(err, ErrSnapshotRejected) {
+		t.Fatalf("upload = %v, want ErrSnapshotRejected", err)
+	}
+	h, _ := s.PublishHeld()
+
+	// 公開を止めたまま終了した後の起動: 新しいインスタンスも公開を止める
+	next := s
+	next.Hold, next.Fence = &PublishHold{}, &PublishFence{}
+	rep, err := next.Startup(ctx, filepath.Join(t.TempDir(), FileName))
+	if err != nil || rep.Source != StartupSourceCurrent {
+		t.Fatalf("Startup = %+v, %v", rep, err)
+	}
+	got, held := next.PublishHeld()
+	if !held || got.Key != h.Key {
+		t.Fatalf("PublishHeld after startup = %+v, %v; want %q", got, held, h.Key)
+	}
+
+	// quarantine/ が current より古ければ止めない
+	if err := s.upload(WithoutRowDropCheck(ctx), path); err != nil {
+		t.Fatalf("accepting upload: %v", err)
+	}
+	after := s
+	after.Hold, after.Fence = &PublishHold{}, &PublishFence{}
+	if _, err := after.Startup(ctx, filepath.Join(t.TempDir(), FileName)); err != nil {
+		t.Fatalf("Startup: %v", err)
+	}
+	if h, held := after.PublishHeld(); held {
+		t.Fatalf("PublishHeld = %+v after the quarantine was accepted", h)
+	}
+}
+
+func TestExplainedRowDrops_RestoreSnapshot(t *testing.T) {
+	ctx := context.Background()
+	conns, path := openTestDB(t)
+	snap := filepath.Join(t.TempDir(), "snap.sqlite")
+	if err := SnapshotTo(ctx, path, snap); err != nil {
+		t.Fatalf("SnapshotTo: %v", err)
+	}
+	_, counts, auditMax, err := inspectSnapshot(ctx, snap)
+	if err != nil {
+		t.Fatalf("inspectSnapshot: %v", err)
+	}
+	base := SnapshotManifest{RowCounts: counts, AuditMaxID: auditMax}
+
+	e := model.AuditEntry{At: time.Now(), Actor: "admin", Entity: "datastore", Action: auditActionRestoreSnapshot}
+	if _, err := NewAuditRepo(conns).Append(ctx, e); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	if err := SnapshotTo(ctx, path, snap+".2"); err != nil {
+		t.Fatalf("SnapshotTo: %v", err)
+	}
+	got, err := ExplainedRowDrops(ctx, snap+".2", base)
+	if err != nil {
+		t.Fatalf("ExplainedRowDrops: %v", err)
+	}
+	if got["singers"] != counts["singers"] {
+		t.Fatalf("explained = %v, want all %d singers", got, counts["singers"])
+	}
+}
@@ -3,11 +3,13 @@ package sqlite
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	_ "modernc.org/sqlite"
@@ -37,40 +39,89 @@ func dsnWithPragma(path string) string {
 	return fmt.Sprintf("%s?_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)&_pragma=busy_timeout(%d)", path, busyTimeoutMs)
 }
 
-func OpenAndInit(ctx context.Context, path string) (*sql.DB, error) {
-	db, err := sql.Open("sqlite", dsnWithPragma(path))
+// writerDSN は書き込み用の DSN です。
+// _txlock=immediate により BEGIN 時点で RESERVED ロックを取得し、
+// トランザクション途中の読み取り→書き込み昇格で SQLITE_BUSY になるのを避けます。
+func writerDSN(path string) string {
+	return dsnWithPragma(path) + "&_txlock=immediate"
+}
+
+// readerDSN は読み取り専用の DSN です（query_only で書き込みを拒否）。
+func readerDSN(path string) string {
+	return dsnWithPragma(path) + "&_pragma=query_only(1)"
+}
+
+// Conns は SQLite への接続プールの組です。
+//   - Writer: 書き込み専用。接続は 1 本に固定し、アプリ内で書き込みを直列化する
+//   - Reader: 読み取り専用。WAL により Writer と並行して読み取れる
+type Conns struct {
+	Writer *sql.DB
+	Reader *sql.DB
+}
+
+// Ping は両方のプールの疎通を確認します。
+func (c *Conns) Ping(ctx context.Context) error {
+	if err := c.Writer.PingContext(ctx); err != nil {
+		return err
+	}
+	return c.Reader.PingContext(ctx)
+}
+
+// Close は両方のプールを閉じます。
+func (c *Conns) Close() error {
+	if c.Reader == c.Writer {
+		return c.Writer.Close()
+	}
+	return errors.Join(c.Reader.Close(), c.Writer.Close())
+}
+
+// OpenAndInit は書き込み用・読み取り用のプールを開き、スキーマを最新バージョンまでマイグレーションします（新しい DB には初期データを投入する）。
+// スナップショットのスキーマがバイナリより新しい場合は ErrSchemaTooNew を返します。
+func OpenAndInit(ctx context.Context, path string) (*Conns, error) {
+	w, err := sql.Open("sqlite", writerDSN(path))
 	if err != nil {
 		return nil, err
 	}
-	if err := initSchemaAndSeed(ctx, db); err != nil {
+	w.SetMaxOpenConns(1)
+	w.SetMaxIdleConns(1)
+	w.SetConnMaxLifetime(0)
+	if err := migrateAndSeed(ctx, w); err != nil {
+		_ = w.Close()
+		return nil, fmt.Errorf("migrate %s: %w", path, err)
+	}
+	r, err := sql.Open("sqlite", readerDSN(path))
+	if err != nil {
+		_ = w.Close()
 		return nil, err
 	}
-	return db, nil
+	return &Conns{Writer: w, Reader: r}, nil
 }
 
-func initSchemaAndSeed(ctx context.Context, db *sql.DB) error {
-	// スキーマ初期化
-	if _, err := db.ExecContext(ctx, `
-CREATE TABLE IF NOT EXISTS singers (
-  id INTEGER PRIMARY KEY AUTOINCREMENT,
-  name TEXT NOT NULL,
-  genre TEXT NOT NULL,
-  debut_year INTEGER NOT NULL,
-  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
-);
-`); err != nil {
-		return fmt.Errorf("init schema: %w", err)
+// memoryDBSeq はインメモリ DB 名の採番用です（Open ごとに独立した DB にする）。
+var memoryDBSeq atomic.Int64
+
+// OpenMemory は共有キャッシュのインメモリ SQLite を開き、スキーマを最新まで適用します（初期データは投入しません）。
+// 主にテスト用途です。ファイルを作らず、Close すると内容は破棄されます。
+//
+// 共有キャッシュではテーブル単位のロックとなり busy_timeout が効かない（SQLITE_LOCKED）ため、
+// Writer / Reader は同じ 1 接続のプールを共有します。
+func OpenMemory(ctx context.Context) (*Conns, error) {
+	name := fmt.Sprintf("memdb-%d", memoryDBSeq.Add(1))
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared&_pragma=busy_timeout(%d)&_pragma=foreign_keys(1)", name, busyTimeoutMs)
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
 	}
-	// データが空なら初期データ投入
-	var cnt int
-	if err := db.QueryRowContext(ctx, `SELECT COUNT(1) FROM singers`).Scan(&cnt); err == nil && cnt == 0 {
-		_, _ = db.ExecContext(ctx, `INSERT INTO singers(name, genre, debut_year) VALUES
-			('Taylor Swift','Pop',2006),
-			('Ed Sheeran','Pop',2011),
-			('Adele','Soul',2008)
-		`)
+	// 接続が全て閉じると DB が消えるため、1 接続を保持し続ける
+	db.SetMaxOpenConns(1)
+	db.SetMaxIdleConns(1)
+	db.SetConnMaxLifetime(0)
+	db.SetConnMaxIdleTime(0)
+	if err := Migrate(ctx, db); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("migrate %s: %w", name, err)
 	}
-	return nil
+	return &Conns{Writer: db, Reader: db}, nil
 }
 
 // SnapshotTo は VACUUM INTO を用いて、SQLite DB の一貫したスナップショットを作成します。
@@ -141,6 +192,14 @@ func isBusyErr(err error) bool {
 	return strings.Contains(s, "SQLITE_BUSY") || strings.Contains(s, "database is locked")
 }
 
+// isUniqueErr は一意制約違反（SQLITE_CONSTRAINT_UNIQUE）を判定します。
+func isUniqueErr(err error) bool {
+	if err == nil {
+		return false
+	}
+	return strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
+
 // timeAfter は ms ミリ秒待機するか、ctx が終了したら返します。
 func timeAfter(ctx context.Context, ms int) <-chan struct{} {
 	ch := make(chan struct{})
@@ -0,0 +1,27 @@
+package sqlite
+
+import (
+	"context"
+	"testing"
+)
+
+func TestOpenAndInit_SeedsOnlyNewDatabase(t *testing.T) {
+	conns, path := openTestDB(t)
+	if n := countSingers(t, path); n != 3 {
+		t.Fatalf("singers in a new database = %d, want 3", n)
+	}
+
+	// 全て削除した DB を開き直しても初期データは再投入しない
+	purgeSingers(t, conns, false, 1, 2, 3)
+	if err := conns.Close(); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := OpenAndInit(context.Background(), path)
+	if err != nil {
+		t.Fatalf("OpenAndInit: %v", err)
+	}
+	defer reopened.Close()
+	if n := countSingers(t, path); n != 0 {
+		t.Fatalf("singers after reopening an emptied database = %d, want 0", n)
+	}
+}
@@ -2,36 +2,126 @@ package sqlite
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
 
 	storageif "github.com/kawabatas/mini-web-app/internal/infra/storage"
+	"github.com/kawabatas/mini-web-app/internal/infra/storage/envelope"
 	"github.com/kawabatas/mini-web-app/internal/util/clock"
 )
 
 // GCSSnapshotStrategy は SQLite のスナップショットを GCS（等のObjectStore）に同期する戦略です。
-// - 起動時: currentKey をローカルにダウンロード
-// - 終了時: VACUUM INTO で一貫スナップショットを作成 → 二相アップロード + backups/ に保管
+// - 起動時: currentKey をローカルにダウンロード（Replicator があれば WAL のレプリカから復元、current が壊れていれば backups/ から）
+// - 稼働中: Replicator があれば WAL を数秒間隔で配送
+// - 終了時: VACUUM INTO で一貫スナップショットを作成 → 検査（失敗したら quarantine/ に保管し、Hold があれば受け入れるまで公開を止める）→ 圧縮して二相アップロード + backups/ に保管
+//
+// Keyring を設定するとスナップショット（と WAL のレプリカ）をエンベロープ暗号化してからアップロードします。
+// スナップショットの隣には SnapshotManifest（<object>.manifest.json）を置き、
+// 起動時はダウンロードしたスナップショットを展開してチェックサムを確認してから DB を開きます。
 type GCSSnapshotStrategy struct {
 	ObjectStore storageif.ObjectStore
 	Bucket      string
+	Replicator  *Replicator       // nil なら WAL を配送しない
+	Compression string            // zstd | gzip | none（空は zstd）
+	Keyring     *envelope.Keyring // nil なら暗号化しない（復号には過去の KEK も含めて設定する）
+	Verify      VerifyPolicy      // 公開前の検査
+	Fence       *PublishFence     // nil なら current を無条件に置き換える（他のインスタンスによる公開を検知しない）
+	Hold        *PublishHold      // nil なら検査に失敗しても次のスナップショットは公開を試みる
 }
 
+// OnStartup は DB を復元します（current が使えなければ backups/ に遡る。Startup を参照）。
 func (s GCSSnapshotStrategy) OnStartup(ctx context.Context, dbPath string) error {
-	if s.ObjectStore == nil || s.Bucket == "" {
+	_, err := s.Startup(ctx, dbPath)
+	return err
+}
+
+// downloadSnapshot は object をダウンロードし、マニフェストがあれば展開・検証して dbPath に配置します。
+// 二相アップロードの途中（スナップショットとマニフェストの世代が食い違う）に当たった場合に備えて、検証失敗時は一度だけ再試行します。
+// マニフェストの無い従来形式のオブジェクトでは nil のマニフェストを返します。
+// object が無い場合は storageif.ErrNotExist を返します。ダウンロードした object の世代番号も返します。
+func (s GCSSnapshotStrategy) downloadSnapshot(ctx context.Context, object, dbPath string) (*SnapshotManifest, int64, error) {
+	const attempts = 2
+	var (
+		m   *SnapshotManifest
+		gen int64
+		err error
+	)
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			slog.WarnContext(ctx, "snapshot verification failed, retrying", slog.String("object", object), slog.Any("error", err))
+			select {
+			case <-timeAfter(ctx, 1000):
+			case <-ctx.Done():
+				return nil, 0, ctx.Err()
+			}
+		}
+		if m, gen, err = s.tryDownloadSnapshot(ctx, object, dbPath); err == nil || errors.Is(err, storageif.ErrNotExist) {
+			return m, gen, err
+		}
+	}
+	return nil, 0, err
+}
+
+func (s GCSSnapshotStrategy) tryDownloadSnapshot(ctx context.Context, object, dbPath string) (*SnapshotManifest, int64, error) {
+	packed := dbPath + ".download"
+	defer os.Remove(packed)
+	gen, err := s.ObjectStore.DownloadGeneration(ctx, s.Bucket, object, packed)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	manifestPath := dbPath + ".manifest.json"
+	defer os.Remove(manifestPath)
+	err = s.ObjectStore.Download(ctx, s.Bucket, ManifestKey(object), manifestPath)
+	if errors.Is(err, storageif.ErrNotExist) {
+		// マニフェストの無い従来形式（非圧縮の SQLite ファイル）
+		return nil, gen, os.Rename(packed, dbPath)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	m, err := ReadManifest(manifestPath)
+	if err != nil {
+		return nil, 0, err
+	}
+	if object == FileName && m.Generation != 0 && m.Generation != gen {
+		// 別の公開のマニフェスト（公開とマニフェストの書き込みの間に割り込まれた）
+		return nil, 0, fmt.Errorf("%s: manifest is for generation %d, downloaded generation %d", object, m.Generation, gen)
+	}
+	if err := UnpackSnapshot(packed, m, dbPath, s.Keyring); err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", object, err)
+	}
+	slog.InfoContext(ctx, "snapshot verified",
+		slog.String("object", object), slog.String("sha256", m.SHA256), slog.Int("schema_version", m.SchemaVersion), slog.String("app_version", m.AppVersion))
+	return &m, gen, nil
+}
+
+// StartReplication は DB を開いた後に呼ばれ、WAL の配送を開始します。
+func (s GCSSnapshotStrategy) StartReplication(ctx context.Context, conns *Conns, dbPath string) error {
+	if s.Replicator == nil || s.ObjectStore == nil || s.Bucket == "" {
+		return nil
+	}
+	return s.Replicator.Start(ctx, conns, dbPath)
+}
+
+// StopReplication は WAL の配送を止め、未配送の WAL を送ります（終了時のスナップショットを公開しない場合に使う）。
+func (s GCSSnapshotStrategy) StopReplication(ctx context.Context) error {
+	if s.Replicator == nil {
 		return nil
 	}
-	return s.ObjectStore.DownloadIfNeeded(ctx, s.Bucket, FileName, dbPath)
+	return s.Replicator.Stop(ctx)
 }
 
 func (s GCSSnapshotStrategy) OnShutdown(ctx context.Context, dbPath string) error {
 	if s.ObjectStore == nil || s.Bucket == "" {
 		return nil
 	}
-	snap := "/tmp/app-snapshot-" + clock.NowUTCFormatted("20060102-150405") + ".sqlite"
-	if err := SnapshotTo(ctx, dbPath, snap); err != nil {
-		return err
+	if err := s.StopReplication(ctx); err != nil {
+		slog.ErrorContext(ctx, "final wal replication failed", slog.Any("error", err))
 	}
-	backupKey := "backups/" + clock.NowUTCFormatted("2006-01-02") + "/" + clock.NowUTCFormatted("150405") + "-" + FileName
-	return s.ObjectStore.UploadTwoPhaseWithBackup(ctx, s.Bucket, FileName, backupKey, snap)
+	return s.upload(ctx, dbPath)
 }
 
 // OnBackup performs a periodic snapshot upload without shutting down.
@@ -39,12 +129,92 @@ func (s GCSSnapshotStrategy) OnBackup(ctx context.Context, dbPath string) error
 	if s.ObjectStore == nil || s.Bucket == "" {
 		return nil
 	}
+	return s.upload(ctx, dbPath)
+}
+
+// upload はスナップショットを圧縮して current / backups/ にアップロードし、続けてマニフェストを同じキーの隣に置きます。
+// マニフェストは公開した current の世代番号を記録し、current がその世代のままの場合のみ書き込みます（publishManifest）。
+func (s GCSSnapshotStrategy) upload(ctx context.Context, dbPath string) error {
+	taken := clock.Now()
 	snap := "/tmp/app-snapshot-" + clock.NowUTCFormatted("20060102-150405") + ".sqlite"
-	if err := SnapshotTo(ctx, dbPath, snap); err != nil {
+	if err := s.snapshotTo(ctx, dbPath, snap); err != nil {
+		return err
+	}
+	// /tmp は Cloud Run ではメモリ上にあるため、アップロード後は消す
+	defer os.Remove(snap)
+	now := clock.Now()
+	problems, err := VerifySnapshotFile(ctx, snap, s.Verify)
+	if err != nil {
+		return err
+	}
+	packed, m, err := PackSnapshot(ctx, snap, s.Compression, s.Keyring)
+	if err != nil {
+		if len(problems) > 0 {
+			return s.reject(ctx, problems, snap, "", "", now)
+		}
 		return err
 	}
-	backupKey := "backups/" + clock.NowUTCFormatted("2006-01-02") + "/" + clock.NowUTCFormatted("150405") + "-" + FileName
-	return s.ObjectStore.UploadTwoPhaseWithBackup(ctx, s.Bucket, FileName, backupKey, snap)
+	defer os.Remove(packed)
+	// 起動時に WAL のレプリカと新しさを比べる基準（取り始める前に配送した WAL はすべてスナップショットに含まれる）
+	m.CreatedAt = taken.UTC()
+	manifestPath, err := WriteManifest(m)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(manifestPath)
+	accept := ctx.Value(skipRowDropKey{}) != nil
+	if !accept && s.Verify.MaxRowDropPercent > 0 {
+		base, err := s.currentManifest(ctx)
+		if err != nil {
+			return fmt.Errorf("read current manifest: %w", err)
+		}
+		if base != nil {
+			explained, err := ExplainedRowDrops(ctx, snap, *base)
+			if err != nil {
+				return fmt.Errorf("read audit log: %w", err)
+			}
+			problems = append(problems, CompareRowCounts(base.RowCounts, m.RowCounts, explained, s.Verify.MaxRowDropPercent)...)
+		}
+	}
+	if h, held := s.PublishHeld(); held && !accept && len(problems) == 0 {
+		problems = append(problems, fmt.Sprintf("publishing is held since %s was rejected", h.Key))
+	}
+	if len(problems) > 0 {
+		return s.reject(ctx, problems, snap, packed, manifestPath, now)
+	}
+
+	backupKey := backupKeyAt(now)
+	gen, err := s.publish(ctx, backupKey, snap, packed, manifestPath, now)
+	if err != nil {
+		return err
+	}
+	if err := s.publishManifest(ctx, backupKey, m, gen); err != nil {
+		return err
+	}
+	if accept && s.Hold != nil {
+		s.Hold.release()
+	}
+	slog.InfoContext(ctx, "snapshot uploaded",
+		slog.String("compression", m.Compression), slog.Int64("size", m.Size), slog.Int64("stored_size", m.StoredSize), slog.String("backup", backupKey))
+	if s.Replicator != nil {
+		// 公開したスナップショットより前に配送を終えた世代は、復元に使わない
+		if _, err := s.Replicator.Prune(ctx, taken); err != nil {
+			slog.WarnContext(ctx, "prune wal replicas failed", slog.Any("error", err))
+		}
+	}
+	return nil
+}
+
+// snapshotTo は WAL の配送中であれば配送の連続性を保つ Replicator.SnapshotTo を使います。
+func (s GCSSnapshotStrategy) snapshotTo(ctx context.Context, dbPath, out string) error {
+	if s.Replicator != nil {
+		err := s.Replicator.SnapshotTo(ctx, out)
+		if err == nil {
+			return nil
+		}
+		slog.WarnContext(ctx, "snapshot via replicator failed; falling back", slog.Any("error", err))
+	}
+	return SnapshotTo(ctx, dbPath, out)
 }
 
 // 注: インターフェイス実装の明示は循環参照を避けるため省略
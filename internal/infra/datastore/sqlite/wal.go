@@ -0,0 +1,64 @@
+package sqlite
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// WAL ファイルの形式（https://www.sqlite.org/fileformat2.html#walformat）
+//   - 先頭 32 バイトのヘッダ: magic(4) / version(4) / page size(4) / checkpoint seq(4) / salt-1(4) / salt-2(4) / checksum(8)
+//   - 続いてフレームが並ぶ: フレームヘッダ 24 バイト + ページ本体（page size）
+//   - フレームヘッダ: page no(4) / commit 後の DB ページ数(4, コミットフレーム以外は 0) / salt-1(4) / salt-2(4) / checksum(8)
+const (
+	walHeaderSize      = 32
+	walFrameHeaderSize = 24
+)
+
+// walPageSize は WAL ヘッダからページサイズを読み取ります。
+func walPageSize(hdr []byte) (int, error) {
+	if len(hdr) < walHeaderSize {
+		return 0, fmt.Errorf("wal header too short: %d bytes", len(hdr))
+	}
+	if magic := binary.BigEndian.Uint32(hdr[0:4]); magic != 0x377f0682 && magic != 0x377f0683 {
+		return 0, fmt.Errorf("invalid wal magic: %#x", magic)
+	}
+	n := int(binary.BigEndian.Uint32(hdr[8:12]))
+	if n == 1 {
+		// 65536 は 1 として格納される
+		n = 65536
+	}
+	if n < 512 || n&(n-1) != 0 {
+		return 0, fmt.Errorf("invalid wal page size: %d", n)
+	}
+	return n, nil
+}
+
+// walCommittedEnd は WAL の from 以降を走査し、最後のコミットフレームの終端位置を返します。
+// ソルトがヘッダと一致しないフレーム（前回の WAL の残骸）に達した時点で走査を止めます。
+// コミットされていない末尾のフレームは含めません（コミットが無ければ from を返します）。
+func walCommittedEnd(wal []byte, from int) (int, error) {
+	pageSize, err := walPageSize(wal)
+	if err != nil {
+		return 0, err
+	}
+	frameSize := walFrameHeaderSize + pageSize
+	start := from
+	if start < walHeaderSize {
+		start = walHeaderSize
+	} else if (start-walHeaderSize)%frameSize != 0 {
+		return 0, fmt.Errorf("wal offset %d is not on a frame boundary", from)
+	}
+	salt := wal[16:24]
+	end := from
+	for off := start; off+frameSize <= len(wal); off += frameSize {
+		fh := wal[off : off+walFrameHeaderSize]
+		if !bytes.Equal(fh[8:16], salt) {
+			break
+		}
+		if binary.BigEndian.Uint32(fh[4:8]) != 0 {
+			end = off + frameSize
+		}
+	}
+	return end, nil
+}
@@ -3,10 +3,13 @@ package datastore
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"sync"
+	"sync/atomic"
 
 	"github.com/kawabatas/mini-web-app/internal/domain/repository"
 	sqlitedriver "github.com/kawabatas/mini-web-app/internal/infra/datastore/sqlite"
@@ -14,33 +17,89 @@ import (
 )
 
 type sqliteStore struct {
-	db       *sql.DB
+	conns    *sqlitedriver.Conns
 	dbPath   string
 	strategy SnapshotStrategy
+	inMemory bool // インメモリ DB（スナップショット対象外）
+	startup  StartupReport
+
+	backupMu  sync.Mutex
+	published sqlitedriver.ChangeMark // 最後にスナップショットを取得した時点の変更数（ゼロ値は未取得）
+	scheduler *backupScheduler        // 書き込みを契機にしたバックアップ（nil なら無効）
+
+	lease       *sqlitedriver.Lease // 書き込みリース（nil なら常に書き込みを受け付ける）
+	leaseReady  atomic.Bool         // リースを取得し、最新の current に追いついた
+	awaiting    atomic.Bool         // 引き継ぎを依頼し、リースを待っている
+	leaseStop   context.CancelFunc
+	leaseDone   chan struct{}
+	replicating bool
+	writeMu     sync.RWMutex // 書き込み中のトランザクション（引き継ぎの前に終わるのを待つ）
+	renewMu     sync.Mutex   // リースの延長（定期の延長と書き込み時の延長を直列化する）
 
 	singer repository.SingerRepository
+	audit  repository.AuditRepository
+	outbox repository.OutboxRepository
 }
 
-func (s *sqliteStore) Ping(ctx context.Context) error { return s.db.PingContext(ctx) }
+func (s *sqliteStore) Ping(ctx context.Context) error { return s.conns.Ping(ctx) }
 func (s *sqliteStore) Close(ctx context.Context) error {
-	// 終了時のスナップショットは Strategy に委譲
-	if s.strategy != nil {
-		if err := s.strategy.OnShutdown(ctx, s.dbPath); err != nil {
-			slog.ErrorContext(ctx, "snapshot shutdown failed", slog.Any("error", err))
+	// 保留中の書き込み契機のバックアップは終了時のスナップショットに含まれる
+	if s.scheduler != nil {
+		s.scheduler.stop(ctx)
+	}
+	if s.leaseStop != nil {
+		s.leaseStop()
+		<-s.leaseDone
+	}
+	// 終了時のスナップショットは Strategy に委譲（書き込みリースを保持していなければ公開しない）
+	if s.strategy != nil && s.Writable(ctx) {
+		s.finalSnapshot(ctx)
+	} else if s.strategy != nil {
+		slog.WarnContext(ctx, "final snapshot skipped: write lease is not held")
+	}
+	// 最後のスナップショットの後で解放し、次のインスタンスがすぐに取得できるようにする
+	if s.lease != nil {
+		s.leaseReady.Store(false)
+		if err := s.lease.Release(ctx, s.publishedGeneration()); err != nil {
+			slog.ErrorContext(ctx, "release write lease failed", slog.Any("error", err))
+		}
+	}
+	return s.conns.Close()
+}
+
+// finalSnapshot は終了時のスナップショットを公開します。
+// 前回のスナップショット取得から DB が変更されていなければ公開せず、WAL の配送だけ止めます（同じ内容の backups/ を作らない）。
+func (s *sqliteStore) finalSnapshot(ctx context.Context) {
+	s.backupMu.Lock()
+	defer s.backupMu.Unlock()
+	mark, err := sqlitedriver.WriterChangeMark(ctx, s.conns.Writer)
+	if err == nil && mark == s.published {
+		slog.InfoContext(ctx, "final snapshot skipped: no changes since last snapshot")
+		if r, ok := any(s.strategy).(replicationCapable); ok {
+			if err := r.StopReplication(ctx); err != nil {
+				slog.ErrorContext(ctx, "final wal replication failed", slog.Any("error", err))
+			}
 		}
+		return
+	}
+	if err := s.strategy.OnShutdown(ctx, s.dbPath); err != nil {
+		slog.ErrorContext(ctx, "snapshot shutdown failed", slog.Any("error", err))
 	}
-	return s.db.Close()
 }
 
-// SetConnPool は SQLite の接続プール設定を適用します。
+// SetConnPool は SQLite の読み取りプールの設定を適用します。
+// 書き込み接続は 1 本固定のため対象外です（インメモリ DB は 1 接続を共有するため何もしません）。
 // - maxOpen: 同時に開ける最大接続数
 // - maxIdle: アイドル接続の最大数
 func (s *sqliteStore) SetConnPool(maxOpen, maxIdle int) {
+	if s.inMemory {
+		return
+	}
 	if maxOpen > 0 {
-		s.db.SetMaxOpenConns(maxOpen)
+		s.conns.Reader.SetMaxOpenConns(maxOpen)
 	}
 	if maxIdle >= 0 {
-		s.db.SetMaxIdleConns(maxIdle)
+		s.conns.Reader.SetMaxIdleConns(maxIdle)
 	}
 }
 
@@ -50,7 +109,39 @@ type backupCapable interface {
 }
 
 // Backup creates a consistent snapshot of the SQLite DB without closing connections.
+// 前回のスナップショット取得から DB が変更されていなければ何もしません（同じ内容のコピーを作らない）。
 func (s *sqliteStore) Backup(ctx context.Context) error {
+	if s.inMemory {
+		slog.DebugContext(ctx, "backup skipped: in-memory datastore")
+		return nil
+	}
+	if !s.Writable(ctx) {
+		return repository.ErrReadOnly
+	}
+	return s.snapshot(ctx)
+}
+
+// snapshot は前回のスナップショット取得から DB が変更されていればスナップショットを取得して公開します。
+func (s *sqliteStore) snapshot(ctx context.Context) error {
+	s.backupMu.Lock()
+	defer s.backupMu.Unlock()
+	// スナップショット前の時点を記録する（取得中の書き込みは次回のバックアップ対象になる）
+	mark, err := sqlitedriver.WriterChangeMark(ctx, s.conns.Writer)
+	if err != nil {
+		return err
+	}
+	if mark == s.published {
+		slog.InfoContext(ctx, "backup skipped: no changes since last snapshot")
+		return nil
+	}
+	if err := s.backup(ctx); err != nil {
+		return err
+	}
+	s.published = mark
+	return nil
+}
+
+func (s *sqliteStore) backup(ctx context.Context) error {
 	if s.strategy != nil {
 		if b, ok := any(s.strategy).(backupCapable); ok {
 			return b.OnBackup(ctx, s.dbPath)
@@ -69,24 +160,294 @@ func (s *sqliteStore) Backup(ctx context.Context) error {
 	return nil
 }
 
+// internal interface for optional snapshot restore capability on strategy
+type snapshotSource interface {
+	ListSnapshots(ctx context.Context) ([]sqlitedriver.SnapshotInfo, error)
+	FetchSnapshot(ctx context.Context, key, dest string) (*sqlitedriver.SnapshotManifest, error)
+}
+
+// restoreTables はスナップショットから置き換えるテーブルです（audit_log / outbox は履歴として残す）。
+var restoreTables = []string{"singers"}
+
+func (s *sqliteStore) snapshotSource() (snapshotSource, error) {
+	if s.inMemory || s.strategy == nil {
+		return nil, ErrSnapshotUnsupported
+	}
+	src, ok := any(s.strategy).(snapshotSource)
+	if !ok {
+		return nil, ErrSnapshotUnsupported
+	}
+	return src, nil
+}
+
+func (s *sqliteStore) ListSnapshots(ctx context.Context) ([]SnapshotInfo, error) {
+	src, err := s.snapshotSource()
+	if err != nil {
+		return nil, err
+	}
+	return src.ListSnapshots(ctx)
+}
+
+func (s *sqliteStore) RestoreSnapshot(ctx context.Context, key string, dryRun bool, fn func(tx Repositories) error) (SnapshotInfo, error) {
+	src, err := s.snapshotSource()
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+	var info SnapshotInfo
+	snaps, err := src.ListSnapshots(ctx)
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+	for _, sn := range snaps {
+		if sn.Key == key {
+			info = sn
+		}
+	}
+	if info.Key == "" {
+		return SnapshotInfo{}, fmt.Errorf("%w: snapshot %s", repository.ErrNotFound, key)
+	}
+
+	if info.Manifest, err = s.replaceFromSnapshot(ctx, src, key, restoreTables, dryRun, fn); err != nil {
+		return SnapshotInfo{}, err
+	}
+	if dryRun {
+		return info, nil
+	}
+	// 復元した内容を current に昇格（二相アップロード + backups/ に保管）。過去の時点に戻すため行数の減少は検査しない
+	if err := s.Backup(sqlitedriver.WithoutRowDropCheck(ctx)); err != nil {
+		return info, fmt.Errorf("promote restored snapshot: %w", err)
+	}
+	return info, nil
+}
+
+// replaceFromSnapshot はスナップショット key をダウンロード・検証し、tables をその内容で置き換えます（置き換えと fn は 1 トランザクション）。
+// dryRun の場合は検証のみ行います。
+func (s *sqliteStore) replaceFromSnapshot(ctx context.Context, src snapshotSource, key string, tables []string, dryRun bool, fn func(tx Repositories) error) (*sqlitedriver.SnapshotManifest, error) {
+	tmp := s.dbPath + ".restore"
+	defer os.Remove(tmp)
+	m, err := src.FetchSnapshot(ctx, key, tmp)
+	if err != nil {
+		return nil, fmt.Errorf("fetch snapshot %s: %w", key, err)
+	}
+	if err := sqlitedriver.PrepareSnapshot(ctx, tmp); err != nil {
+		return nil, fmt.Errorf("prepare snapshot %s: %w", key, err)
+	}
+	if dryRun {
+		return m, nil
+	}
+	s.writeMu.RLock()
+	defer s.writeMu.RUnlock()
+	if !s.Writable(ctx) {
+		return nil, repository.ErrReadOnly
+	}
+	err = sqlitedriver.RestoreTables(ctx, s.conns.Writer, tmp, tables, func(tx *sql.Tx) error {
+		return fn(sqliteTxRepos{
+			singer: sqlitedriver.NewSingerRepoTx(tx),
+			audit:  sqlitedriver.NewAuditRepoTx(tx),
+			outbox: sqlitedriver.NewOutboxRepoTx(tx),
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// internal interface for strategies that hold publishing after a rejected snapshot
+type publishHolder interface {
+	PublishHeld() (sqlitedriver.HeldSnapshot, bool)
+}
+
+// PublishHold は公開前の検査に失敗して current への公開を止めていれば、その原因を返します。
+func (s *sqliteStore) PublishHold() (HeldSnapshot, bool) {
+	if h, ok := any(s.strategy).(publishHolder); ok {
+		return h.PublishHeld()
+	}
+	return HeldSnapshot{}, false
+}
+
+// AcceptSnapshot は行数の比較を省いて current に公開し、公開の停止を解除します。
+// key が空なら現在の DB を、quarantine/ のキーなら DB 全体（業務データと履歴）をその内容で置き換えてから公開します。
+func (s *sqliteStore) AcceptSnapshot(ctx context.Context, key string, fn func(tx Repositories) error) error {
+	if key == "" {
+		if err := s.WithTx(ctx, fn); err != nil {
+			return err
+		}
+	} else {
+		src, err := s.snapshotSource()
+		if err != nil {
+			return err
+		}
+		if _, err := s.replaceFromSnapshot(ctx, src, key, reloadTables, false, fn); err != nil {
+			return err
+		}
+	}
+	if err := s.Backup(sqlitedriver.WithoutRowDropCheck(ctx)); err != nil {
+		return fmt.Errorf("publish accepted snapshot: %w", err)
+	}
+	return nil
+}
+
+// internal interface for strategies that report where the DB was restored from on startup
+type startupReporter interface {
+	Startup(ctx context.Context, dbPath string) (sqlitedriver.StartupReport, error)
+}
+
+// StartupReport は起動時の DB の復元元です（backups/ に遡った場合は Degraded）。
+func (s *sqliteStore) StartupReport() StartupReport { return s.startup }
+
+// internal interface for optional WAL replication capability on strategy
+type replicationCapable interface {
+	StartReplication(ctx context.Context, conns *sqlitedriver.Conns, dbPath string) error
+	StopReplication(ctx context.Context) error
+}
+
 func openSQLite(ctx context.Context, cfg Config) (DataStore, error) {
 	dbPath := sqlitedriver.Path(cfg.Source)
+	// 書き込みリースは current をダウンロードする前に取得する（取得できれば、その current が最新）
+	leaseHeld := false
+	if cfg.Lease != nil {
+		err := cfg.Lease.Acquire(ctx)
+		switch {
+		case err == nil:
+			leaseHeld = true
+			slog.InfoContext(ctx, "write lease acquired", slog.String("holder", cfg.Lease.Holder))
+		case errors.Is(err, sqlitedriver.ErrLeaseHeld):
+			slog.WarnContext(ctx, "write lease is held by another instance; starting read-only", slog.Any("error", err))
+		default:
+			slog.ErrorContext(ctx, "acquire write lease failed; starting read-only", slog.Any("error", err))
+		}
+	}
+	// 開けなかった場合は取得したリースを解放する（期限切れを待たずに他のインスタンスが取得できる）
+	opened := false
+	defer func() {
+		if leaseHeld && !opened {
+			if err := cfg.Lease.Release(context.WithoutCancel(ctx), 0); err != nil {
+				slog.ErrorContext(ctx, "release write lease failed", slog.Any("error", err))
+			}
+		}
+	}()
 	// 起動時のスナップショットは Strategy に委譲
-	if cfg.Strategy != nil {
+	var startup StartupReport
+	if r, ok := cfg.Strategy.(startupReporter); ok {
+		var err error
+		if startup, err = r.Startup(ctx, dbPath); err != nil {
+			return nil, err
+		}
+	} else if cfg.Strategy != nil {
 		if err := cfg.Strategy.OnStartup(ctx, dbPath); err != nil {
 			return nil, err
 		}
 	}
-	db, err := sqlitedriver.OpenAndInit(ctx, dbPath)
+	conns, err := sqlitedriver.OpenAndInit(ctx, dbPath)
 	if err != nil {
 		return nil, err
 	}
-	return &sqliteStore{
-		db:       db,
+	opened = true
+	s := &sqliteStore{
+		conns:    conns,
 		dbPath:   dbPath,
 		strategy: cfg.Strategy,
-		singer:   sqlitedriver.NewSingerRepo(db),
-	}, nil
+		startup:  startup,
+		lease:    cfg.Lease,
+	}
+	if startup.Source == sqlitedriver.StartupSourceCurrent {
+		// current から復元した内容は current と同じため、次の書き込みまでスナップショットを取らない
+		// （起動時に適用したマイグレーションは、次の起動でも適用される）
+		if mark, err := sqlitedriver.WriterChangeMark(ctx, conns.Writer); err == nil {
+			s.published = mark
+		}
+	}
+	if s.lease == nil || leaseHeld {
+		// WAL の配送は書き込みを受け付けるインスタンスのみ（読み取り専用の間はリースの取得時に始める）
+		s.startReplication(ctx)
+		s.leaseReady.Store(true)
+	}
+	if s.lease != nil && !leaseHeld && cfg.Handover {
+		// 読み取り専用（ウォームアップ）で起動し、保持者に引き継ぎを依頼する
+		if err := s.lease.RequestHandover(ctx); err != nil {
+			slog.ErrorContext(ctx, "request write lease handover failed", slog.Any("error", err))
+		} else {
+			s.awaiting.Store(true)
+			slog.InfoContext(ctx, "write lease handover requested; warming up read-only")
+		}
+	}
+	if s.lease != nil {
+		ctxLease, stop := context.WithCancel(context.Background())
+		s.leaseStop, s.leaseDone = stop, make(chan struct{})
+		go s.keepWriteLease(ctxLease, s.leaseDone)
+	}
+	if cfg.AutoBackup.Quiet > 0 {
+		s.scheduler = startBackupScheduler(cfg.AutoBackup, s.Backup)
+	}
+	// WithTx の外からの書き込みも書き込みリースで制限する
+	s.singer = gatedSingerRepo{notifyingSingerRepo{sqlitedriver.NewSingerRepo(conns), s.notifyWrite}, s.guardWrite}
+	s.audit = gatedAuditRepo{notifyingAuditRepo{sqlitedriver.NewAuditRepo(conns), s.notifyWrite}, s.guardWrite}
+	s.outbox = gatedOutboxRepo{notifyingOutboxRepo{sqlitedriver.NewOutboxRepo(conns), s.notifyWrite}, s.guardWrite}
+	return s, nil
+}
+
+// notifyWrite は書き込みを書き込み契機のバックアップに伝えます。
+func (s *sqliteStore) notifyWrite() {
+	if s.scheduler != nil {
+		s.scheduler.notify()
+	}
+}
+
+// openMemory はインメモリ SQLite の DataStore を開きます。スナップショット戦略は使用しません。
+func openMemory(ctx context.Context, cfg Config) (DataStore, error) {
+	conns, err := sqlitedriver.OpenMemory(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s := &sqliteStore{conns: conns, inMemory: true}
+	s.singer = gatedSingerRepo{sqlitedriver.NewSingerRepo(conns), s.guardWrite}
+	s.audit = gatedAuditRepo{sqlitedriver.NewAuditRepo(conns), s.guardWrite}
+	s.outbox = gatedOutboxRepo{sqlitedriver.NewOutboxRepo(conns), s.guardWrite}
+	if cfg.Seed != nil {
+		if err := s.WithTx(ctx, func(tx Repositories) error { return cfg.Seed(ctx, tx) }); err != nil {
+			_ = conns.Close()
+			return nil, fmt.Errorf("seed: %w", err)
+		}
+	}
+	return s, nil
 }
 
 func (s *sqliteStore) Singers() repository.SingerRepository { return s.singer }
+func (s *sqliteStore) Audit() repository.AuditRepository    { return s.audit }
+func (s *sqliteStore) Outbox() repository.OutboxRepository  { return s.outbox }
+
+// WithTx は書き込み接続上のトランザクションに束縛したリポジトリで fn を実行します。
+// 何か書き込んだトランザクションはコミット後に notifyWrite します。
+func (s *sqliteStore) WithTx(ctx context.Context, fn func(tx Repositories) error) error {
+	s.writeMu.RLock()
+	defer s.writeMu.RUnlock()
+	if !s.Writable(ctx) {
+		return repository.ErrReadOnly
+	}
+	var wrote bool
+	markWrote := func() { wrote = true }
+	err := sqlitedriver.RunInTx(ctx, s.conns.Writer, func(tx *sql.Tx) error {
+		wrote = false // 再実行時は数え直す
+		return fn(sqliteTxRepos{
+			singer: notifyingSingerRepo{sqlitedriver.NewSingerRepoTx(tx), markWrote},
+			audit:  notifyingAuditRepo{sqlitedriver.NewAuditRepoTx(tx), markWrote},
+			outbox: notifyingOutboxRepo{sqlitedriver.NewOutboxRepoTx(tx), markWrote},
+		})
+	})
+	if err == nil && wrote {
+		s.notifyWrite()
+	}
+	return err
+}
+
+// sqliteTxRepos はトランザクションに束縛されたリポジトリの集合です。
+type sqliteTxRepos struct {
+	singer repository.SingerRepository
+	audit  repository.AuditRepository
+	outbox repository.OutboxRepository
+}
+
+func (r sqliteTxRepos) Singers() repository.SingerRepository { return r.singer }
+func (r sqliteTxRepos) Audit() repository.AuditRepository    { return r.audit }
+func (r sqliteTxRepos) Outbox() repository.OutboxRepository  { return r.outbox }
@@ -0,0 +1,57 @@
+package datastore
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kawabatas/mini-web-app/internal/domain/model"
+	sqlitedriver "github.com/kawabatas/mini-web-app/internal/infra/datastore/sqlite"
+	"github.com/kawabatas/mini-web-app/internal/infra/storage/local"
+)
+
+func TestSQLiteStore_CloseSkipsUnchangedSnapshot(t *testing.T) {
+	ctx := context.Background()
+	t.Chdir(t.TempDir())
+	bucket := t.TempDir()
+	strategy := sqlitedriver.GCSSnapshotStrategy{ObjectStore: local.FS{}, Bucket: bucket, Fence: &sqlitedriver.PublishFence{}}
+	currentGeneration := func() int64 {
+		t.Helper()
+		attrs, err := local.FS{}.Stat(ctx, bucket, sqlitedriver.FileName)
+		if err != nil {
+			t.Fatalf("Stat current: %v", err)
+		}
+		return attrs.Generation
+	}
+	// open は DataStore を開き、write を実行して閉じます
+	open := func(write bool) {
+		t.Helper()
+		ds, err := Open(ctx, Config{Driver: "sqlite", Strategy: strategy})
+		if err != nil {
+			t.Fatalf("Open: %v", err)
+		}
+		if write {
+			if _, err := ds.Singers().Create(ctx, model.Singer{Name: "Adele", Genre: "Soul", DebutYear: 2008}); err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+		}
+		if err := ds.Close(ctx); err != nil {
+			t.Fatalf("Close: %v", err)
+		}
+	}
+
+	// 空のバケットから始めた DB は終了時に公開する
+	open(false)
+	first := currentGeneration()
+
+	// current から復元して書き込まなければ公開しない
+	open(false)
+	if got := currentGeneration(); got != first {
+		t.Fatalf("current was republished without changes (generation %d -> %d)", first, got)
+	}
+
+	// 書き込めば公開する
+	open(true)
+	if got := currentGeneration(); got == first {
+		t.Fatal("current was not published after a write")
+	}
+}
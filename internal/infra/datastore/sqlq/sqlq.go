@@ -0,0 +1,97 @@
+// Package sqlq は各ドライバ共通の SQL 組み立て補助です。
+// プレースホルダは ? で組み立て、PostgreSQL では Rebind で $n に変換して使用します。
+package sqlq
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Conds は AND で結合する WHERE 条件の集まりです。
+type Conds struct {
+	conds []string
+	args  []any
+}
+
+// Add は条件を追加します。cond 内の ? の数と args の数を揃えること。
+func (c *Conds) Add(cond string, args ...any) {
+	c.conds = append(c.conds, cond)
+	c.args = append(c.args, args...)
+}
+
+// Where は "WHERE ..." 句を返します（条件がなければ空文字）。
+func (c *Conds) Where() string {
+	if len(c.conds) == 0 {
+		return ""
+	}
+	return "WHERE " + strings.Join(c.conds, "\n  AND ")
+}
+
+// Args はバインドする値を返します。
+func (c *Conds) Args() []any { return c.args }
+
+// Order はソート順 1 件です。Column は呼び出し側でホワイトリスト済みの識別子のみを渡すこと。
+type Order struct {
+	Column string
+	Desc   bool
+}
+
+// Keyset は orders（末尾はユニークなキー。通常は id）の並びで、基点 vals より後ろの行を選ぶ条件を返します。
+// backward の場合は基点より前（逆方向）の行を選びます。
+//
+// 例: (a ASC, id ASC) の基点 (x, 10) → (a > ?) OR (a = ? AND id > ?)
+func Keyset(orders []Order, vals []any, backward bool) (string, []any) {
+	var (
+		ors  []string
+		args []any
+	)
+	for i, o := range orders {
+		var ands []string
+		for j := 0; j < i; j++ {
+			ands = append(ands, orders[j].Column+" = ?")
+			args = append(args, vals[j])
+		}
+		op := ">"
+		if o.Desc != backward {
+			op = "<"
+		}
+		ands = append(ands, o.Column+" "+op+" ?")
+		args = append(args, vals[i])
+		ors = append(ors, "("+strings.Join(ands, " AND ")+")")
+	}
+	return "(" + strings.Join(ors, " OR ") + ")", args
+}
+
+// OrderBy は ORDER BY 句（キーワードを除く）を返します。backward の場合は向きを反転します。
+func OrderBy(orders []Order, backward bool) string {
+	parts := make([]string, 0, len(orders))
+	for _, o := range orders {
+		dir := "ASC"
+		if o.Desc != backward {
+			dir = "DESC"
+		}
+		parts = append(parts, o.Column+" "+dir)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Rebind は ? プレースホルダを $1, $2, ... に変換します（文字列リテラル内の ? は対象外）。
+func Rebind(q string) string {
+	var (
+		b       strings.Builder
+		n       int
+		inQuote bool
+	)
+	for _, r := range q {
+		switch {
+		case r == '\'':
+			inQuote = !inQuote
+		case r == '?' && !inQuote:
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
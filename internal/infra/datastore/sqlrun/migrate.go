@@ -0,0 +1,272 @@
+// Package sqlrun は各ドライバ共通のスキーマのマイグレーションとトランザクションの実行です。
+// ドライバごとの差（プレースホルダ・排他・再実行するエラー）は Migrator / TxRunner のフィールドで指定します。
+package sqlrun
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kawabatas/mini-web-app/internal/util/clock"
+)
+
+// ErrSchemaTooNew は DB のスキーマがバイナリの知っているバージョンより新しい場合のエラーです。
+// 新しいリビジョンが適用したスキーマ（SQLite ではそのスナップショット）を古いバイナリで開こうとした場合に発生します。
+var ErrSchemaTooNew = errors.New("database schema is newer than this binary")
+
+// ErrChecksumMismatch は適用済みマイグレーションの内容が変更されている場合のエラーです。
+var ErrChecksumMismatch = errors.New("applied migration checksum mismatch")
+
+// Migration は 1 ステップ分のスキーマ変更です。
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string
+	Checksum string // Up SQL の sha256（hex）
+}
+
+// Migrator は FS の migrations/ 配下の SQL ファイルを schema_migrations テーブルで管理して適用します。
+// ファイル名は <version>_<name>.up.sql / <version>_<name>.down.sql 形式（version は 1 始まりの連番）。
+type Migrator struct {
+	FS fs.FS
+	// Rebind は ? プレースホルダをドライバの形式に変換します（nil ならそのまま。PostgreSQL は sqlq.Rebind）。
+	Rebind func(q string) string
+	// TimestampType は schema_migrations.applied_at の型です（例: TIMESTAMP / TIMESTAMPTZ）。
+	TimestampType string
+	// Lock は適用のトランザクション内で最初に呼ばれ、複数プロセスの同時適用を排他します（nil なら排他しない）。
+	Lock func(ctx context.Context, tx *sql.Tx) error
+	// Seed は初期マイグレーション（version 1）を適用した際に、同じトランザクションで最後に実行する SQL です（空なら何もしない）。
+	// 初期データは新しい DB にのみ投入し、適用済みの DB ではデータを全て削除しても再投入しません。
+	Seed string
+}
+
+// Migrations は埋め込まれたマイグレーションを version 昇順で返します。
+func (m Migrator) Migrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(m.FS, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int]*Migration{}
+	for _, e := range entries {
+		file := e.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(file, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(file, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+		stem := strings.TrimSuffix(file, "."+direction+".sql")
+		num, name, ok := strings.Cut(stem, "_")
+		if !ok {
+			return nil, fmt.Errorf("migration %s: invalid file name", file)
+		}
+		v, err := strconv.Atoi(num)
+		if err != nil || v <= 0 {
+			return nil, fmt.Errorf("migration %s: invalid version", file)
+		}
+		body, err := fs.ReadFile(m.FS, path.Join("migrations", file))
+		if err != nil {
+			return nil, err
+		}
+		mg := byVersion[v]
+		if mg == nil {
+			mg = &Migration{Version: v, Name: name}
+			byVersion[v] = mg
+		} else if mg.Name != name {
+			return nil, fmt.Errorf("migration %d: name mismatch (%s / %s)", v, mg.Name, name)
+		}
+		if direction == "up" {
+			mg.Up = string(body)
+			sum := sha256.Sum256(body)
+			mg.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			mg.Down = string(body)
+		}
+	}
+	out := make([]Migration, 0, len(byVersion))
+	for _, mg := range byVersion {
+		if mg.Up == "" {
+			return nil, fmt.Errorf("migration %d: missing up file", mg.Version)
+		}
+		out = append(out, *mg)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	for i, mg := range out {
+		if mg.Version != i+1 {
+			return nil, fmt.Errorf("migration versions must be sequential: expected %d, got %d", i+1, mg.Version)
+		}
+	}
+	return out, nil
+}
+
+// LatestSchemaVersion はバイナリが知っている最新のスキーマバージョンです。
+func (m Migrator) LatestSchemaVersion() int {
+	ms, err := m.Migrations()
+	if err != nil || len(ms) == 0 {
+		return 0
+	}
+	return ms[len(ms)-1].Version
+}
+
+// SchemaVersion は DB に適用済みの最新バージョンを返します（未管理の DB は 0）。
+func (m Migrator) SchemaVersion(ctx context.Context, db *sql.DB) (int, error) {
+	if err := m.ensureMigrationsTable(ctx, db); err != nil {
+		return 0, err
+	}
+	var v int
+	if err := db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&v); err != nil {
+		return 0, err
+	}
+	return v, nil
+}
+
+// Migrate は未適用のマイグレーションを 1 トランザクションで最新まで適用します。
+func (m Migrator) Migrate(ctx context.Context, db *sql.DB) error {
+	return m.MigrateTo(ctx, db, m.LatestSchemaVersion())
+}
+
+// MigrateTo は target バージョンまで up / down を 1 トランザクションで適用します。
+//
+// - 適用済みステップはチェックサムを検証し、内容が変わっていればエラーにします。
+// - DB のバージョンがバイナリの最新より新しい場合は ErrSchemaTooNew を返し、起動を拒否します。
+func (m Migrator) MigrateTo(ctx context.Context, db *sql.DB, target int) error {
+	ms, err := m.Migrations()
+	if err != nil {
+		return fmt.Errorf("load migrations: %w", err)
+	}
+	if target < 0 || target > len(ms) {
+		return fmt.Errorf("migrate: unknown target version %d (latest %d)", target, len(ms))
+	}
+	if err := m.ensureMigrationsTable(ctx, db); err != nil {
+		return err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if m.Lock != nil {
+		if err := m.Lock(ctx, tx); err != nil {
+			return fmt.Errorf("migrate: lock: %w", err)
+		}
+	}
+
+	applied, err := appliedMigrations(ctx, tx)
+	if err != nil {
+		return err
+	}
+	current := 0
+	for v := range applied {
+		current = max(current, v)
+	}
+	if current > len(ms) {
+		return fmt.Errorf("%w: db=%d binary=%d", ErrSchemaTooNew, current, len(ms))
+	}
+	for _, mg := range ms[:current] {
+		sum, ok := applied[mg.Version]
+		if !ok {
+			return fmt.Errorf("migrate: version %d is missing in schema_migrations", mg.Version)
+		}
+		if sum != mg.Checksum {
+			return fmt.Errorf("%w: version %d (%s)", ErrChecksumMismatch, mg.Version, mg.Name)
+		}
+	}
+
+	switch {
+	case current < target:
+		for _, mg := range ms[current:target] {
+			if _, err := tx.ExecContext(ctx, mg.Up); err != nil {
+				return fmt.Errorf("migrate up %d_%s: %w", mg.Version, mg.Name, err)
+			}
+			if _, err := tx.ExecContext(ctx,
+				m.rebind(`INSERT INTO schema_migrations(version, name, checksum, applied_at) VALUES (?, ?, ?, ?)`),
+				mg.Version, mg.Name, mg.Checksum, clock.UTCNow(),
+			); err != nil {
+				return err
+			}
+			slog.InfoContext(ctx, "migration applied", slog.Int("version", mg.Version), slog.String("name", mg.Name))
+		}
+		if current == 0 && m.Seed != "" {
+			if _, err := tx.ExecContext(ctx, m.Seed); err != nil {
+				return fmt.Errorf("seed: %w", err)
+			}
+			slog.InfoContext(ctx, "initial data seeded")
+		}
+	case current > target:
+		for i := current - 1; i >= target; i-- {
+			mg := ms[i]
+			if mg.Down == "" {
+				return fmt.Errorf("migrate down %d_%s: down file not found", mg.Version, mg.Name)
+			}
+			if _, err := tx.ExecContext(ctx, mg.Down); err != nil {
+				return fmt.Errorf("migrate down %d_%s: %w", mg.Version, mg.Name, err)
+			}
+			if _, err := tx.ExecContext(ctx, m.rebind(`DELETE FROM schema_migrations WHERE version = ?`), mg.Version); err != nil {
+				return err
+			}
+			slog.InfoContext(ctx, "migration reverted", slog.Int("version", mg.Version), slog.String("name", mg.Name))
+		}
+	default:
+		return nil
+	}
+	return tx.Commit()
+}
+
+func (m Migrator) rebind(q string) string {
+	if m.Rebind == nil {
+		return q
+	}
+	return m.Rebind(q)
+}
+
+func (m Migrator) ensureMigrationsTable(ctx context.Context, db *sql.DB) error {
+	ts := m.TimestampType
+	if ts == "" {
+		ts = "TIMESTAMP"
+	}
+	if _, err := db.ExecContext(ctx, `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+  version INTEGER PRIMARY KEY,
+  name TEXT NOT NULL,
+  checksum TEXT NOT NULL,
+  applied_at `+ts+` NOT NULL
+);
+`); err != nil {
+		return fmt.Errorf("init schema_migrations: %w", err)
+	}
+	return nil
+}
+
+func appliedMigrations(ctx context.Context, tx *sql.Tx) (map[int]string, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT version, checksum FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[int]string{}
+	for rows.Next() {
+		var (
+			v   int
+			sum string
+		)
+		if err := rows.Scan(&v, &sum); err != nil {
+			return nil, err
+		}
+		out[v] = sum
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,237 @@
+package sqlrun
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+
+	_ "modernc.org/sqlite"
+)
+
+var memSeq atomic.Int64
+
+func openMemDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", fmt.Sprintf("file:sqlrun-%d?mode=memory&cache=shared", memSeq.Add(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+func testMigrations() fstest.MapFS {
+	return fstest.MapFS{
+		"migrations/0001_items.up.sql":        {Data: []byte(`CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT NOT NULL);`)},
+		"migrations/0001_items.down.sql":      {Data: []byte(`DROP TABLE items;`)},
+		"migrations/0002_tags.up.sql":         {Data: []byte(`CREATE TABLE tags (id INTEGER PRIMARY KEY);`)},
+		"migrations/0002_tags.down.sql":       {Data: []byte(`DROP TABLE tags;`)},
+		"migrations/README.md":                {Data: []byte(`ignored`)},
+		"migrations/0003_note.up.sql":         {Data: []byte(`ALTER TABLE items ADD COLUMN note TEXT;`)},
+		"migrations/0003_note.down.sql":       {Data: []byte(`ALTER TABLE items DROP COLUMN note;`)},
+		"migrations/unrelated/0009_x.sql":     {Data: []byte(`-- not a migration`)},
+		"migrations/0004_seed.up.sql":         {Data: []byte(`INSERT INTO items(name) VALUES ('a');`)},
+		"migrations/0004_seed.down.sql":       {Data: []byte(`DELETE FROM items;`)},
+		"migrations/0005_index.up.sql":        {Data: []byte(`CREATE INDEX items_name_idx ON items(name);`)},
+		"migrations/0005_index.down.sql":      {Data: []byte(`DROP INDEX items_name_idx;`)},
+		"migrations/0006_no_down.up.sql":      {Data: []byte(`CREATE TABLE logs (id INTEGER PRIMARY KEY);`)},
+		"migrations/0007_checkpoint.up.sql":   {Data: []byte(`SELECT 1;`)},
+		"migrations/0007_checkpoint.down.sql": {Data: []byte(`SELECT 1;`)},
+	}
+}
+
+func TestMigrator_UpAndDown(t *testing.T) {
+	ctx := context.Background()
+	db := openMemDB(t)
+	m := Migrator{FS: testMigrations()}
+
+	if got := m.LatestSchemaVersion(); got != 7 {
+		t.Fatalf("LatestSchemaVersion = %d, want 7", got)
+	}
+	if err := m.Migrate(ctx, db); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if v, err := m.SchemaVersion(ctx, db); err != nil || v != 7 {
+		t.Fatalf("SchemaVersion = %d, %v; want 7", v, err)
+	}
+	// 2 回目は何もしない
+	if err := m.Migrate(ctx, db); err != nil {
+		t.Fatalf("Migrate again: %v", err)
+	}
+
+	// down ファイルの無いステップ（6）をまたいで戻すと、7 の down も含めて 1 トランザクションごと失敗する
+	if err := m.MigrateTo(ctx, db, 5); err == nil {
+		t.Fatal("MigrateTo(5) succeeded without a down file")
+	}
+	if v, _ := m.SchemaVersion(ctx, db); v != 7 {
+		t.Fatalf("SchemaVersion after failed down = %d, want 7 (rolled back)", v)
+	}
+	if err := m.MigrateTo(ctx, db, 6); err != nil {
+		t.Fatalf("MigrateTo(6): %v", err)
+	}
+	if v, _ := m.SchemaVersion(ctx, db); v != 6 {
+		t.Fatalf("SchemaVersion = %d, want 6", v)
+	}
+}
+
+func TestMigrator_DownToZero(t *testing.T) {
+	ctx := context.Background()
+	db := openMemDB(t)
+	fsys := testMigrations()
+	delete(fsys, "migrations/0006_no_down.up.sql")
+	delete(fsys, "migrations/0007_checkpoint.up.sql")
+	delete(fsys, "migrations/0007_checkpoint.down.sql")
+	m := Migrator{FS: fsys}
+
+	if err := m.Migrate(ctx, db); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	var n int
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM items`).Scan(&n); err != nil || n != 1 {
+		t.Fatalf("items = %d, %v; want 1", n, err)
+	}
+	if err := m.MigrateTo(ctx, db, 0); err != nil {
+		t.Fatalf("MigrateTo(0): %v", err)
+	}
+	if v, _ := m.SchemaVersion(ctx, db); v != 0 {
+		t.Fatalf("SchemaVersion = %d, want 0", v)
+	}
+	if _, err := db.ExecContext(ctx, `SELECT 1 FROM items`); err == nil {
+		t.Fatal("items still exists after migrating down to 0")
+	}
+}
+
+func TestMigrator_Seed(t *testing.T) {
+	ctx := context.Background()
+	const seed = `INSERT INTO items(name) VALUES ('seed')`
+	for name, tc := range map[string]struct {
+		// prepare は Seed を指定した Migrate の前に DB を用意します
+		prepare   func(t *testing.T, db *sql.DB)
+		wantSeeds int
+	}{
+		"new database": {prepare: func(t *testing.T, db *sql.DB) {}, wantSeeds: 1},
+		"emptied database is not reseeded": {
+			prepare: func(t *testing.T, db *sql.DB) {
+				if err := (Migrator{FS: testMigrations()}).MigrateTo(ctx, db, 3); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := db.ExecContext(ctx, `DELETE FROM items`); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		"failed seed is retried with the initial migration": {
+			prepare: func(t *testing.T, db *sql.DB) {
+				m := Migrator{FS: testMigrations(), Seed: `INSERT INTO missing(name) VALUES ('seed')`}
+				if err := m.Migrate(ctx, db); err == nil {
+					t.Fatal("Migrate with a failing seed succeeded")
+				}
+				if v, _ := m.SchemaVersion(ctx, db); v != 0 {
+					t.Fatalf("SchemaVersion after a failed seed = %d, want 0 (rolled back)", v)
+				}
+			},
+			wantSeeds: 1,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			db := openMemDB(t)
+			tc.prepare(t, db)
+			m := Migrator{FS: testMigrations(), Seed: seed}
+			// 2 回目は何もしない
+			for i := 0; i < 2; i++ {
+				if err := m.Migrate(ctx, db); err != nil {
+					t.Fatalf("Migrate: %v", err)
+				}
+			}
+			var n int
+			if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM items WHERE name = 'seed'`).Scan(&n); err != nil || n != tc.wantSeeds {
+				t.Fatalf("seeded items = %d, %v; want %d", n, err, tc.wantSeeds)
+			}
+		})
+	}
+}
+
+func TestMigrator_ChecksumMismatch(t *testing.T) {
+	ctx := context.Background()
+	db := openMemDB(t)
+	fsys := testMigrations()
+	if err := (Migrator{FS: fsys}).Migrate(ctx, db); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	fsys["migrations/0002_tags.up.sql"] = &fstest.MapFile{Data: []byte(`CREATE TABLE tags (id INTEGER PRIMARY KEY, x TEXT);`)}
+	err := Migrator{FS: fsys}.Migrate(ctx, db)
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("Migrate after edit = %v, want ErrChecksumMismatch", err)
+	}
+}
+
+func TestMigrator_SchemaTooNew(t *testing.T) {
+	ctx := context.Background()
+	db := openMemDB(t)
+	fsys := testMigrations()
+	if err := (Migrator{FS: fsys}).Migrate(ctx, db); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	delete(fsys, "migrations/0007_checkpoint.up.sql")
+	delete(fsys, "migrations/0007_checkpoint.down.sql")
+	err := Migrator{FS: fsys}.Migrate(ctx, db)
+	if !errors.Is(err, ErrSchemaTooNew) {
+		t.Fatalf("Migrate with an older binary = %v, want ErrSchemaTooNew", err)
+	}
+}
+
+func TestMigrator_InvalidFiles(t *testing.T) {
+	for name, fsys := range map[string]fstest.MapFS{
+		"gap": {
+			"migrations/0001_a.up.sql": {Data: []byte(`SELECT 1;`)},
+			"migrations/0003_c.up.sql": {Data: []byte(`SELECT 1;`)},
+		},
+		"missing up": {
+			"migrations/0001_a.down.sql": {Data: []byte(`SELECT 1;`)},
+		},
+		"name mismatch": {
+			"migrations/0001_a.up.sql":   {Data: []byte(`SELECT 1;`)},
+			"migrations/0001_b.down.sql": {Data: []byte(`SELECT 1;`)},
+		},
+		"bad version": {
+			"migrations/x_a.up.sql": {Data: []byte(`SELECT 1;`)},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := (Migrator{FS: fsys}).Migrations(); err == nil {
+				t.Fatal("Migrations succeeded")
+			}
+		})
+	}
+}
+
+func TestMigrator_LockAndRebind(t *testing.T) {
+	ctx := context.Background()
+	db := openMemDB(t)
+	var locks, rebinds int
+	m := Migrator{
+		FS:     testMigrations(),
+		Rebind: func(q string) string { rebinds++; return q },
+		Lock: func(ctx context.Context, tx *sql.Tx) error {
+			locks++
+			return nil
+		},
+	}
+	if err := m.Migrate(ctx, db); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if locks != 1 || rebinds != 7 {
+		t.Fatalf("locks = %d, rebinds = %d; want 1, 7", locks, rebinds)
+	}
+
+	lockErr := errors.New("lock timeout")
+	m.Lock = func(context.Context, *sql.Tx) error { return lockErr }
+	if err := m.MigrateTo(ctx, db, 6); !errors.Is(err, lockErr) {
+		t.Fatalf("MigrateTo with failing lock = %v, want %v", err, lockErr)
+	}
+}
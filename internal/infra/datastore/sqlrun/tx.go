@@ -0,0 +1,73 @@
+package sqlrun
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// TxRunner は fn を 1 トランザクションとして実行し、再実行で解消し得るエラーの場合は fn ごと再実行します。
+type TxRunner struct {
+	// Retryable は再実行するエラー（SQLITE_BUSY、PostgreSQL の直列化失敗など）を判定します。
+	Retryable func(err error) bool
+	// MaxRetries は最大の実行回数です（0 なら 3）。
+	MaxRetries int
+	// Backoff は再実行までの待機の単位です（n 回目の失敗後に n 倍待つ。0 なら 100ms）。
+	Backoff time.Duration
+}
+
+// Run は db 上で fn を 1 トランザクションとして実行します。
+//
+//   - fn が nil を返せばコミット、エラーを返すか panic した場合はロールバックします（panic は再送出）。
+//   - BEGIN / fn / COMMIT のいずれかが Retryable なエラーの場合は、短いバックオフ付きで fn ごと再実行します。
+//     そのため fn は再実行されても問題ない（DB 以外に副作用を持たない）ように書くこと。
+func (r TxRunner) Run(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	maxRetries, base := r.MaxRetries, r.Backoff
+	if maxRetries <= 0 {
+		maxRetries = 3
+	}
+	if base <= 0 {
+		base = 100 * time.Millisecond
+	}
+	var lastErr error
+	for i := 0; i < maxRetries; i++ {
+		err := runOnce(ctx, db, fn)
+		if err == nil || r.Retryable == nil || !r.Retryable(err) {
+			return err
+		}
+		lastErr = err
+		backoff := base * time.Duration(i+1)
+		slog.WarnContext(ctx, "tx: retryable error, retrying", slog.Int("attempt", i+1), slog.Int("sleep_ms", int(backoff.Milliseconds())), slog.Any("error", err))
+		t := time.NewTimer(backoff)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		}
+	}
+	return fmt.Errorf("tx: all retries failed: %w", lastErr)
+}
+
+func runOnce(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) (err error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback()
+			panic(p)
+		}
+	}()
+	if err := fn(tx); err != nil {
+		if rerr := tx.Rollback(); rerr != nil && !errors.Is(rerr, sql.ErrTxDone) {
+			slog.WarnContext(ctx, "tx: rollback error", slog.Any("error", rerr))
+		}
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,121 @@
+package sqlrun
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+)
+
+var errRetryable = errors.New("retryable")
+
+func newItemsDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db := openMemDB(t)
+	if _, err := db.Exec(`CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT NOT NULL)`); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func countItems(t *testing.T, db *sql.DB) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM items`).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestTxRunner_RetriesRetryableErrors(t *testing.T) {
+	db := newItemsDB(t)
+	r := TxRunner{Retryable: func(err error) bool { return errors.Is(err, errRetryable) }, Backoff: time.Millisecond}
+	calls := 0
+	err := r.Run(context.Background(), db, func(tx *sql.Tx) error {
+		calls++
+		if _, err := tx.Exec(`INSERT INTO items(name) VALUES ('a')`); err != nil {
+			return err
+		}
+		if calls < 3 {
+			return errRetryable
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if calls != 3 {
+		t.Fatalf("calls = %d, want 3", calls)
+	}
+	// 失敗した試行の INSERT はロールバックされている
+	if n := countItems(t, db); n != 1 {
+		t.Fatalf("items = %d, want 1", n)
+	}
+}
+
+func TestTxRunner_GivesUpAfterMaxRetries(t *testing.T) {
+	db := newItemsDB(t)
+	r := TxRunner{Retryable: func(err error) bool { return errors.Is(err, errRetryable) }, MaxRetries: 2, Backoff: time.Millisecond}
+	calls := 0
+	err := r.Run(context.Background(), db, func(tx *sql.Tx) error {
+		calls++
+		return errRetryable
+	})
+	if !errors.Is(err, errRetryable) || calls != 2 {
+		t.Fatalf("Run = %v after %d calls, want errRetryable after 2", err, calls)
+	}
+}
+
+func TestTxRunner_DoesNotRetryOtherErrors(t *testing.T) {
+	db := newItemsDB(t)
+	r := TxRunner{Retryable: func(err error) bool { return errors.Is(err, errRetryable) }, Backoff: time.Millisecond}
+	boom := errors.New("boom")
+	calls := 0
+	err := r.Run(context.Background(), db, func(tx *sql.Tx) error {
+		calls++
+		if _, err := tx.Exec(`INSERT INTO items(name) VALUES ('a')`); err != nil {
+			return err
+		}
+		return boom
+	})
+	if !errors.Is(err, boom) || calls != 1 {
+		t.Fatalf("Run = %v after %d calls, want boom after 1", err, calls)
+	}
+	if n := countItems(t, db); n != 0 {
+		t.Fatalf("items = %d, want 0 (rolled back)", n)
+	}
+}
+
+func TestTxRunner_RollsBackOnPanic(t *testing.T) {
+	db := newItemsDB(t)
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("panic was not propagated")
+			}
+		}()
+		_ = TxRunner{}.Run(context.Background(), db, func(tx *sql.Tx) error {
+			if _, err := tx.Exec(`INSERT INTO items(name) VALUES ('a')`); err != nil {
+				return err
+			}
+			panic("boom")
+		})
+	}()
+	if n := countItems(t, db); n != 0 {
+		t.Fatalf("items = %d, want 0 (rolled back)", n)
+	}
+}
+
+func TestTxRunner_StopsWhenContextIsDone(t *testing.T) {
+	db := newItemsDB(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	r := TxRunner{Retryable: func(error) bool { return true }, Backoff: time.Hour}
+	err := r.Run(ctx, db, func(tx *sql.Tx) error {
+		cancel()
+		return errRetryable
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Run = %v, want context.Canceled", err)
+	}
+}
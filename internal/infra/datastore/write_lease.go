@@ -0,0 +1,308 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/kawabatas/mini-web-app/internal/domain/model"
+	"github.com/kawabatas/mini-web-app/internal/domain/repository"
+	sqlitedriver "github.com/kawabatas/mini-web-app/internal/infra/datastore/sqlite"
+)
+
+// reloadTables は他のインスタンスが公開した current に追いつく際に置き換えるテーブルです（すべての業務データと履歴）。
+var reloadTables = []string{"singers", "audit_log", "outbox"}
+
+// leaseTimeout は 1 回のリースの取得・延長（と current への追いつき・引き継ぎ）の上限です。
+const leaseTimeout = time.Minute
+
+// handoverPoll は引き継ぎを依頼してからリースの取得を試みる間隔です（通常は延長の間隔）。
+const handoverPoll = time.Second
+
+// internal interface for strategies that track the generation of current (to hand over and catch up between instances)
+type currentTracker interface {
+	PublishedGeneration() int64
+	SyncCurrent(ctx context.Context, dest string, want int64, apply func(path string) error) (bool, error)
+}
+
+// publishedGeneration は最後に読んだ・公開した current の世代番号です（不明なら 0）。
+func (s *sqliteStore) publishedGeneration() int64 {
+	if t, ok := any(s.strategy).(currentTracker); ok {
+		return t.PublishedGeneration()
+	}
+	return 0
+}
+
+// leaseHeld は書き込みを受け付けているかを返します（期限切れの延長は試みない）。
+// 書き込みリースを使う構成では、リースを保持し、かつ取得後に最新の current に追いついている間だけ true です。
+func (s *sqliteStore) leaseHeld() bool {
+	if s.lease == nil {
+		return true
+	}
+	return s.leaseReady.Load() && s.lease.Held()
+}
+
+// keepWriteLease はリースを保持していれば延長して引き継ぎの依頼に応じ、保持していなければ取得を試みます（ctx の終了まで）。
+func (s *sqliteStore) keepWriteLease(ctx context.Context, done chan struct{}) {
+	defer close(done)
+	timer := time.NewTimer(s.leaseInterval())
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+		ctxLease, cancel := context.WithTimeout(ctx, leaseTimeout)
+		if s.leaseReady.Load() {
+			s.renewMu.Lock()
+			err := s.renewLease(ctxLease)
+			s.renewMu.Unlock()
+			if err == nil {
+				s.answerHandover(ctxLease)
+			}
+		} else {
+			s.acquireWriteLease(ctxLease)
+		}
+		cancel()
+		timer.Reset(s.leaseInterval())
+	}
+}
+
+// renewLease はリースを延長します（renewMu を保持して呼ぶこと。同時に延長すると互いの世代番号の前提が外れる）。
+func (s *sqliteStore) renewLease(ctx context.Context) error {
+	err := s.lease.Renew(ctx)
+	switch {
+	case errors.Is(err, sqlitedriver.ErrLeaseLost):
+		s.leaseReady.Store(false)
+		slog.ErrorContext(ctx, "WRITE LEASE LOST: another instance took over; running read-only", slog.Any("error", err))
+	case err != nil:
+		// 期限が近づくまでは書き込みを続け、次の延長で再試行する
+		slog.WarnContext(ctx, "renew write lease failed", slog.Any("error", err))
+	}
+	return err
+}
+
+// Writable は書き込みを受け付けているかを返します。延長が止まって（リクエストの無い間に CPU が割り当てられないなど）
+// 保持の期限を過ぎていれば、その場で延長してから判定します。他のインスタンスに取られていなければ延長でき、書き込みを続けられます。
+func (s *sqliteStore) Writable(ctx context.Context) bool {
+	if s.leaseHeld() {
+		return true
+	}
+	if s.lease == nil || !s.leaseReady.Load() {
+		return false
+	}
+	s.renewMu.Lock()
+	defer s.renewMu.Unlock()
+	if !s.lease.Held() {
+		ctxLease, cancel := context.WithTimeout(ctx, leaseTimeout)
+		defer cancel()
+		if err := s.renewLease(ctxLease); err == nil {
+			slog.InfoContext(ctx, "write lease renewed on the write path after renewals stalled")
+		}
+	}
+	return s.leaseHeld()
+}
+
+func (s *sqliteStore) leaseInterval() time.Duration {
+	if s.awaiting.Load() {
+		return handoverPoll
+	}
+	return s.lease.RenewInterval()
+}
+
+// answerHandover は引き継ぎの依頼があれば、書き込みを止めて最後のスナップショットを公開し、依頼したインスタンスにリースを渡します。
+// スナップショットを公開できなければ書き込みを再開し、次の延長の際に再試行します。
+func (s *sqliteStore) answerHandover(ctx context.Context) {
+	to, ok, err := s.lease.PendingHandover(ctx)
+	if err != nil {
+		slog.WarnContext(ctx, "check write lease handover failed", slog.Any("error", err))
+		return
+	}
+	if !ok {
+		return
+	}
+	slog.InfoContext(ctx, "write lease handover requested; stopping writes", slog.String("to", to))
+	s.leaseReady.Store(false)
+	// 実行中のトランザクションが終わるのを待つ（以降のトランザクションは ErrReadOnly）
+	s.writeMu.Lock()
+	s.writeMu.Unlock()
+	if err := s.snapshot(ctx); err != nil {
+		s.leaseReady.Store(true)
+		slog.ErrorContext(ctx, "final snapshot for handover failed; resuming writes", slog.Any("error", err))
+		return
+	}
+	published := s.publishedGeneration()
+	if err := s.lease.HandOver(ctx, to, published); err != nil {
+		// 書き込みは止めたまま（リースを取り直すまで読み取り専用）
+		slog.ErrorContext(ctx, "hand over write lease failed", slog.Any("error", err))
+		return
+	}
+	slog.InfoContext(ctx, "write lease handed over; running read-only", slog.String("to", to), slog.Int64("published_generation", published))
+}
+
+// acquireWriteLease はリースの取得を試み、取得できれば他のインスタンスが公開した current に追いついてから書き込みを受け付けます。
+func (s *sqliteStore) acquireWriteLease(ctx context.Context) {
+	err := s.lease.Acquire(ctx)
+	if errors.Is(err, sqlitedriver.ErrLeaseHeld) {
+		slog.DebugContext(ctx, "write lease is held by another instance", slog.Any("error", err))
+		return
+	}
+	if err != nil {
+		slog.WarnContext(ctx, "acquire write lease failed", slog.Any("error", err))
+		return
+	}
+	if err := s.catchUp(ctx, s.lease.Inherited()); err != nil {
+		slog.ErrorContext(ctx, "catch up with current snapshot failed; releasing write lease", slog.Any("error", err))
+		if err := s.lease.Release(ctx, s.publishedGeneration()); err != nil {
+			slog.ErrorContext(ctx, "release write lease failed", slog.Any("error", err))
+		}
+		return
+	}
+	s.startReplication(ctx)
+	s.awaiting.Store(false)
+	s.leaseReady.Store(true)
+	slog.InfoContext(ctx, "write lease acquired; accepting writes", slog.String("holder", s.lease.Holder))
+}
+
+// catchUp は読み取り専用の間に他のインスタンスが current を置き換えていれば、その内容で DB を置き換えます。
+// want は前の保持者が最後に公開した世代番号で、0 でなければ current がその世代であることを確認します。
+// 置き換えは通常の書き込みとして 1 トランザクションで行うため、読み取り中のリクエストは前後どちらかの内容を見ます。
+func (s *sqliteStore) catchUp(ctx context.Context, want int64) error {
+	tracker, ok := any(s.strategy).(currentTracker)
+	if !ok {
+		return nil
+	}
+	tmp := s.dbPath + ".sync"
+	defer os.Remove(tmp)
+	changed, err := tracker.SyncCurrent(ctx, tmp, want, func(path string) error {
+		if err := sqlitedriver.PrepareSnapshot(ctx, path); err != nil {
+			return err
+		}
+		return sqlitedriver.RestoreTables(ctx, s.conns.Writer, path, reloadTables, func(*sql.Tx) error { return nil })
+	})
+	if err != nil || !changed {
+		return err
+	}
+	// 置き換えた内容は current と同じため、次の書き込みまでスナップショットを取らない
+	s.backupMu.Lock()
+	defer s.backupMu.Unlock()
+	mark, err := sqlitedriver.WriterChangeMark(ctx, s.conns.Writer)
+	if err != nil {
+		return err
+	}
+	s.published = mark
+	return nil
+}
+
+// startReplication は WAL の配送を始めます（書き込みリースの保持者のみ。2 回目以降は何もしない）。
+func (s *sqliteStore) startReplication(ctx context.Context) {
+	if s.replicating {
+		return
+	}
+	r, ok := any(s.strategy).(replicationCapable)
+	if !ok {
+		return
+	}
+	s.replicating = true
+	// 初回の配送に失敗しても続ける（以降の配送で再試行される）
+	if err := r.StartReplication(ctx, s.conns, s.dbPath); err != nil {
+		slog.ErrorContext(ctx, "wal replication start failed", slog.Any("error", err))
+	}
+}
+
+// guardWrite は書き込みを受け付けている間だけ fn を実行し、そうでなければ repository.ErrReadOnly を返します。
+// WithTx の外からの書き込み用で、引き継ぎの際は WithTx と同様に実行中の fn が終わるのを待ちます。
+func (s *sqliteStore) guardWrite(ctx context.Context, fn func() error) error {
+	s.writeMu.RLock()
+	defer s.writeMu.RUnlock()
+	if !s.Writable(ctx) {
+		return repository.ErrReadOnly
+	}
+	return fn()
+}
+
+// 以下は DataStore 本体（WithTx の外）のリポジトリの書き込みを guardWrite で制限するラッパーです。
+// 読み取りはリースを保持していなくてもそのまま行えます。
+
+type gatedSingerRepo struct {
+	repository.SingerRepository
+	guard func(ctx context.Context, fn func() error) error
+}
+
+func (r gatedSingerRepo) Create(ctx context.Context, s model.Singer) (out model.Singer, err error) {
+	err = r.guard(ctx, func() error {
+		out, err = r.SingerRepository.Create(ctx, s)
+		return err
+	})
+	return out, err
+}
+
+func (r gatedSingerRepo) Update(ctx context.Context, s model.Singer) (out model.Singer, err error) {
+	err = r.guard(ctx, func() error {
+		out, err = r.SingerRepository.Update(ctx, s)
+		return err
+	})
+	return out, err
+}
+
+func (r gatedSingerRepo) Delete(ctx context.Context, id, version int64) error {
+	return r.guard(ctx, func() error { return r.SingerRepository.Delete(ctx, id, version) })
+}
+
+func (r gatedSingerRepo) Restore(ctx context.Context, id int64) (out model.Singer, err error) {
+	err = r.guard(ctx, func() error {
+		out, err = r.SingerRepository.Restore(ctx, id)
+		return err
+	})
+	return out, err
+}
+
+func (r gatedSingerRepo) Purge(ctx context.Context, before time.Time) (n int64, err error) {
+	err = r.guard(ctx, func() error {
+		n, err = r.SingerRepository.Purge(ctx, before)
+		return err
+	})
+	return n, err
+}
+
+type gatedAuditRepo struct {
+	repository.AuditRepository
+	guard func(ctx context.Context, fn func() error) error
+}
+
+func (r gatedAuditRepo) Append(ctx context.Context, e model.AuditEntry) (out model.AuditEntry, err error) {
+	err = r.guard(ctx, func() error {
+		out, err = r.AuditRepository.Append(ctx, e)
+		return err
+	})
+	return out, err
+}
+
+type gatedOutboxRepo struct {
+	repository.OutboxRepository
+	guard func(ctx context.Context, fn func() error) error
+}
+
+func (r gatedOutboxRepo) Append(ctx context.Context, e model.OutboxEvent) error {
+	return r.guard(ctx, func() error { return r.OutboxRepository.Append(ctx, e) })
+}
+
+func (r gatedOutboxRepo) MarkDone(ctx context.Context, id int64, at time.Time) error {
+	return r.guard(ctx, func() error { return r.OutboxRepository.MarkDone(ctx, id, at) })
+}
+
+func (r gatedOutboxRepo) MarkFailed(ctx context.Context, id int64, errMsg string, next time.Time) error {
+	return r.guard(ctx, func() error { return r.OutboxRepository.MarkFailed(ctx, id, errMsg, next) })
+}
+
+func (r gatedOutboxRepo) DeleteDone(ctx context.Context, before time.Time) (n int64, err error) {
+	err = r.guard(ctx, func() error {
+		n, err = r.OutboxRepository.DeleteDone(ctx, before)
+		return err
+	})
+	return n, err
+}
@@ -0,0 +1,135 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kawabatas/mini-web-app/internal/domain/model"
+	"github.com/kawabatas/mini-web-app/internal/domain/repository"
+	sqlitedriver "github.com/kawabatas/mini-web-app/internal/infra/datastore/sqlite"
+	"github.com/kawabatas/mini-web-app/internal/infra/storage/local"
+)
+
+func TestSQLiteStore_ReadOnlyRepos(t *testing.T) {
+	ctx := context.Background()
+	ds, err := OpenMemory(ctx, func(ctx context.Context, tx Repositories) error {
+		_, err := tx.Singers().Create(ctx, model.Singer{Name: "Adele", Genre: "Soul", DebutYear: 2008})
+		return err
+	})
+	if err != nil {
+		t.Fatalf("OpenMemory: %v", err)
+	}
+	t.Cleanup(func() { _ = ds.Close(context.Background()) })
+	// 保持していないリース（他のインスタンスが書き込み中）
+	ds.(*sqliteStore).lease = &sqlitedriver.Lease{}
+
+	now := time.Now()
+	for name, write := range map[string]func() error{
+		"WithTx": func() error {
+			return ds.WithTx(ctx, func(tx Repositories) error { return nil })
+		},
+		"Singers.Create": func() error {
+			_, err := ds.Singers().Create(ctx, model.Singer{Name: "Beyonce", Genre: "R&B", DebutYear: 1997})
+			return err
+		},
+		"Singers.Update": func() error {
+			_, err := ds.Singers().Update(ctx, model.Singer{ID: 1, Name: "Adele", Genre: "Pop", DebutYear: 2008, Version: 1})
+			return err
+		},
+		"Singers.Delete":  func() error { return ds.Singers().Delete(ctx, 1, 1) },
+		"Singers.Restore": func() error { _, err := ds.Singers().Restore(ctx, 1); return err },
+		"Singers.Purge":   func() error { _, err := ds.Singers().Purge(ctx, now); return err },
+		"Audit.Append": func() error {
+			_, err := ds.Audit().Append(ctx, model.AuditEntry{Entity: "singer", EntityID: 1, Action: "update"})
+			return err
+		},
+		"Outbox.Append":     func() error { return ds.Outbox().Append(ctx, model.OutboxEvent{Type: "singer.updated"}) },
+		"Outbox.MarkDone":   func() error { return ds.Outbox().MarkDone(ctx, 1, now) },
+		"Outbox.MarkFailed": func() error { return ds.Outbox().MarkFailed(ctx, 1, "boom", now) },
+		"Outbox.DeleteDone": func() error { _, err := ds.Outbox().DeleteDone(ctx, now); return err },
+	} {
+		if err := write(); !errors.Is(err, repository.ErrReadOnly) {
+			t.Errorf("%s = %v, want ErrReadOnly", name, err)
+		}
+	}
+
+	// 読み取りはそのまま行える
+	got, err := ds.Singers().Get(ctx, 1)
+	if err != nil || got.Name != "Adele" || got.Version != 1 {
+		t.Fatalf("Get = %+v, %v; want the unchanged singer", got, err)
+	}
+	if _, err := ds.Outbox().Pending(ctx, now, 10); err != nil {
+		t.Fatalf("Pending: %v", err)
+	}
+}
+
+func TestSQLiteStore_RenewsStalledLeaseOnWrite(t *testing.T) {
+	ctx := context.Background()
+	ds, err := OpenMemory(ctx, nil)
+	if err != nil {
+		t.Fatalf("OpenMemory: %v", err)
+	}
+	t.Cleanup(func() { _ = ds.Close(context.Background()) })
+	bucket := t.TempDir()
+	const ttl = 300 * time.Millisecond
+	lease := &sqlitedriver.Lease{ObjectStore: local.FS{}, Bucket: bucket, Holder: "a", TTL: ttl}
+	if err := lease.Acquire(ctx); err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	s := ds.(*sqliteStore)
+	s.lease = lease
+	s.leaseReady.Store(true)
+	create := func() error {
+		_, err := ds.Singers().Create(ctx, model.Singer{Name: "Adele", Genre: "Soul", DebutYear: 2008})
+		return err
+	}
+
+	// 延長が止まって（CPU が割り当てられない間など）保持の期限を過ぎても、他に取られていなければ書き込み時に延長する
+	time.Sleep(ttl)
+	if lease.Held() {
+		t.Fatal("lease is still held after its validity")
+	}
+	if err := create(); err != nil {
+		t.Fatalf("Create after stalled renewals = %v, want nil", err)
+	}
+	if !lease.Held() {
+		t.Fatal("lease was not renewed on the write path")
+	}
+
+	// 期限切れの間に他のインスタンスが取得していれば、延長できずに読み取り専用になる
+	time.Sleep(ttl + 50*time.Millisecond)
+	other := &sqlitedriver.Lease{ObjectStore: local.FS{}, Bucket: bucket, Holder: "b", TTL: time.Minute}
+	if err := other.Acquire(ctx); err != nil {
+		t.Fatalf("Acquire by another instance: %v", err)
+	}
+	if err := ds.WithTx(ctx, func(tx Repositories) error { return nil }); !errors.Is(err, repository.ErrReadOnly) {
+		t.Fatalf("WithTx after the lease was taken = %v, want ErrReadOnly", err)
+	}
+	if s.leaseReady.Load() {
+		t.Fatal("leaseReady is still set after the lease was lost")
+	}
+}
+
+// failingStartup は起動時のスナップショットの取得に失敗する戦略です。
+type failingStartup struct{ NoopSnapshotStrategy }
+
+func (failingStartup) OnStartup(ctx context.Context, dbPath string) error {
+	return errors.New("download current failed")
+}
+
+func TestOpenSQLite_ReleasesLeaseOnStartupError(t *testing.T) {
+	ctx := context.Background()
+	t.Chdir(t.TempDir())
+	bucket := t.TempDir()
+	lease := &sqlitedriver.Lease{ObjectStore: local.FS{}, Bucket: bucket, Holder: "a", TTL: time.Minute}
+	if _, err := Open(ctx, Config{Driver: "sqlite", Strategy: failingStartup{}, Lease: lease}); err == nil {
+		t.Fatal("Open succeeded, want the startup error")
+	}
+	// 期限（1 分）を待たずに他のインスタンスが取得できる
+	other := &sqlitedriver.Lease{ObjectStore: local.FS{}, Bucket: bucket, Holder: "b", TTL: time.Minute}
+	if err := other.Acquire(ctx); err != nil {
+		t.Fatalf("Acquire by another instance after the failed open = %v, want nil", err)
+	}
+}
@@ -0,0 +1,241 @@
+// Package envelope はオブジェクトストレージに置くデータのクライアント側暗号化（エンベロープ暗号化）を提供します。
+//
+// データごとにランダムなデータ鍵（AES-256）で AES-256-GCM 暗号化し、データ鍵は鍵暗号化鍵（KEK）で
+// 同じく AES-256-GCM で包んで暗号文の先頭に付けます。ヘッダに KEK の ID を持つため、
+// 新しい KEK に切り替えた後も、古い KEK を Keyring に残しておけば過去のデータを復号できます。
+//
+// 形式: magic(8) | ヘッダ長(4, big endian) | ヘッダ(JSON) | 暗号文
+package envelope
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Algorithm は暗号化方式の名前です（マニフェストにも記録されます）。
+const Algorithm = "AES-256-GCM"
+
+var magic = []byte("MWAENC1\n")
+
+// maxHeaderSize はヘッダ長の上限です（壊れたデータで巨大な確保をしないため）。
+const maxHeaderSize = 4096
+
+// ErrUnknownKey は暗号文の KEK が Keyring に無いことを表します。
+var ErrUnknownKey = errors.New("envelope: unknown key encryption key")
+
+type header struct {
+	Algorithm  string `json:"alg"`
+	KeyID      string `json:"kek_id"`
+	WrappedKey []byte `json:"wrapped_key"` // KEK で暗号化したデータ鍵（nonce を前置）
+	Nonce      []byte `json:"nonce"`       // データ鍵による暗号化の nonce
+}
+
+// Keyring は ID 付きの KEK の集合です。暗号化には Active の KEK を使い、復号にはすべての KEK を使えます。
+type Keyring struct {
+	active string
+	keys   map[string][]byte
+}
+
+// NewKeyring は keys（ID → 32 バイトの鍵）から Keyring を作成します。active が空なら ids の先頭を使います。
+func NewKeyring(keys map[string][]byte, ids []string, active string) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("envelope: no key encryption keys")
+	}
+	for id, k := range keys {
+		if len(k) != 32 {
+			return nil, fmt.Errorf("envelope: key %q must be 32 bytes, got %d", id, len(k))
+		}
+	}
+	if active == "" && len(ids) > 0 {
+		active = ids[0]
+	}
+	if _, ok := keys[active]; !ok {
+		return nil, fmt.Errorf("envelope: active key %q is not configured", active)
+	}
+	return &Keyring{active: active, keys: keys}, nil
+}
+
+// ParseKeys は "id:base64鍵" をカンマまたは改行で区切った鍵の一覧を読み取ります（# 以降はコメント）。
+// 記述順の ID も返します。
+func ParseKeys(spec string) (map[string][]byte, []string, error) {
+	keys := map[string][]byte{}
+	var ids []string
+	for _, line := range strings.Split(spec, "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		for _, entry := range strings.Split(line, ",") {
+			entry = strings.TrimSpace(entry)
+			if entry == "" {
+				continue
+			}
+			id, enc, ok := strings.Cut(entry, ":")
+			id = strings.TrimSpace(id)
+			if !ok || id == "" {
+				return nil, nil, fmt.Errorf("envelope: invalid key entry (want id:base64)")
+			}
+			k, err := base64.StdEncoding.DecodeString(strings.TrimSpace(enc))
+			if err != nil {
+				return nil, nil, fmt.Errorf("envelope: key %q: %w", id, err)
+			}
+			if _, dup := keys[id]; dup {
+				return nil, nil, fmt.Errorf("envelope: duplicate key id %q", id)
+			}
+			keys[id] = k
+			ids = append(ids, id)
+		}
+	}
+	return keys, ids, nil
+}
+
+// LoadKeyring は鍵の一覧 spec とファイル path（どちらも空可）から Keyring を作成します。
+// どちらにも鍵が無ければ (nil, nil) を返します（暗号化しない）。
+func LoadKeyring(spec, path, active string) (*Keyring, error) {
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		spec = strings.Join([]string{spec, string(b)}, "\n")
+	}
+	keys, ids, err := ParseKeys(spec)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		if active != "" {
+			return nil, fmt.Errorf("envelope: active key %q is not configured", active)
+		}
+		return nil, nil
+	}
+	return NewKeyring(keys, ids, active)
+}
+
+// ActiveID は暗号化に使う KEK の ID です。
+func (k *Keyring) ActiveID() string { return k.active }
+
+// Encrypt は plaintext を新しいデータ鍵で暗号化します。aad は復号時に同じ値を渡す必要があります。
+func (k *Keyring) Encrypt(plaintext, aad []byte) ([]byte, error) {
+	dek := make([]byte, 32)
+	if _, err := rand.Read(dek); err != nil {
+		return nil, err
+	}
+	wrapped, err := seal(k.keys[k.active], nil, dek, []byte(k.active))
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, 12)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(dek)
+	if err != nil {
+		return nil, err
+	}
+	hdr, err := json.Marshal(header{Algorithm: Algorithm, KeyID: k.active, WrappedKey: wrapped, Nonce: nonce})
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, len(magic)+4+len(hdr)+len(plaintext)+gcm.Overhead())
+	out = append(out, magic...)
+	out = binary.BigEndian.AppendUint32(out, uint32(len(hdr)))
+	out = append(out, hdr...)
+	return gcm.Seal(out, nonce, plaintext, aad), nil
+}
+
+// Decrypt は Encrypt の出力を復号します。
+func (k *Keyring) Decrypt(blob, aad []byte) ([]byte, error) {
+	h, body, err := parse(blob)
+	if err != nil {
+		return nil, err
+	}
+	kek, ok := k.keys[h.KeyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, h.KeyID)
+	}
+	dek, err := open(kek, h.WrappedKey, []byte(h.KeyID))
+	if err != nil {
+		return nil, fmt.Errorf("envelope: unwrap data key: %w", err)
+	}
+	gcm, err := newGCM(dek)
+	if err != nil {
+		return nil, err
+	}
+	pt, err := gcm.Open(nil, h.Nonce, body, aad)
+	if err != nil {
+		return nil, fmt.Errorf("envelope: decrypt: %w", err)
+	}
+	return pt, nil
+}
+
+// IsEncrypted は blob が Encrypt の出力形式かを判定します。
+func IsEncrypted(blob []byte) bool { return bytes.HasPrefix(blob, magic) }
+
+// KeyID は暗号文の KEK の ID を返します。
+func KeyID(blob []byte) (string, error) {
+	h, _, err := parse(blob)
+	return h.KeyID, err
+}
+
+func parse(blob []byte) (header, []byte, error) {
+	var h header
+	if !IsEncrypted(blob) {
+		return h, nil, errors.New("envelope: not encrypted")
+	}
+	rest := blob[len(magic):]
+	if len(rest) < 4 {
+		return h, nil, errors.New("envelope: truncated header")
+	}
+	n := binary.BigEndian.Uint32(rest[:4])
+	if n > maxHeaderSize || int(n) > len(rest)-4 {
+		return h, nil, errors.New("envelope: invalid header length")
+	}
+	if err := json.Unmarshal(rest[4:4+n], &h); err != nil {
+		return h, nil, fmt.Errorf("envelope: parse header: %w", err)
+	}
+	if h.Algorithm != Algorithm {
+		return h, nil, fmt.Errorf("envelope: unsupported algorithm %q", h.Algorithm)
+	}
+	return h, rest[4+n:], nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal は key で plaintext を暗号化し、nonce を前置して dst に追加します。
+func seal(key, dst, plaintext, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	dst = append(dst, nonce...)
+	return gcm.Seal(dst, nonce, plaintext, aad), nil
+}
+
+// open は seal の出力を復号します。
+func open(key, sealed, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("envelope: sealed data too short")
+	}
+	return gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], aad)
+}
@@ -0,0 +1,229 @@
+package envelope
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testKey は id から決まる 32 バイトの鍵です。
+func testKey(id string) []byte { return []byte(strings.Repeat(id, 32)[:32]) }
+
+func newTestKeyring(t *testing.T, active string, ids ...string) *Keyring {
+	t.Helper()
+	keys := map[string][]byte{}
+	for _, id := range ids {
+		keys[id] = testKey(id)
+	}
+	kr, err := NewKeyring(keys, ids, active)
+	if err != nil {
+		t.Fatalf("NewKeyring: %v", err)
+	}
+	return kr
+}
+
+func TestKeyring_RoundTripAndRotation(t *testing.T) {
+	plaintext := []byte("snapshot body")
+	old := newTestKeyring(t, "k1", "k1")
+	blob, err := old.Encrypt(plaintext, []byte("aad"))
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	if !IsEncrypted(blob) || bytes.Contains(blob, plaintext) {
+		t.Fatal("blob is not an encrypted envelope")
+	}
+	if id, err := KeyID(blob); err != nil || id != "k1" {
+		t.Fatalf("KeyID = %q, %v; want k1", id, err)
+	}
+
+	// 新しい KEK に切り替えた後も、古い KEK を残していれば復号できる
+	rotated := newTestKeyring(t, "k2", "k1", "k2")
+	got, err := rotated.Decrypt(blob, []byte("aad"))
+	if err != nil || !bytes.Equal(got, plaintext) {
+		t.Fatalf("Decrypt after rotation = %q, %v", got, err)
+	}
+	blob2, err := rotated.Encrypt(plaintext, nil)
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	if id, _ := KeyID(blob2); id != "k2" {
+		t.Fatalf("KeyID after rotation = %q, want k2", id)
+	}
+	// 同じ平文でも毎回異なるデータ鍵・nonce で暗号化する
+	blob3, _ := rotated.Encrypt(plaintext, nil)
+	if bytes.Equal(blob2, blob3) {
+		t.Fatal("Encrypt is deterministic")
+	}
+}
+
+func TestKeyring_DecryptFailures(t *testing.T) {
+	kr := newTestKeyring(t, "k1", "k1")
+	blob, err := kr.Encrypt([]byte("snapshot body"), []byte("aad"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hdrLen := int(binary.BigEndian.Uint32(blob[len(magic):]))
+	for name, tc := range map[string]struct {
+		keyring *Keyring
+		blob    func() []byte
+		aad     string
+		wantErr error // nil なら何らかのエラー
+	}{
+		"unknown key": {
+			keyring: newTestKeyring(t, "k2", "k2"),
+			wantErr: ErrUnknownKey,
+		},
+		"same id with another key": {
+			keyring: func() *Keyring {
+				kr, _ := NewKeyring(map[string][]byte{"k1": testKey("x")}, []string{"k1"}, "")
+				return kr
+			}(),
+		},
+		"another aad": {aad: "other"},
+		"tampered ciphertext": {
+			blob: func() []byte {
+				b := bytes.Clone(blob)
+				b[len(b)-1] ^= 0xff
+				return b
+			},
+		},
+		"not encrypted": {blob: func() []byte { return []byte("plain sqlite file") }},
+		"truncated header": {
+			blob: func() []byte { return bytes.Clone(blob[:len(magic)+2]) },
+		},
+		"header length beyond the data": {
+			blob: func() []byte { return bytes.Clone(blob[:len(magic)+4+hdrLen/2]) },
+		},
+		"unsupported algorithm": {
+			blob: func() []byte {
+				return bytes.Replace(bytes.Clone(blob), []byte(Algorithm), []byte("AES-128-CBC"), 1)
+			},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			k, b, aad := kr, blob, "aad"
+			if tc.keyring != nil {
+				k = tc.keyring
+			}
+			if tc.blob != nil {
+				b = tc.blob()
+			}
+			if tc.aad != "" {
+				aad = tc.aad
+			}
+			_, err := k.Decrypt(b, []byte(aad))
+			if err == nil {
+				t.Fatal("Decrypt succeeded, want an error")
+			}
+			if tc.wantErr != nil && !errors.Is(err, tc.wantErr) {
+				t.Fatalf("Decrypt = %v, want %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewKeyring_Validation(t *testing.T) {
+	for name, tc := range map[string]struct {
+		keys    map[string][]byte
+		ids     []string
+		active  string
+		wantErr bool
+	}{
+		"first id is active by default": {keys: map[string][]byte{"a": testKey("a"), "b": testKey("b")}, ids: []string{"b", "a"}},
+		"explicit active":               {keys: map[string][]byte{"a": testKey("a"), "b": testKey("b")}, ids: []string{"a", "b"}, active: "b"},
+		"no keys":                       {wantErr: true},
+		"short key":                     {keys: map[string][]byte{"a": []byte("short")}, ids: []string{"a"}, wantErr: true},
+		"active not configured":         {keys: map[string][]byte{"a": testKey("a")}, ids: []string{"a"}, active: "z", wantErr: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			kr, err := NewKeyring(tc.keys, tc.ids, tc.active)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("NewKeyring succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewKeyring: %v", err)
+			}
+			want := tc.active
+			if want == "" {
+				want = tc.ids[0]
+			}
+			if kr.ActiveID() != want {
+				t.Fatalf("ActiveID = %q, want %q", kr.ActiveID(), want)
+			}
+		})
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	a := base64.StdEncoding.EncodeToString(testKey("a"))
+	b := base64.StdEncoding.EncodeToString(testKey("b"))
+	for name, tc := range map[string]struct {
+		spec    string
+		wantIDs []string
+		wantErr bool
+	}{
+		"empty":              {spec: ""},
+		"comma separated":    {spec: "a:" + a + ", b:" + b, wantIDs: []string{"a", "b"}},
+		"lines and comments": {spec: "# keys\nb:" + b + " # new\n\na:" + a, wantIDs: []string{"b", "a"}},
+		"missing separator":  {spec: a, wantErr: true},
+		"missing id":         {spec: ":" + a, wantErr: true},
+		"invalid base64":     {spec: "a:not base64!", wantErr: true},
+		"duplicate id":       {spec: "a:" + a + ",a:" + b, wantErr: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			keys, ids, err := ParseKeys(tc.spec)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("ParseKeys succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseKeys: %v", err)
+			}
+			if strings.Join(ids, ",") != strings.Join(tc.wantIDs, ",") || len(keys) != len(tc.wantIDs) {
+				t.Fatalf("ParseKeys = %v, %v; want ids %v", keys, ids, tc.wantIDs)
+			}
+		})
+	}
+}
+
+func TestLoadKeyring(t *testing.T) {
+	a := base64.StdEncoding.EncodeToString(testKey("a"))
+	b := base64.StdEncoding.EncodeToString(testKey("b"))
+	path := filepath.Join(t.TempDir(), "keks")
+	if err := os.WriteFile(path, []byte("b:"+b+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// 鍵が無ければ暗号化しない
+	if kr, err := LoadKeyring("", "", ""); kr != nil || err != nil {
+		t.Fatalf("LoadKeyring() = %v, %v; want nil, nil", kr, err)
+	}
+	if _, err := LoadKeyring("", "", "a"); err == nil {
+		t.Fatal("LoadKeyring with an active key but no keys succeeded")
+	}
+	// 環境変数とファイルの鍵を合わせて使う
+	kr, err := LoadKeyring("a:"+a, path, "b")
+	if err != nil {
+		t.Fatalf("LoadKeyring: %v", err)
+	}
+	blob, err := newTestKeyring(t, "a", "a").Encrypt([]byte("x"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kr.Decrypt(blob, nil); err != nil || kr.ActiveID() != "b" {
+		t.Fatalf("Decrypt with the loaded keyring = %v (active %q)", err, kr.ActiveID())
+	}
+	if _, err := LoadKeyring("", filepath.Join(t.TempDir(), "missing"), ""); err == nil {
+		t.Fatal("LoadKeyring with a missing file succeeded")
+	}
+}
@@ -6,27 +6,47 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"net/http"
 	"os"
 	"path/filepath"
 
 	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
+
 	storageif "github.com/kawabatas/mini-web-app/internal/infra/storage"
 	"github.com/kawabatas/mini-web-app/internal/util/clock"
 )
 
-// DownloadIfNeeded fetches object into dest. Creates empty file if not found.
-func DownloadIfNeeded(ctx context.Context, bucketName, objectName, dest string) error {
+// Adapter implements storage.ObjectStore using a single GCS client.
+// WAL の配送やリースの延長で数秒おきに呼ばれるため、クライアントは NewAdapter で 1 つだけ作って使い回し、終了時に Close で閉じます。
+type Adapter struct {
+	client *storage.Client
+}
+
+var _ storageif.ObjectStore = (*Adapter)(nil)
+
+// NewAdapter は GCS クライアントを作成して Adapter を返します。ctx はクライアントの認証に使うため、プロセスの間有効なものを渡すこと。
+func NewAdapter(ctx context.Context) (*Adapter, error) {
 	client, err := storage.NewClient(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer client.Close()
+	return &Adapter{client: client}, nil
+}
+
+// Close は GCS クライアントを閉じます。
+func (a *Adapter) Close() error {
+	return a.client.Close()
+}
 
-	rc, err := client.Bucket(bucketName).Object(objectName).NewReader(ctx)
+// DownloadIfNeeded fetches object into dest. Creates empty file if not found.
+func (a *Adapter) DownloadIfNeeded(ctx context.Context, bucket, object, dest string) error {
+	rc, err := a.client.Bucket(bucket).Object(object).NewReader(ctx)
 	if err != nil {
 		// オブジェクトが存在しない場合は空ファイル作成し、nil を返す
 		if errors.Is(err, storage.ErrObjectNotExist) {
-			slog.WarnContext(ctx, fmt.Sprintf("datastore file is not found on GCS, so create new file: %s", objectName))
+			slog.WarnContext(ctx, fmt.Sprintf("datastore file is not found on GCS, so create new file: %s", object))
 			f, cErr := os.Create(dest)
 			if cErr == nil {
 				f.Close()
@@ -49,24 +69,34 @@ func DownloadIfNeeded(ctx context.Context, bucketName, objectName, dest string)
 	return err
 }
 
-// Adapter implements storage.ObjectStore using GCS client per call.
-// 現状、起動・終了・定期実行（10分間隔など）での使用のみを想定しているため GCS クライアントは都度生成します。
-type Adapter struct{}
-
-var _ storageif.ObjectStore = (*Adapter)(nil)
+// UploadTwoPhaseWithBackup implements two-phase publish and versioned backup.
+func (a *Adapter) UploadTwoPhaseWithBackup(ctx context.Context, bucket, currentObject, backupObject, localPath string) error {
+	_, err := a.uploadTwoPhase(ctx, bucket, currentObject, backupObject, localPath, nil)
+	return err
+}
 
-func (a *Adapter) DownloadIfNeeded(ctx context.Context, bucket, object, dest string) error {
-	return DownloadIfNeeded(ctx, bucket, object, dest)
+// UploadTwoPhaseIfGeneration は current へのコピーに世代番号の前提条件（ifGenerationMatch、0 は存在しないこと）を付けた二相アップロードです。
+func (a *Adapter) UploadTwoPhaseIfGeneration(ctx context.Context, bucket, currentObject, backupObject, localPath string, ifGeneration int64) (int64, error) {
+	cond := generationCondition(ifGeneration)
+	return a.uploadTwoPhase(ctx, bucket, currentObject, backupObject, localPath, &cond)
 }
 
-// UploadTwoPhaseWithBackup implements two-phase publish and versioned backup.
-func (a *Adapter) UploadTwoPhaseWithBackup(ctx context.Context, bucket, currentObject, backupObject, localPath string) error {
-	client, err := storage.NewClient(ctx)
-	if err != nil {
-		return err
+// generationCondition は世代番号の前提条件です（0 は存在しないこと）。
+func generationCondition(ifGeneration int64) storage.Conditions {
+	if ifGeneration == 0 {
+		return storage.Conditions{DoesNotExist: true}
 	}
-	defer client.Close()
+	return storage.Conditions{GenerationMatch: ifGeneration}
+}
 
+// isPreconditionFailed は前提条件の不一致（412）かを判定します。
+func isPreconditionFailed(err error) bool {
+	var gerr *googleapi.Error
+	return errors.As(err, &gerr) && gerr.Code == http.StatusPreconditionFailed
+}
+
+// uploadTwoPhase は二相アップロードを行い、置き換えた current の世代番号を返します（cond は current への前提条件、nil は無条件）。
+func (a *Adapter) uploadTwoPhase(ctx context.Context, bucket, currentObject, backupObject, localPath string, cond *storage.Conditions) (int64, error) {
 	// 1. upload to tmp object
 	ts := clock.NowUTCFormatted("20060102-150405")
 	base := filepath.Base(currentObject)
@@ -74,39 +104,166 @@ func (a *Adapter) UploadTwoPhaseWithBackup(ctx context.Context, bucket, currentO
 
 	f, err := os.Open(localPath)
 	if err != nil {
-		return err
+		return 0, err
 	}
-	wc := client.Bucket(bucket).Object(tmpName).NewWriter(ctx)
+	wc := a.client.Bucket(bucket).Object(tmpName).NewWriter(ctx)
 	if _, err := io.Copy(wc, f); err != nil {
 		_ = wc.Close()
 		_ = f.Close()
-		return err
+		return 0, err
 	}
 	if err := wc.Close(); err != nil {
 		_ = f.Close()
-		return err
+		return 0, err
 	}
 	_ = f.Close()
 
-	// 2. copy tmp -> current
-	dst := client.Bucket(bucket).Object(currentObject)
-	copier := dst.CopierFrom(client.Bucket(bucket).Object(tmpName))
-	if _, err := copier.Run(ctx); err != nil {
-		_ = client.Bucket(bucket).Object(tmpName).Delete(ctx)
-		return err
+	// 2. copy tmp -> current（cond があれば他者が先に置き換えていないことを GCS 側で確認）
+	dst := a.client.Bucket(bucket).Object(currentObject)
+	if cond != nil {
+		dst = dst.If(*cond)
+	}
+	copier := dst.CopierFrom(a.client.Bucket(bucket).Object(tmpName))
+	attrs, err := copier.Run(ctx)
+	if err != nil {
+		_ = a.client.Bucket(bucket).Object(tmpName).Delete(ctx)
+		if isPreconditionFailed(err) {
+			return 0, fmt.Errorf("%w: gs://%s/%s", storageif.ErrPreconditionFailed, bucket, currentObject)
+		}
+		return 0, err
 	}
 
 	// 3. copy tmp -> backups/yyyy-mm-dd/HHMMSS-<base>
 	if backupObject == "" {
 		backupObject = "backups/" + clock.NowUTCFormatted("2006-01-02") + "/" + clock.NowUTCFormatted("150405") + "-" + base
 	}
-	bdst := client.Bucket(bucket).Object(backupObject)
-	bcopier := bdst.CopierFrom(client.Bucket(bucket).Object(tmpName))
+	bdst := a.client.Bucket(bucket).Object(backupObject)
+	bcopier := bdst.CopierFrom(a.client.Bucket(bucket).Object(tmpName))
 	if _, err := bcopier.Run(ctx); err != nil {
-		_ = client.Bucket(bucket).Object(tmpName).Delete(ctx)
-		return err
+		_ = a.client.Bucket(bucket).Object(tmpName).Delete(ctx)
+		return attrs.Generation, err
 	}
 
 	// 4. delete tmp
-	return client.Bucket(bucket).Object(tmpName).Delete(ctx)
+	return attrs.Generation, a.client.Bucket(bucket).Object(tmpName).Delete(ctx)
+}
+
+// Upload は localPath の内容を object として保存します。
+func (a *Adapter) Upload(ctx context.Context, bucket, object, localPath string) error {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	wc := a.client.Bucket(bucket).Object(object).NewWriter(ctx)
+	if _, err := io.Copy(wc, f); err != nil {
+		_ = wc.Close()
+		return err
+	}
+	return wc.Close()
+}
+
+// UploadIfGeneration は object の世代番号が ifGeneration の場合のみ localPath の内容で置き換え、書き込んだ世代番号を返します。
+func (a *Adapter) UploadIfGeneration(ctx context.Context, bucket, object, localPath string, ifGeneration int64) (int64, error) {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	wc := a.client.Bucket(bucket).Object(object).If(generationCondition(ifGeneration)).NewWriter(ctx)
+	if _, err := io.Copy(wc, f); err != nil {
+		_ = wc.Close()
+		return 0, err
+	}
+	if err := wc.Close(); err != nil {
+		if isPreconditionFailed(err) {
+			return 0, fmt.Errorf("%w: gs://%s/%s", storageif.ErrPreconditionFailed, bucket, object)
+		}
+		return 0, err
+	}
+	return wc.Attrs().Generation, nil
+}
+
+// Download は object を dest に保存します。存在しない場合は storageif.ErrNotExist を返します。
+func (a *Adapter) Download(ctx context.Context, bucket, object, dest string) error {
+	rc, err := a.client.Bucket(bucket).Object(object).NewReader(ctx)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			return fmt.Errorf("%w: gs://%s/%s", storageif.ErrNotExist, bucket, object)
+		}
+		return err
+	}
+	defer rc.Close()
+
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, rc); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// Stat は object の属性を返します。存在しない場合は storageif.ErrNotExist を返します。
+func (a *Adapter) Stat(ctx context.Context, bucket, object string) (storageif.ObjectAttrs, error) {
+	attrs, err := a.client.Bucket(bucket).Object(object).Attrs(ctx)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			return storageif.ObjectAttrs{}, fmt.Errorf("%w: gs://%s/%s", storageif.ErrNotExist, bucket, object)
+		}
+		return storageif.ObjectAttrs{}, err
+	}
+	return storageif.ObjectAttrs{Name: attrs.Name, Size: attrs.Size, Updated: attrs.Updated, Generation: attrs.Generation}, nil
+}
+
+// DownloadGeneration は object を dest に保存し、読み取ったオブジェクトの世代番号を返します。
+func (a *Adapter) DownloadGeneration(ctx context.Context, bucket, object, dest string) (int64, error) {
+	rc, err := a.client.Bucket(bucket).Object(object).NewReader(ctx)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			return 0, fmt.Errorf("%w: gs://%s/%s", storageif.ErrNotExist, bucket, object)
+		}
+		return 0, err
+	}
+	defer rc.Close()
+
+	out, err := os.Create(dest)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := io.Copy(out, rc); err != nil {
+		_ = out.Close()
+		return 0, err
+	}
+	return rc.Attrs.Generation, out.Close()
+}
+
+// List は prefix で始まるオブジェクトを名前順に返します。
+func (a *Adapter) List(ctx context.Context, bucket, prefix string) ([]storageif.ObjectAttrs, error) {
+	var out []storageif.ObjectAttrs
+	it := a.client.Bucket(bucket).Objects(ctx, &storage.Query{Prefix: prefix})
+	for {
+		attrs, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, storageif.ObjectAttrs{Name: attrs.Name, Size: attrs.Size, Updated: attrs.Updated, Generation: attrs.Generation})
+	}
+	return out, nil
+}
+
+// Delete は object を削除します。存在しない場合は storageif.ErrNotExist を返します。
+func (a *Adapter) Delete(ctx context.Context, bucket, object string) error {
+	if err := a.client.Bucket(bucket).Object(object).Delete(ctx); err != nil {
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			return fmt.Errorf("%w: gs://%s/%s", storageif.ErrNotExist, bucket, object)
+		}
+		return err
+	}
+	return nil
 }
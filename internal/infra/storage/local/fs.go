@@ -0,0 +1,299 @@
+package local
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	storageif "github.com/kawabatas/mini-web-app/internal/infra/storage"
+)
+
+// FS はローカルディレクトリをバケットとして扱う ObjectStore です（bucket はディレクトリのパス）。
+// GCS を使わずにスナップショットの同期・復元を検証するためのものです。
+// オブジェクト名の "/" はサブディレクトリになり、書き込みは一時ファイル + rename で原子的に行います。
+// 世代番号はファイルの更新時刻（ナノ秒）で、条件付きの書き込みはロックファイルでプロセス間でも直列化します。
+type FS struct{}
+
+var _ storageif.ObjectStore = FS{}
+
+func objectPath(bucket, object string) (string, error) {
+	if object == "" || strings.Contains(object, "..") {
+		return "", fmt.Errorf("invalid object name: %q", object)
+	}
+	return filepath.Join(bucket, filepath.FromSlash(object)), nil
+}
+
+// DownloadIfNeeded は GCS 実装と同様に、object が無い場合は空ファイルを作成します。
+func (s FS) DownloadIfNeeded(ctx context.Context, bucket, object, dest string) error {
+	err := s.Download(ctx, bucket, object, dest)
+	if errors.Is(err, storageif.ErrNotExist) {
+		slog.WarnContext(ctx, "datastore file is not found on local bucket, so create new file", slog.String("object", object))
+		f, cErr := os.Create(dest)
+		if cErr == nil {
+			f.Close()
+		}
+		return nil
+	}
+	return err
+}
+
+func (s FS) UploadTwoPhaseWithBackup(ctx context.Context, bucket, currentObject, backupObject, localPath string) error {
+	if err := s.Upload(ctx, bucket, currentObject, localPath); err != nil {
+		return err
+	}
+	if backupObject == "" {
+		return nil
+	}
+	return s.Upload(ctx, bucket, backupObject, localPath)
+}
+
+func (FS) Upload(ctx context.Context, bucket, object, localPath string) error {
+	dst, err := objectPath(bucket, object)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	return copyFileAtomic(localPath, dst)
+}
+
+func (FS) Download(ctx context.Context, bucket, object, dest string) error {
+	src, err := objectPath(bucket, object)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(src); errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %s", storageif.ErrNotExist, src)
+	}
+	return copyFileAtomic(src, dest)
+}
+
+func (FS) List(ctx context.Context, bucket, prefix string) ([]storageif.ObjectAttrs, error) {
+	var out []storageif.ObjectAttrs
+	err := filepath.WalkDir(bucket, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		// 一時ファイル（.tmp-*）・ロックファイル（.lock-*）は対象外
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".") {
+			return nil
+		}
+		rel, err := filepath.Rel(bucket, p)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if !strings.HasPrefix(name, prefix) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		out = append(out, storageif.ObjectAttrs{Name: name, Size: info.Size(), Updated: info.ModTime(), Generation: info.ModTime().UnixNano()})
+		return nil
+	})
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, err
+}
+
+func (FS) Delete(ctx context.Context, bucket, object string) error {
+	p, err := objectPath(bucket, object)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("%w: %s", storageif.ErrNotExist, p)
+		}
+		return err
+	}
+	return nil
+}
+
+func (FS) Stat(ctx context.Context, bucket, object string) (storageif.ObjectAttrs, error) {
+	p, err := objectPath(bucket, object)
+	if err != nil {
+		return storageif.ObjectAttrs{}, err
+	}
+	info, err := os.Stat(p)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return storageif.ObjectAttrs{}, fmt.Errorf("%w: %s", storageif.ErrNotExist, p)
+		}
+		return storageif.ObjectAttrs{}, err
+	}
+	return storageif.ObjectAttrs{Name: object, Size: info.Size(), Updated: info.ModTime(), Generation: info.ModTime().UnixNano()}, nil
+}
+
+func (FS) DownloadGeneration(ctx context.Context, bucket, object, dest string) (int64, error) {
+	src, err := objectPath(bucket, object)
+	if err != nil {
+		return 0, err
+	}
+	// 開いたファイルは置き換えられても内容が変わらないため、開いたファイルの更新時刻が内容の世代番号になる
+	in, err := os.Open(src)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return 0, fmt.Errorf("%w: %s", storageif.ErrNotExist, src)
+		}
+		return 0, err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return 0, err
+	}
+	out, err := os.Create(dest)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return 0, err
+	}
+	return info.ModTime().UnixNano(), out.Close()
+}
+
+func (s FS) UploadTwoPhaseIfGeneration(ctx context.Context, bucket, currentObject, backupObject, localPath string, ifGeneration int64) (int64, error) {
+	gen, err := s.UploadIfGeneration(ctx, bucket, currentObject, localPath, ifGeneration)
+	if err != nil {
+		return 0, err
+	}
+	if backupObject != "" {
+		if err := s.Upload(ctx, bucket, backupObject, localPath); err != nil {
+			return gen, err
+		}
+	}
+	return gen, nil
+}
+
+func (FS) UploadIfGeneration(ctx context.Context, bucket, object, localPath string, ifGeneration int64) (int64, error) {
+	dst, err := objectPath(bucket, object)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return 0, err
+	}
+	unlock, err := lockObject(ctx, dst)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+	gen, err := fileGeneration(dst)
+	if err != nil {
+		return 0, err
+	}
+	if gen != ifGeneration {
+		return 0, fmt.Errorf("%w: %s (generation %d, want %d)", storageif.ErrPreconditionFailed, dst, gen, ifGeneration)
+	}
+	return copyFileNextGeneration(localPath, dst, gen)
+}
+
+// fileGeneration は p の世代番号（更新時刻のナノ秒、存在しなければ 0）を返します。
+func fileGeneration(p string) (int64, error) {
+	info, err := os.Stat(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return info.ModTime().UnixNano(), nil
+}
+
+// staleLockAge を過ぎたロックファイルは異常終了で残ったものとみなして破棄します。
+const staleLockAge = time.Minute
+
+// lockObject は dst への条件付き書き込みのロックファイル（.lock-<名前>）を取得し、解放する関数を返します。
+func lockObject(ctx context.Context, dst string) (func(), error) {
+	lock := filepath.Join(filepath.Dir(dst), ".lock-"+filepath.Base(dst))
+	for {
+		f, err := os.OpenFile(lock, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			_ = f.Close()
+			return func() { _ = os.Remove(lock) }, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, err
+		}
+		if info, sErr := os.Stat(lock); sErr == nil && time.Since(info.ModTime()) > staleLockAge {
+			_ = os.Remove(lock)
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+// copyFileNextGeneration は copyFileAtomic と同様にコピーし、新しい世代番号を返します。
+// 更新時刻の粒度が粗いファイルシステムでも世代番号が変わるよう、prev 以下なら rename の前に更新時刻を進めます。
+func copyFileNextGeneration(src, dst string, prev int64) (int64, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".tmp-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, in); err != nil {
+		_ = tmp.Close()
+		return 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, err
+	}
+	gen, err := fileGeneration(tmp.Name())
+	if err != nil {
+		return 0, err
+	}
+	if gen <= prev {
+		gen = prev + 1
+		t := time.Unix(0, gen)
+		if err := os.Chtimes(tmp.Name(), t, t); err != nil {
+			return 0, err
+		}
+	}
+	return gen, os.Rename(tmp.Name(), dst)
+}
+
+// copyFileAtomic は src を dst と同じディレクトリの一時ファイルにコピーしてから rename します。
+func copyFileAtomic(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, in); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
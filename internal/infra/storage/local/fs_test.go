@@ -0,0 +1,210 @@
+package local
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	storageif "github.com/kawabatas/mini-web-app/internal/infra/storage"
+)
+
+// writeFile は一時ディレクトリに data のファイルを作り、そのパスを返します。
+func writeFile(t *testing.T, data string) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), "data")
+	if err := os.WriteFile(p, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// readObject はバケットの object の内容を返します（無ければ空文字列）。
+func readObject(t *testing.T, bucket, object string) string {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join(bucket, filepath.FromSlash(object)))
+	if errors.Is(err, os.ErrNotExist) {
+		return ""
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestFS_UploadIfGeneration(t *testing.T) {
+	ctx := context.Background()
+	for name, tc := range map[string]struct {
+		existing  bool
+		modTime   time.Time // 既存のオブジェクトの更新時刻（ゼロなら現在時刻）
+		ifGen     func(gen int64) int64
+		wantError error
+	}{
+		"create when absent":        {ifGen: func(int64) int64 { return 0 }},
+		"absent but a generation":   {ifGen: func(int64) int64 { return 1 }, wantError: storageif.ErrPreconditionFailed},
+		"replace matching":          {existing: true, ifGen: func(gen int64) int64 { return gen }},
+		"stale generation":          {existing: true, ifGen: func(gen int64) int64 { return gen - 1 }, wantError: storageif.ErrPreconditionFailed},
+		"create but already exists": {existing: true, ifGen: func(int64) int64 { return 0 }, wantError: storageif.ErrPreconditionFailed},
+		// 更新時刻が新しいファイルを書き込んでも世代番号は進む
+		"existing modified in the future": {existing: true, modTime: time.Now().Add(time.Hour), ifGen: func(gen int64) int64 { return gen }},
+	} {
+		t.Run(name, func(t *testing.T) {
+			bucket := t.TempDir()
+			var prev int64
+			if tc.existing {
+				if err := (FS{}).Upload(ctx, bucket, "dir/obj", writeFile(t, "old")); err != nil {
+					t.Fatal(err)
+				}
+				if !tc.modTime.IsZero() {
+					if err := os.Chtimes(filepath.Join(bucket, "dir", "obj"), tc.modTime, tc.modTime); err != nil {
+						t.Fatal(err)
+					}
+				}
+				attrs, err := FS{}.Stat(ctx, bucket, "dir/obj")
+				if err != nil {
+					t.Fatal(err)
+				}
+				prev = attrs.Generation
+			}
+
+			gen, err := FS{}.UploadIfGeneration(ctx, bucket, "dir/obj", writeFile(t, "new"), tc.ifGen(prev))
+			if tc.wantError != nil {
+				if !errors.Is(err, tc.wantError) {
+					t.Fatalf("UploadIfGeneration = %d, %v; want %v", gen, err, tc.wantError)
+				}
+				want := ""
+				if tc.existing {
+					want = "old"
+				}
+				if got := readObject(t, bucket, "dir/obj"); got != want {
+					t.Fatalf("object = %q, want %q (unchanged)", got, want)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("UploadIfGeneration: %v", err)
+			}
+			attrs, err := FS{}.Stat(ctx, bucket, "dir/obj")
+			if err != nil || attrs.Generation != gen || gen <= prev {
+				t.Fatalf("generation = %d (stat %+v, %v); want the returned generation above %d", gen, attrs, err, prev)
+			}
+			if got := readObject(t, bucket, "dir/obj"); got != "new" {
+				t.Fatalf("object = %q, want new", got)
+			}
+		})
+	}
+}
+
+func TestFS_UploadTwoPhaseIfGeneration(t *testing.T) {
+	ctx := context.Background()
+	bucket := t.TempDir()
+	gen, err := FS{}.UploadTwoPhaseIfGeneration(ctx, bucket, "current", "backups/1", writeFile(t, "v1"), 0)
+	if err != nil {
+		t.Fatalf("first upload: %v", err)
+	}
+	// 前提の世代番号が古ければ current も backup も書き込まない
+	if _, err := (FS{}).UploadTwoPhaseIfGeneration(ctx, bucket, "current", "backups/2", writeFile(t, "v2"), gen-1); !errors.Is(err, storageif.ErrPreconditionFailed) {
+		t.Fatalf("upload with a stale generation = %v, want ErrPreconditionFailed", err)
+	}
+	if got := readObject(t, bucket, "current"); got != "v1" {
+		t.Fatalf("current = %q, want v1", got)
+	}
+	if got := readObject(t, bucket, "backups/2"); got != "" {
+		t.Fatalf("backup was written despite the failed precondition: %q", got)
+	}
+	if _, err := (FS{}).UploadTwoPhaseIfGeneration(ctx, bucket, "current", "backups/2", writeFile(t, "v2"), gen); err != nil {
+		t.Fatalf("upload with the current generation: %v", err)
+	}
+	if readObject(t, bucket, "current") != "v2" || readObject(t, bucket, "backups/2") != "v2" {
+		t.Fatal("current and backup were not both written")
+	}
+}
+
+func TestFS_UploadIfGenerationLock(t *testing.T) {
+	bucket := t.TempDir()
+	lock := filepath.Join(bucket, ".lock-obj")
+	if err := os.WriteFile(lock, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// 他者がロック中は待ち、ctx が終了すれば諦める
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := (FS{}).UploadIfGeneration(ctx, bucket, "obj", writeFile(t, "v1"), 0); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("UploadIfGeneration while locked = %v, want DeadlineExceeded", err)
+	}
+
+	// 異常終了で残ったロックは破棄する
+	old := time.Now().Add(-2 * staleLockAge)
+	if err := os.Chtimes(lock, old, old); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (FS{}).UploadIfGeneration(context.Background(), bucket, "obj", writeFile(t, "v1"), 0); err != nil {
+		t.Fatalf("UploadIfGeneration with a stale lock: %v", err)
+	}
+	if _, err := os.Stat(lock); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("lock remains after the upload: %v", err)
+	}
+}
+
+func TestFS_MissingObjects(t *testing.T) {
+	ctx := context.Background()
+	bucket := t.TempDir()
+	dest := filepath.Join(t.TempDir(), "dest")
+	for name, call := range map[string]func() error{
+		"Download": func() error { return FS{}.Download(ctx, bucket, "missing", dest) },
+		"DownloadGeneration": func() error {
+			_, err := FS{}.DownloadGeneration(ctx, bucket, "missing", dest)
+			return err
+		},
+		"Stat": func() error {
+			_, err := FS{}.Stat(ctx, bucket, "missing")
+			return err
+		},
+		"Delete": func() error { return FS{}.Delete(ctx, bucket, "missing") },
+	} {
+		t.Run(name, func(t *testing.T) {
+			if err := call(); !errors.Is(err, storageif.ErrNotExist) {
+				t.Fatalf("%s = %v, want ErrNotExist", name, err)
+			}
+		})
+	}
+	if err := (FS{}).Upload(ctx, bucket, "../escape", writeFile(t, "x")); err == nil {
+		t.Fatal("Upload outside the bucket succeeded")
+	}
+}
+
+func TestFS_List(t *testing.T) {
+	ctx := context.Background()
+	bucket := t.TempDir()
+	for _, name := range []string{"backups/2026-10-16/b", "backups/2026-10-15/a", "current"} {
+		if err := (FS{}).Upload(ctx, bucket, name, writeFile(t, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 一時ファイル・ロックファイルは一覧に含めない
+	for _, name := range []string{".tmp-123", ".lock-current"} {
+		if err := os.WriteFile(filepath.Join(bucket, "backups", name), nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	objs, err := FS{}.List(ctx, bucket, "backups/")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	var names []string
+	for _, o := range objs {
+		names = append(names, o.Name)
+		if o.Size != int64(len(o.Name)) || o.Generation != o.Updated.UnixNano() {
+			t.Fatalf("attrs = %+v", o)
+		}
+	}
+	if len(names) != 2 || names[0] != "backups/2026-10-15/a" || names[1] != "backups/2026-10-16/b" {
+		t.Fatalf("List = %v, want the two backups in name order", names)
+	}
+	if objs, err := (FS{}).List(ctx, filepath.Join(bucket, "missing"), ""); err != nil || len(objs) != 0 {
+		t.Fatalf("List of a missing bucket = %v, %v; want empty", objs, err)
+	}
+}
@@ -1,11 +1,37 @@
 package local
 
-import "context"
+import (
+	"context"
+
+	storageif "github.com/kawabatas/mini-web-app/internal/infra/storage"
+)
 
 // Noop implements ObjectStore with no-ops for local usage.
 type Noop struct{}
 
+var _ storageif.ObjectStore = Noop{}
+
 func (Noop) DownloadIfNeeded(ctx context.Context, bucket, object, dest string) error { return nil }
 func (Noop) UploadTwoPhaseWithBackup(ctx context.Context, bucket, currentObject, backupObject, localPath string) error {
 	return nil
 }
+func (Noop) Upload(ctx context.Context, bucket, object, localPath string) error { return nil }
+func (Noop) Download(ctx context.Context, bucket, object, dest string) error {
+	return storageif.ErrNotExist
+}
+func (Noop) List(ctx context.Context, bucket, prefix string) ([]storageif.ObjectAttrs, error) {
+	return nil, nil
+}
+func (Noop) Delete(ctx context.Context, bucket, object string) error { return storageif.ErrNotExist }
+func (Noop) Stat(ctx context.Context, bucket, object string) (storageif.ObjectAttrs, error) {
+	return storageif.ObjectAttrs{}, storageif.ErrNotExist
+}
+func (Noop) DownloadGeneration(ctx context.Context, bucket, object, dest string) (int64, error) {
+	return 0, storageif.ErrNotExist
+}
+func (Noop) UploadTwoPhaseIfGeneration(ctx context.Context, bucket, currentObject, backupObject, localPath string, ifGeneration int64) (int64, error) {
+	return 0, nil
+}
+func (Noop) UploadIfGeneration(ctx context.Context, bucket, object, localPath string, ifGeneration int64) (int64, error) {
+	return 0, nil
+}
@@ -1,6 +1,25 @@
 package storage
 
-import "context"
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNotExist はオブジェクトが存在しない場合のエラーです。
+var ErrNotExist = errors.New("object does not exist")
+
+// ErrPreconditionFailed は条件付きの書き込みで、オブジェクトの世代番号が指定と異なった（他者が先に書き込んだ）ことを表します。
+var ErrPreconditionFailed = errors.New("object generation does not match")
+
+// ObjectAttrs は List / Stat で返すオブジェクトの属性です。
+type ObjectAttrs struct {
+	Name    string
+	Size    int64
+	Updated time.Time
+	// Generation はオブジェクトの世代番号です（GCS の generation。書き込むたびに変わり、0 は「存在しない」を表す）。
+	Generation int64
+}
 
 // ObjectStore abstracts a minimal object-storage API used for DB snapshots.
 type ObjectStore interface {
@@ -8,4 +27,25 @@ type ObjectStore interface {
 	// UploadTwoPhaseWithBackup uploads localPath to a tmp object, atomically copies to current,
 	// also writes a versioned backup object, then removes the tmp.
 	UploadTwoPhaseWithBackup(ctx context.Context, bucket, currentObject, backupObject, localPath string) error
+
+	// Upload は localPath の内容を object として保存します（既存は上書き）。
+	Upload(ctx context.Context, bucket, object, localPath string) error
+	// Download は object を dest に保存します。存在しない場合は ErrNotExist。
+	Download(ctx context.Context, bucket, object, dest string) error
+	// List は prefix で始まるオブジェクトを名前順に返します。
+	List(ctx context.Context, bucket, prefix string) ([]ObjectAttrs, error)
+	// Delete は object を削除します。存在しない場合は ErrNotExist。
+	Delete(ctx context.Context, bucket, object string) error
+
+	// Stat は object の属性を返します。存在しない場合は ErrNotExist。
+	Stat(ctx context.Context, bucket, object string) (ObjectAttrs, error)
+	// DownloadGeneration は Download と同様に object を dest に保存し、保存した内容の世代番号を返します。
+	DownloadGeneration(ctx context.Context, bucket, object, dest string) (int64, error)
+	// UploadTwoPhaseIfGeneration は UploadTwoPhaseWithBackup と同様ですが、currentObject の世代番号が ifGeneration
+	// （0 は存在しないこと）の場合のみ置き換え、置き換えた後の世代番号を返します。
+	// 一致しない場合は current も backup も変更せず ErrPreconditionFailed を返します。
+	UploadTwoPhaseIfGeneration(ctx context.Context, bucket, currentObject, backupObject, localPath string, ifGeneration int64) (int64, error)
+	// UploadIfGeneration は object の世代番号が ifGeneration（0 は存在しないこと）の場合のみ localPath の内容で置き換え、
+	// 書き込んだ世代番号を返します。一致しない場合は ErrPreconditionFailed。
+	UploadIfGeneration(ctx context.Context, bucket, object, localPath string, ifGeneration int64) (int64, error)
 }